@@ -0,0 +1,40 @@
+package codec
+
+import (
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+var (
+	// CBOR the CBOR codec, struct fields follow their cbor tags, or their json tags
+	CBOR Codec = newCborCodec()
+)
+
+// cborCodec the CBOR Codec
+type cborCodec struct {
+	encoder cbor.EncMode
+	decoder cbor.DecMode
+}
+
+func newCborCodec() *cborCodec {
+
+	encoder, err := cbor.EncOptions{Sort: cbor.SortCanonical}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	// maps decode with string keys, as the other codecs do
+	decoder, err := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return &cborCodec{encoder: encoder, decoder: decoder}
+}
+
+func (c *cborCodec) Name() string { return "cbor" }
+
+func (c *cborCodec) ContentType() string { return "application/cbor" }
+
+func (c *cborCodec) Marshal(v interface{}) ([]byte, error) { return c.encoder.Marshal(v) }
+
+func (c *cborCodec) Unmarshal(data []byte, v interface{}) error { return c.decoder.Unmarshal(data, v) }
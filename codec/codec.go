@@ -0,0 +1,157 @@
+// Package codec provides the codecs encoding and decoding the typed payloads of the
+// openfaas and goflow packages, and the registry mapping them to their Content-Type
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+var (
+	// JSON the JSON codec
+	JSON Codec = jsonCodec{}
+)
+
+// Codec encodes and decodes typed payloads
+type Codec interface {
+	// Name returns the name of the codec
+	Name() string
+	// ContentType returns the media type of the encoded payloads
+	ContentType() string
+	// Marshal encodes v
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes data into v
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Error a failure to decode the input or encode the output of a typed operation,
+// the vertex and the operation are empty for forwarders and aggregators
+type Error struct {
+	Op        string // "decode" or "encode"
+	Vertex    string // The vertex of the operation
+	Operation string // The operation
+	Codec     string // The name of the codec
+	Type      string // The Go type decoded or encoded
+	Err       error  // The error of the codec
+}
+
+func (err *Error) Error() string {
+
+	what := "input"
+	if err.Op == "encode" {
+		what = "output"
+	}
+	at := ""
+	if err.Vertex != "" {
+		at = fmt.Sprintf("vertex %s, operation %s: ", err.Vertex, err.Operation)
+	}
+	return fmt.Sprintf("%sfailed to %s %s %s as %s, %v", at, err.Op, err.Codec, what, err.Type, err.Err)
+}
+
+func (err *Error) Unwrap() error {
+
+	return err.Err
+}
+
+// jsonCodec the JSON Codec
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// typeName returns the name of the Go type T
+func typeName[T any]() string {
+
+	return reflect.TypeOf((*T)(nil)).Elem().String()
+}
+
+// DecodeInput decodes the input of an operation of vertex into a T, an empty
+// input decodes as the zero T. A failure is returned as an *Error
+func DecodeInput[T any](c Codec, vertex string, operation string, data []byte) (T, error) {
+
+	var value T
+	if len(data) == 0 {
+		return value, nil
+	}
+	err := c.Unmarshal(data, &value)
+	if err != nil {
+		return value, &Error{Op: "decode", Vertex: vertex, Operation: operation,
+			Codec: c.Name(), Type: typeName[T](), Err: err}
+	}
+	return value, nil
+}
+
+// EncodeOutput encodes the output of an operation of vertex. A failure is returned as an *Error
+func EncodeOutput[T any](c Codec, vertex string, operation string, value T) ([]byte, error) {
+
+	data, err := c.Marshal(value)
+	if err != nil {
+		return nil, &Error{Op: "encode", Vertex: vertex, Operation: operation,
+			Codec: c.Name(), Type: typeName[T](), Err: err}
+	}
+	return data, nil
+}
+
+// ForwardErrorHandler handles the codec failure of a forwarder, an *Error, it
+// returns the data forwarded instead
+type ForwardErrorHandler func(data []byte, err error) []byte
+
+// Forwarder returns a typed forwarder, its input is decoded into an In and its output
+// encoded with the codec. A forwarder can't fail, the data forwarded when the input
+// can't be decoded or the output encoded is returned by onError
+func Forwarder[In, Out any](c Codec, forward func(In) Out, onError ForwardErrorHandler) sdk.Forwarder {
+
+	fmt.Println("lib/codec/codec.go::Forwarder start")
+	if c == nil || forward == nil {
+		panic("Error at Forwarder, codec and forwarder must be specified")
+	}
+	if onError == nil {
+		panic("Error at Forwarder, error handler not specified")
+	}
+	fmt.Println("lib/codec/codec.go::Forwarder end")
+	return func(data []byte) []byte {
+		input, err := DecodeInput[In](c, "", "", data)
+		if err != nil {
+			return onError(data, err)
+		}
+		result, err := EncodeOutput(c, "", "", forward(input))
+		if err != nil {
+			return onError(data, err)
+		}
+		return result
+	}
+}
+
+// Aggregator returns a typed aggregator, its inputs are decoded into an In
+// keyed by their vertex and its output encoded with the codec
+func Aggregator[In, Out any](c Codec, aggregate func(map[string]In) (Out, error)) sdk.Aggregator {
+
+	fmt.Println("lib/codec/codec.go::Aggregator start")
+	if c == nil || aggregate == nil {
+		panic("Error at Aggregator, codec and aggregator must be specified")
+	}
+	fmt.Println("lib/codec/codec.go::Aggregator end")
+	return func(inputs map[string][]byte) ([]byte, error) {
+		decoded := make(map[string]In, len(inputs))
+		for vertex, data := range inputs {
+			input, err := DecodeInput[In](c, "", "", data)
+			if err != nil {
+				return nil, fmt.Errorf("input of vertex `%s`, %w", vertex, err)
+			}
+			decoded[vertex] = input
+		}
+		output, err := aggregate(decoded)
+		if err != nil {
+			return nil, err
+		}
+		return EncodeOutput(c, "", "", output)
+	}
+}
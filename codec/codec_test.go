@@ -0,0 +1,94 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type order struct {
+	Id    string `json:"id"`
+	Total int    `json:"total"`
+}
+
+func TestForwarder(t *testing.T) {
+
+	var failure error
+	forward := Forwarder(JSON, func(o order) order {
+		o.Total *= 2
+		return o
+	}, func(data []byte, err error) []byte {
+		failure = err
+		return []byte("failed")
+	})
+	tests := []struct {
+		name   string
+		data   string
+		result string
+		op     string
+	}{
+		{"forwarded", `{"id":"a","total":2}`, `{"id":"a","total":4}`, ""},
+		{"empty input", ``, `{"id":"","total":0}`, ""},
+		{"invalid input", `{"id":1}`, "failed", "decode"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			failure = nil
+			result := forward([]byte(test.data))
+			if string(result) != test.result {
+				t.Fatalf("expected %s, got %s", test.result, result)
+			}
+			var codecErr *Error
+			if test.op == "" {
+				if failure != nil {
+					t.Fatalf("unexpected error %v", failure)
+				}
+				return
+			}
+			if !errors.As(failure, &codecErr) || codecErr.Op != test.op || codecErr.Type != "codec.order" {
+				t.Fatalf("expected a %s error, got %v", test.op, failure)
+			}
+		})
+	}
+}
+
+func TestForwarderEncodeFailure(t *testing.T) {
+
+	var failure error
+	forward := Forwarder(JSON, func(o order) func() { return nil }, func(data []byte, err error) []byte {
+		failure = err
+		return data
+	})
+	if result := forward([]byte(`{"id":"a"}`)); string(result) != `{"id":"a"}` {
+		t.Fatalf("expected the data of the error handler, got %s", result)
+	}
+	var codecErr *Error
+	if !errors.As(failure, &codecErr) || codecErr.Op != "encode" {
+		t.Fatalf("expected an encode error, got %v", failure)
+	}
+}
+
+func TestForwarderDefinition(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		define func()
+		err    string
+	}{
+		{"without codec", func() { Forwarder[order, order](nil, func(o order) order { return o }, nil) },
+			"Error at Forwarder, codec and forwarder must be specified"},
+		{"without error handler", func() { Forwarder(JSON, func(o order) order { return o }, nil) },
+			"Error at Forwarder, error handler not specified"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), test.err) {
+					t.Fatalf("expected panic %q, got %v", test.err, r)
+				}
+			}()
+			test.define()
+		})
+	}
+}
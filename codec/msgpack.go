@@ -0,0 +1,39 @@
+package codec
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var (
+	// MsgPack the MessagePack codec, struct fields follow their json tags
+	MsgPack Codec = msgpackCodec{}
+)
+
+// msgpackCodec the MessagePack Codec
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+
+	var b bytes.Buffer
+	encoder := msgpack.NewEncoder(&b)
+	encoder.SetCustomStructTag("json")
+	encoder.UseCompactInts(true)
+	err := encoder.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(v)
+}
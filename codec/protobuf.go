@@ -0,0 +1,83 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// Protobuf the protocol buffers codec, it encodes and decodes proto.Message values.
+	// Converting its payloads requires the message type, given by ProtobufOf
+	Protobuf Codec = &protobufCodec{}
+)
+
+// protobufCodec the protocol buffers Codec
+type protobufCodec struct {
+	prototype proto.Message // the message type of the payloads, if known
+}
+
+// ProtobufOf returns a protocol buffers codec for payloads of the message type of prototype,
+// it also decodes them into and encodes them from generic values through their JSON mapping,
+// so they convert to and from the other codecs
+func ProtobufOf(prototype proto.Message) Codec {
+
+	fmt.Println("lib/codec/protobuf.go::ProtobufOf start")
+	if prototype == nil {
+		panic("Error at ProtobufOf, message type not specified")
+	}
+	fmt.Println("lib/codec/protobuf.go::ProtobufOf end")
+	return &protobufCodec{prototype: prototype}
+}
+
+func (c *protobufCodec) Name() string {
+
+	if c.prototype != nil {
+		return "protobuf(" + string(c.prototype.ProtoReflect().Descriptor().FullName()) + ")"
+	}
+	return "protobuf"
+}
+
+func (c *protobufCodec) ContentType() string { return "application/x-protobuf" }
+
+func (c *protobufCodec) Marshal(v interface{}) ([]byte, error) {
+
+	if message, ok := v.(proto.Message); ok {
+		return proto.Marshal(message)
+	}
+	if c.prototype == nil {
+		return nil, fmt.Errorf("%T is not a proto.Message", v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	message := c.prototype.ProtoReflect().New().Interface()
+	err = protojson.Unmarshal(data, message)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(message)
+}
+
+func (c *protobufCodec) Unmarshal(data []byte, v interface{}) error {
+
+	if message, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, message)
+	}
+	if c.prototype == nil {
+		return fmt.Errorf("%T is not a proto.Message", v)
+	}
+	message := c.prototype.ProtoReflect().New().Interface()
+	err := proto.Unmarshal(data, message)
+	if err != nil {
+		return err
+	}
+	encoded, err := protojson.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, v)
+}
@@ -0,0 +1,217 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// registry is the process wide codec registry, by media type
+	registry = map[string]Codec{}
+	// registryLock guards the registry
+	registryLock sync.RWMutex
+)
+
+func init() {
+
+	Register(JSON)
+	Register(Protobuf)
+	Register(MsgPack)
+	Register(CBOR)
+}
+
+// Register registers a codec for its Content-Type, replacing the codec registered
+// for the same media type. JSON, Protobuf, MsgPack and CBOR are registered by default
+func Register(c Codec) {
+
+	fmt.Println("lib/codec/registry.go::Register start")
+	mediaType := mediaTypeOf(c.ContentType())
+	if mediaType == "" {
+		panic(fmt.Sprintf("Error at Register for %s, invalid content type `%s`", c.Name(), c.ContentType()))
+	}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry[mediaType] = c
+	fmt.Println("lib/codec/registry.go::Register end")
+}
+
+// Lookup returns the codec registered for a Content-Type, its parameters are ignored
+func Lookup(contentType string) (Codec, bool) {
+
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	c, ok := registry[mediaTypeOf(contentType)]
+	return c, ok
+}
+
+// ForContentType returns the codec decoding a payload of a Content-Type, prefer when its media
+// type matches, such as a Protobuf codec knowing the message type, otherwise the registered codec
+func ForContentType(contentType string, prefer Codec) (Codec, bool) {
+
+	if prefer != nil && mediaTypeOf(contentType) == mediaTypeOf(prefer.ContentType()) {
+		return prefer, true
+	}
+	return Lookup(contentType)
+}
+
+// Accept returns an Accept header preferring the codecs in order, such as
+// `application/x-protobuf, application/json;q=0.9`
+func Accept(codecs ...Codec) string {
+
+	ranges := []string{}
+	seen := map[string]bool{}
+	for _, c := range codecs {
+		mediaType := mediaTypeOf(c.ContentType())
+		if seen[mediaType] {
+			continue
+		}
+		seen[mediaType] = true
+		if len(ranges) == 0 {
+			ranges = append(ranges, mediaType)
+			continue
+		}
+		quality := 1 - 0.1*float64(len(ranges))
+		if quality < 0.1 {
+			quality = 0.1
+		}
+		ranges = append(ranges, fmt.Sprintf("%s;q=%.1f", mediaType, quality))
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// Negotiate returns the registered codec preferred by an Accept header, following the
+// quality values. An empty header or a `*/*` range accepts any codec, the preferred of
+// which is given by prefer. The media type of prefer negotiates prefer
+func Negotiate(accept string, prefer Codec) (Codec, bool) {
+
+	fmt.Println("lib/codec/registry.go::Negotiate start")
+	if strings.TrimSpace(accept) == "" {
+		return prefer, prefer != nil
+	}
+	type mediaRange struct {
+		mediaType string
+		quality   float64
+		order     int
+	}
+	ranges := []mediaRange{}
+	for i, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality, order: i})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].quality > ranges[j].quality })
+
+	for _, r := range ranges {
+		if r.mediaType == "*/*" && prefer != nil {
+			return prefer, true
+		}
+		if strings.HasSuffix(r.mediaType, "/*") && prefer != nil &&
+			strings.HasPrefix(mediaTypeOf(prefer.ContentType()), strings.TrimSuffix(r.mediaType, "*")) {
+			return prefer, true
+		}
+		if c, ok := ForContentType(r.mediaType, prefer); ok {
+			return c, true
+		}
+	}
+	fmt.Println("lib/codec/registry.go::Negotiate end")
+	return nil, false
+}
+
+// Convert converts a payload encoded with from into a payload encoded with to,
+// through its generic value. A payload is returned as it is when the codecs are the same.
+// Whole numbers convert as integers, so {"n":1} converts to the integer 1 and not to 1.0
+func Convert(data []byte, from Codec, to Codec) ([]byte, error) {
+
+	fmt.Println("lib/codec/registry.go::Convert start")
+	if from == to || mediaTypeOf(from.ContentType()) == mediaTypeOf(to.ContentType()) {
+		return data, nil
+	}
+	value, err := genericValue(data, from)
+	if err != nil {
+		return nil, &Error{Op: "decode", Codec: from.Name(), Type: "generic value", Err: err}
+	}
+	result, err := to.Marshal(normalizeNumbers(value))
+	if err != nil {
+		return nil, &Error{Op: "encode", Codec: to.Name(), Type: "generic value", Err: err}
+	}
+	fmt.Println("lib/codec/registry.go::Convert end")
+	return result, nil
+}
+
+// genericValue decodes a payload encoded with c into its generic value, JSON numbers are kept as json.Number
+func genericValue(data []byte, c Codec) (interface{}, error) {
+
+	var value interface{}
+	if mediaTypeOf(c.ContentType()) != mediaTypeOf(JSON.ContentType()) {
+		err := c.Unmarshal(data, &value)
+		return value, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after the value")
+	}
+	return value, nil
+}
+
+// normalizeNumbers replaces the numbers of a generic value holding a whole value with
+// integers, the other numbers with float64
+func normalizeNumbers(value interface{}) interface{} {
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeNumbers(item)
+		}
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return normalizeNumbers(f)
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+			return int64(v)
+		}
+	}
+	return value
+}
+
+// mediaTypeOf returns the lower case media type of a Content-Type, without its parameters
+func mediaTypeOf(contentType string) string {
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
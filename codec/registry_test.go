@@ -0,0 +1,192 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestConvert(t *testing.T) {
+
+	tests := []struct {
+		name string
+		data string
+		to   Codec
+		// the expected payload, encoded with to
+		result interface{}
+	}{
+		{"whole number to msgpack", `{"n":1}`, MsgPack, map[string]interface{}{"n": 1}},
+		{"negative number to msgpack", `{"n":-3}`, MsgPack, map[string]interface{}{"n": -3}},
+		{"decimal number to msgpack", `{"n":1.5}`, MsgPack, map[string]interface{}{"n": 1.5}},
+		{"large number to msgpack", `{"n":18446744073709551615}`, MsgPack, map[string]interface{}{"n": uint64(18446744073709551615)}},
+		{"nested numbers to cbor", `{"a":[1,{"b":2.25}]}`, CBOR,
+			map[string]interface{}{"a": []interface{}{1, map[string]interface{}{"b": 2.25}}}},
+		{"strings to cbor", `["x",true,null]`, CBOR, []interface{}{"x", true, nil}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := Convert([]byte(test.data), JSON, test.to)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			expected, err := test.to.Marshal(test.result)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !bytes.Equal(result, expected) {
+				t.Fatalf("expected %x, got %x", expected, result)
+			}
+			// the payload converts back to the same JSON
+			back, err := Convert(result, test.to, JSON)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if string(back) != test.data {
+				t.Fatalf("expected %s back, got %s", test.data, back)
+			}
+		})
+	}
+}
+
+func TestConvertMsgPackWholeNumber(t *testing.T) {
+
+	result, err := Convert([]byte(`{"n":1}`), JSON, MsgPack)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// a fixmap of one entry, "n" and the fixint 1, not the float64 0xcb
+	if !bytes.Equal(result, []byte{0x81, 0xa1, 'n', 0x01}) {
+		t.Fatalf("expected the integer 1, got %x", result)
+	}
+}
+
+func TestConvertProtobuf(t *testing.T) {
+
+	message, _ := structpb.NewStruct(map[string]interface{}{"name": "a", "count": 2})
+	c := ProtobufOf(&structpb.Struct{})
+	data, err := c.Marshal(message)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	result, err := Convert(data, c, JSON)
+	if err != nil || string(result) != `{"count":2,"name":"a"}` {
+		t.Fatalf("expected the JSON of the message, got %s, %v", result, err)
+	}
+	back, err := Convert(result, JSON, c)
+	decoded := &structpb.Struct{}
+	if err != nil || proto.Unmarshal(back, decoded) != nil || !proto.Equal(decoded, message) {
+		t.Fatalf("expected the message back, got %v, %v", decoded, err)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		data string
+		from Codec
+		to   Codec
+		op   string
+	}{
+		{"invalid JSON", `{"n":`, JSON, MsgPack, "decode"},
+		{"trailing JSON", `{} {}`, JSON, MsgPack, "decode"},
+		{"protobuf without message type", `{}`, JSON, Protobuf, "encode"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Convert([]byte(test.data), test.from, test.to)
+			var codecErr *Error
+			if !errors.As(err, &codecErr) || codecErr.Op != test.op {
+				t.Fatalf("expected a %s error, got %v", test.op, err)
+			}
+		})
+	}
+}
+
+func TestConvertSameCodec(t *testing.T) {
+
+	data := []byte(`not even json`)
+	if result, err := Convert(data, JSON, JSON); err != nil || !bytes.Equal(result, data) {
+		t.Fatalf("expected the payload as it is, got %s, %v", result, err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+
+	typed := ProtobufOf(&structpb.Struct{})
+	tests := []struct {
+		name   string
+		accept string
+		prefer Codec
+		result Codec
+	}{
+		{"empty header", "", MsgPack, MsgPack},
+		{"exact match", "application/cbor", JSON, CBOR},
+		{"quality values", "application/json;q=0.5, application/msgpack", JSON, MsgPack},
+		{"same quality in order", "application/cbor, application/json", nil, CBOR},
+		{"any codec", "text/html, */*;q=0.1", CBOR, CBOR},
+		{"any application codec", "application/*", MsgPack, MsgPack},
+		{"unknown media types skipped", "text/html, application/json;q=0.2", nil, JSON},
+		{"excluded codec", "application/json;q=0", nil, nil},
+		{"no codec", "text/html", JSON, nil},
+		{"preferred codec of the media type", "application/x-protobuf", typed, typed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, ok := Negotiate(test.accept, test.prefer)
+			if result != test.result || ok != (test.result != nil) {
+				t.Fatalf("expected %v, got %v, %v", test.result, result, ok)
+			}
+		})
+	}
+}
+
+func TestForContentType(t *testing.T) {
+
+	typed := ProtobufOf(&structpb.Struct{})
+	tests := []struct {
+		name        string
+		contentType string
+		prefer      Codec
+		result      Codec
+	}{
+		{"preferred codec", "application/x-protobuf; proto=Struct", typed, typed},
+		{"registered codec", "application/msgpack", typed, MsgPack},
+		{"without preference", "application/x-protobuf", nil, Protobuf},
+		{"unknown", "text/plain", typed, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, ok := ForContentType(test.contentType, test.prefer)
+			if result != test.result || ok != (test.result != nil) {
+				t.Fatalf("expected %v, got %v, %v", test.result, result, ok)
+			}
+		})
+	}
+}
+
+func TestAccept(t *testing.T) {
+
+	tests := []struct {
+		codecs []Codec
+		accept string
+	}{
+		{[]Codec{Protobuf}, "application/x-protobuf"},
+		{[]Codec{Protobuf, JSON}, "application/x-protobuf, application/json;q=0.9"},
+		{[]Codec{JSON, JSON, CBOR}, "application/json, application/cbor;q=0.9"},
+	}
+	for _, test := range tests {
+		t.Run(test.accept, func(t *testing.T) {
+			if accept := Accept(test.codecs...); accept != test.accept {
+				t.Fatalf("expected %s, got %s", test.accept, accept)
+			}
+			// the header negotiates the first codec
+			if c, ok := Negotiate(test.accept, nil); !ok || c != test.codecs[0] {
+				t.Fatalf("expected %v negotiated, got %v", test.codecs[0], c)
+			}
+		})
+	}
+}
@@ -1,5 +1,20 @@
 module github.com/Abhishekghosh1998/faasflow-lib
 
-go 1.16
+go 1.18
 
-require github.com/Abhishekghosh1998/faasflow-sdk v0.0.0-20231016053548-11a1b7279001
+require (
+	github.com/Abhishekghosh1998/faasflow-sdk v0.0.0-20231016053548-11a1b7279001
+	github.com/fxamacker/cbor/v2 v2.5.0
+	github.com/itchyny/gojq v0.12.13
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	google.golang.org/protobuf v1.33.0
+)
+
+require (
+	github.com/alexellis/hmac v0.0.0-20180624211220-5c52ab81c0de // indirect
+	github.com/itchyny/timefmt-go v0.1.5 // indirect
+	github.com/rs/xid v1.2.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+)
@@ -0,0 +1,53 @@
+package goflow
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/internal/bulkhead"
+)
+
+var (
+	// ERR_BULKHEAD_FULL denotes that a call timed out waiting in the bulkhead queue
+	ERR_BULKHEAD_FULL = bulkhead.ErrFull
+
+	// bulkheads is the process wide bulkhead registry shared by all operations
+	bulkheads = bulkhead.NewRegistry()
+)
+
+// BulkheadStats saturation metrics of the bulkhead of a workload
+type BulkheadStats = bulkhead.Stats
+
+// GetBulkheadStats returns the saturation metrics of all the bulkheads of the process
+func GetBulkheadStats() []BulkheadStats {
+
+	fmt.Println("lib/goflow/bulkhead.go::GetBulkheadStats start")
+	fmt.Println("lib/goflow/bulkhead.go::GetBulkheadStats end")
+	return bulkheads.Stats()
+}
+
+// registerBulkhead registers the bulkhead of the operation, it panics
+// if the workload already has a bulkhead with another limit
+func (operation *ServiceOperation) registerBulkhead() {
+
+	_, err := bulkheads.Get(operation.Id, operation.MaxInFlight)
+	if err != nil {
+		panic(fmt.Sprintf("Error at MaxInFlight, %v", err))
+	}
+}
+
+// withBulkhead executes call within the bulkhead of the operation
+func (operation *ServiceOperation) withBulkhead(call func() ([]byte, error)) ([]byte, error) {
+
+	fmt.Println("lib/goflow/bulkhead.go::withBulkhead start")
+	if operation.MaxInFlight <= 0 {
+		return call()
+	}
+
+	b, err := bulkheads.Get(operation.Id, operation.MaxInFlight)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("lib/goflow/bulkhead.go::withBulkhead end")
+	return b.Do(context.Background(), operation.QueueTimeout, call)
+}
@@ -2,6 +2,7 @@ package goflow
 
 import (
 	"fmt"
+	"time"
 )
 
 var (
@@ -20,6 +21,9 @@ type ServiceOperation struct {
 	Options map[string][]string // The option as a input to workload
 
 	FailureHandler FuncErrorHandler // The Failure handler of the operation
+
+	MaxInFlight  int           // The maximum concurrent executions of the workload, 0 is unlimited
+	QueueTimeout time.Duration // The maximum wait for an execution slot, negative waits forever
 }
 
 // createWorkload Create a function with execution name
@@ -30,6 +34,7 @@ func createWorkload(id string, mod Modifier) *ServiceOperation {
 	operation.Mod = mod
 	operation.Id = id
 	operation.Options = make(map[string][]string)
+	operation.QueueTimeout = -1
 	fmt.Printf("lib/goflow/operation.go::createWorkload end")
 	return operation
 }
@@ -54,6 +59,20 @@ func (operation *ServiceOperation) addFailureHandler(handler FuncErrorHandler) {
 	fmt.Printf("lib/goflow/operation.go::addFailureHandler end")
 }
 
+func (operation *ServiceOperation) addMaxInFlight(limit int) {
+
+	fmt.Printf("lib/goflow/operation.go::addMaxInFlight start")
+	operation.MaxInFlight = limit
+	fmt.Printf("lib/goflow/operation.go::addMaxInFlight end")
+}
+
+func (operation *ServiceOperation) addQueueTimeout(timeout time.Duration) {
+
+	fmt.Printf("lib/goflow/operation.go::addQueueTimeout start")
+	operation.QueueTimeout = timeout
+	fmt.Printf("lib/goflow/operation.go::addQueueTimeout end")
+}
+
 func (operation *ServiceOperation) GetOptions() map[string][]string {
 
 	fmt.Printf("lib/goflow/operation.go::GetOptions start")
@@ -84,7 +103,9 @@ func executeWorkload(operation *ServiceOperation, data []byte) ([]byte, error) {
 	var result []byte
 
 	options := operation.GetOptions()
-	result, err = operation.Mod(data, options)
+	result, err = operation.withBulkhead(func() ([]byte, error) {
+		return operation.Mod(data, options)
+	})
 
 	fmt.Printf("lib/goflow/operation.go::executeWorkload end")
 	return result, err
@@ -99,7 +120,7 @@ func (operation *ServiceOperation) Execute(data []byte, option map[string]interf
 	if operation.Mod != nil {
 		result, err = executeWorkload(operation, data)
 		if err != nil {
-			err = fmt.Errorf("function(%s), error: function execution failed, %v",
+			err = fmt.Errorf("function(%s), error: function execution failed, %w",
 				operation.Id, err)
 			if operation.FailureHandler != nil {
 				err = operation.FailureHandler(err)
@@ -123,6 +144,7 @@ func (operation *ServiceOperation) GetProperties() map[string][]string {
 	isFunction := "false"
 	isHttpRequest := "false"
 	hasFailureHandler := "false"
+	hasBulkhead := "false"
 
 	if operation.Mod != nil {
 		isFunction = "true"
@@ -130,11 +152,15 @@ func (operation *ServiceOperation) GetProperties() map[string][]string {
 	if operation.FailureHandler != nil {
 		hasFailureHandler = "true"
 	}
+	if operation.MaxInFlight > 0 {
+		hasBulkhead = "true"
+	}
 
 	result["isMod"] = []string{isMod}
 	result["isFunction"] = []string{isFunction}
 	result["isHttpRequest"] = []string{isHttpRequest}
 	result["hasFailureHandler"] = []string{hasFailureHandler}
+	result["hasBulkhead"] = []string{hasBulkhead}
 
 	fmt.Printf("lib/goflow/operation.go::GetProperties end")
 	return result
@@ -160,8 +186,17 @@ func (node *Node) Apply(id string, workload Modifier, opts ...Option) *Node {
 		if o.failureHandler != nil {
 			newWorkload.addFailureHandler(o.failureHandler)
 		}
+		if o.maxInFlight > 0 {
+			newWorkload.addMaxInFlight(o.maxInFlight)
+		}
+		if o.queueTimeout != nil {
+			newWorkload.addQueueTimeout(*o.queueTimeout)
+		}
 	}
 
+	if newWorkload.MaxInFlight > 0 {
+		newWorkload.registerBulkhead()
+	}
 	node.unode.AddOperation(newWorkload)
 	fmt.Printf("lib/goflow/operation.go::Apply end")
 	return node
@@ -0,0 +1,70 @@
+package goflow
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/internal/parallel"
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+const (
+	// parallelAcquire the vertex taking a slot before an item of a foreach branch
+	parallelAcquire = "parallel-acquire"
+	// parallelBody the vertex of the item dag of a foreach branch
+	parallelBody = "parallel-body"
+	// parallelRelease the vertex freeing the slot after an item of a foreach branch
+	parallelRelease = "parallel-release"
+
+	// DefaultParallelTimeout the default maximum wait of an item for a slot
+	DefaultParallelTimeout = parallel.DefaultTimeout
+)
+
+var (
+	// ERR_PARALLEL_TIMEOUT denotes that an item timed out waiting for a slot
+	ERR_PARALLEL_TIMEOUT = parallel.ErrTimeout
+)
+
+// BatchItem an item of a batch executed by a foreach branch with BatchSize
+type BatchItem = parallel.BatchItem
+
+// parallelDag wraps the item dag of a foreach vertex so that at most limit
+// items execute at once, the slots are counted in store. A failing item fails
+// the request, which frees the slots with the StateStore of the request
+func parallelDag(node *sdk.Node, limit int, store StateStore, timeout time.Duration, body *Dag) *Dag {
+
+	fmt.Println("lib/goflow/parallel.go::parallelDag start")
+	gate := parallel.Gate{Vertex: node.Id, Key: parallel.Key(node), Limit: limit, Timeout: timeout,
+		Limiter: parallel.NewLimiter(store)}
+	release := gate
+	release.Release = true
+
+	dag := NewDag()
+	dag.Node(parallelAcquire).AddOperation(&gate)
+	dag.SubDag(parallelBody, body)
+	dag.Node(parallelRelease).AddOperation(&release)
+	dag.Edge(parallelAcquire, parallelBody)
+	dag.Edge(parallelBody, parallelRelease)
+	fmt.Println("lib/goflow/parallel.go::parallelDag end")
+	return dag
+}
+
+// parallelForEach creates the slot count of the foreach vertex each time it
+// executes, before the items take a slot
+func parallelForEach(node *sdk.Node, store StateStore, foreach sdk.ForEach) sdk.ForEach {
+
+	return parallel.InitForEach(foreach, &parallel.Gate{Vertex: node.Id, Key: parallel.Key(node),
+		Limiter: parallel.NewLimiter(store)})
+}
+
+// DecodeBatch returns the items of a batch executed by a foreach branch with BatchSize
+func DecodeBatch(data []byte) ([]BatchItem, error) {
+
+	return parallel.DecodeBatch(data)
+}
+
+// batchForEach groups the items of foreach in batches of size
+func batchForEach(foreach sdk.ForEach, size int) sdk.ForEach {
+
+	return parallel.BatchForEach(foreach, size)
+}
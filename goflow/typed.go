@@ -0,0 +1,42 @@
+package goflow
+
+import (
+	"fmt"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/codec"
+)
+
+// ApplyJSON adds a typed workload to the given vertex, its input is
+// decoded from JSON into an In and its output encoded to JSON
+func ApplyJSON[In, Out any](node *Node, id string, workload func(In, map[string][]string) (Out, error), opts ...Option) *Node {
+
+	return ApplyTyped(node, id, codec.JSON, workload, opts...)
+}
+
+// ApplyTyped adds a typed workload to the given vertex, its input is decoded into an In
+// and its output encoded with the codec. An input or output the codec fails on fails
+// the workload with a *codec.Error naming the vertex and the workload
+func ApplyTyped[In, Out any](node *Node, id string, c codec.Codec, workload func(In, map[string][]string) (Out, error), opts ...Option) *Node {
+
+	fmt.Printf("lib/goflow/typed.go::ApplyTyped start")
+	if c == nil {
+		panic(fmt.Sprintf("Error at ApplyTyped for %s, codec not specified", id))
+	}
+	if workload == nil {
+		panic(fmt.Sprintf("Error at ApplyTyped for %s, workload not specified", id))
+	}
+	vertex := node.unode.Id
+	node.Apply(id, func(data []byte, options map[string][]string) ([]byte, error) {
+		input, err := codec.DecodeInput[In](c, vertex, id, data)
+		if err != nil {
+			return nil, err
+		}
+		output, err := workload(input, options)
+		if err != nil {
+			return nil, err
+		}
+		return codec.EncodeOutput(c, vertex, id, output)
+	}, opts...)
+	fmt.Printf("lib/goflow/typed.go::ApplyTyped end")
+	return node
+}
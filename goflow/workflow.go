@@ -2,6 +2,7 @@ package goflow
 
 import (
 	"fmt"
+	"time"
 
 	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
 )
@@ -14,13 +15,19 @@ type DataStore sdk.DataStore
 type Options struct {
 	option         map[string][]string
 	failureHandler FuncErrorHandler
+	maxInFlight    int
+	queueTimeout   *time.Duration
 }
 
 // BranchOptions options for branching in DAG
 type BranchOptions struct {
-	aggregator  sdk.Aggregator
-	forwarder   sdk.Forwarder
-	noForwarder bool
+	aggregator      sdk.Aggregator
+	forwarder       sdk.Forwarder
+	noForwarder     bool
+	maxParallel     int
+	parallelStore   StateStore
+	parallelTimeout *time.Duration
+	batchSize       int
 }
 
 type Workflow struct {
@@ -50,6 +57,8 @@ func (o *Options) reset() {
 	fmt.Println("lib/goflow/workflow.go::Options::reset start")
 	o.option = map[string][]string{}
 	o.failureHandler = nil
+	o.maxInFlight = 0
+	o.queueTimeout = nil
 	fmt.Println("lib/goflow/workflow.go::Options::reset end")
 }
 
@@ -60,6 +69,10 @@ func (o *BranchOptions) reset() {
 	o.aggregator = nil
 	o.noForwarder = false
 	o.forwarder = nil
+	o.maxParallel = 0
+	o.parallelStore = nil
+	o.parallelTimeout = nil
+	o.batchSize = 0
 	fmt.Println("lib/goflow/workflow.go::BranchOptions::reset end")
 }
 
@@ -95,6 +108,61 @@ func Forwarder(forwarder sdk.Forwarder) BranchOption {
 	}
 }
 
+// MaxParallel limits the items of a foreach branch executing at once, the
+// other items wait for a slot. With BatchSize it limits the batches. The slots
+// are counted in store, which must be the StateStore of the request, so that
+// the items executing on every replica share them. An item waits for a slot
+// for at most ParallelTimeout, a failing item frees its slot. The waiting items
+// poll for a slot, they aren't queued: the items beyond the limit must get one
+// within ParallelTimeout, raise it for a large fan-out behind a small limit
+func MaxParallel(limit int, store StateStore) BranchOption {
+
+	fmt.Println("lib/goflow/workflow.go::MaxParallel start")
+	if limit <= 0 {
+		panic(fmt.Sprintf("Error at MaxParallel, invalid limit %d", limit))
+	}
+	if store == nil {
+		panic("Error at MaxParallel, StateStore not specified")
+	}
+	fmt.Println("lib/goflow/workflow.go::MaxParallel end")
+	return func(o *BranchOptions) {
+		o.maxParallel = limit
+		o.parallelStore = store
+	}
+}
+
+// ParallelTimeout sets the maximum wait of an item of a foreach branch with
+// MaxParallel for a slot, DefaultParallelTimeout by default. An item that
+// times out fails with ERR_PARALLEL_TIMEOUT. With n items of duration d and a
+// limit of l, the last items wait about (n/l - 1) * d
+func ParallelTimeout(timeout time.Duration) BranchOption {
+
+	fmt.Println("lib/goflow/workflow.go::ParallelTimeout start")
+	if timeout < 0 {
+		panic(fmt.Sprintf("Error at ParallelTimeout, invalid timeout %v", timeout))
+	}
+	fmt.Println("lib/goflow/workflow.go::ParallelTimeout end")
+	return func(o *BranchOptions) {
+		o.parallelTimeout = &timeout
+	}
+}
+
+// BatchSize groups the items of a foreach branch in batches of size items in the
+// order of their keys, each batch executes the sub-dag once with a JSON list of
+// BatchItem as input (see DecodeBatch). The aggregator receives the output of each
+// batch, the batch keys sort in the order of the items
+func BatchSize(size int) BranchOption {
+
+	fmt.Println("lib/goflow/workflow.go::BatchSize start")
+	if size <= 0 {
+		panic(fmt.Sprintf("Error at BatchSize, invalid size %d", size))
+	}
+	fmt.Println("lib/goflow/workflow.go::BatchSize end")
+	return func(o *BranchOptions) {
+		o.batchSize = size
+	}
+}
+
 // WorkloadOption Specify a option parameter in a workload
 func WorkloadOption(key string, value ...string) Option {
 
@@ -119,6 +187,32 @@ func OnFailure(handler FuncErrorHandler) Option {
 	}
 }
 
+// MaxInFlight caps the concurrent executions of the same workload within
+// the process to limit, executions beyond the limit are queued for a free slot.
+// The operations of the same workload must give it the same limit
+func MaxInFlight(limit int) Option {
+
+	fmt.Println("lib/goflow/workflow.go::MaxInFlight start")
+	if limit <= 0 {
+		panic(fmt.Sprintf("Error at MaxInFlight, invalid limit %d", limit))
+	}
+	fmt.Println("lib/goflow/workflow.go::MaxInFlight end")
+	return func(o *Options) {
+		o.maxInFlight = limit
+	}
+}
+
+// QueueTimeout specify the maximum time an execution waits for a MaxInFlight slot,
+// beyond which it fails with ERR_BULKHEAD_FULL. By default it waits forever
+func QueueTimeout(timeout time.Duration) Option {
+
+	fmt.Println("lib/goflow/workflow.go::QueueTimeout start")
+	fmt.Println("lib/goflow/workflow.go::QueueTimeout end")
+	return func(o *Options) {
+		o.queueTimeout = &timeout
+	}
+}
+
 // GetWorkflow initiates a flow with a pipeline
 func GetWorkflow(pipeline *sdk.Pipeline) *Workflow {
 
@@ -264,8 +358,12 @@ func (currentDag *Dag) ForEachBranch(vertex string, foreach sdk.ForEach, options
 	if foreach == nil {
 		panic(fmt.Sprintf("Error at AddForEachBranch for %s, foreach function not specified", vertex))
 	}
-	node.AddForEach(foreach)
 
+	maxParallel := 0
+	var parallelStore StateStore
+	parallelTimeout := DefaultParallelTimeout
+	batchSize := 0
+	noForwarder := false
 	for _, option := range options {
 		o := &BranchOptions{}
 		o.reset()
@@ -274,12 +372,36 @@ func (currentDag *Dag) ForEachBranch(vertex string, foreach sdk.ForEach, options
 			node.AddSubAggregator(o.aggregator)
 		}
 		if o.noForwarder == true {
-			node.AddForwarder("dynamic", nil)
+			noForwarder = true
+		}
+		if o.maxParallel != 0 {
+			maxParallel = o.maxParallel
+			parallelStore = o.parallelStore
+		}
+		if o.parallelTimeout != nil {
+			parallelTimeout = *o.parallelTimeout
 		}
+		if o.batchSize != 0 {
+			batchSize = o.batchSize
+		}
+	}
+	if batchSize > 0 {
+		foreach = batchForEach(foreach, batchSize)
+	}
+	if maxParallel > 0 {
+		foreach = parallelForEach(node, parallelStore, foreach)
+	}
+	node.AddForEach(foreach)
+	if noForwarder {
+		node.AddForwarder("dynamic", nil)
 	}
 
 	dag = NewDag()
-	err := node.AddForEachDag(dag.udag)
+	branch := dag
+	if maxParallel > 0 {
+		branch = parallelDag(node, maxParallel, parallelStore, parallelTimeout, dag)
+	}
+	err := node.AddForEachDag(branch.udag)
 	if err != nil {
 		panic(fmt.Sprintf("Error at AddForEachBranch for %s, %v", vertex, err))
 	}
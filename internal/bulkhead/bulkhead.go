@@ -0,0 +1,158 @@
+// Package bulkhead caps the concurrent calls to a target with queueing and
+// queue timeout, it is shared by the bulkheads of the openfaas and goflow packages
+package bulkhead
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrFull denotes that a call timed out waiting in the bulkhead queue
+	ErrFull = fmt.Errorf("bulkhead queue timeout")
+)
+
+// Stats saturation metrics of the bulkhead of a target
+type Stats struct {
+	Target    string // The function, url or workload the bulkhead belongs to
+	Limit     int    // Maximum concurrent calls
+	InFlight  int64  // Calls in progress
+	Queued    int64  // Calls waiting for a slot
+	Saturated int64  // Calls that had to wait for a slot
+	TimedOut  int64  // Calls that timed out waiting for a slot
+	Completed int64  // Calls completed
+}
+
+// Bulkhead caps the concurrent calls to a target
+type Bulkhead struct {
+	target string
+	slots  chan struct{}
+
+	inFlight  int64
+	queued    int64
+	saturated int64
+	timedOut  int64
+	completed int64
+}
+
+// Registry registry of bulkheads by target
+type Registry struct {
+	mu        sync.Mutex
+	bulkheads map[string]*Bulkhead
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+
+	return &Registry{bulkheads: make(map[string]*Bulkhead)}
+}
+
+// Get returns the bulkhead of a target, it fails if the
+// target was registered with another limit
+func (registry *Registry) Get(target string, limit int) (*Bulkhead, error) {
+
+	fmt.Println("lib/internal/bulkhead/bulkhead.go::Registry::Get start")
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	b, ok := registry.bulkheads[target]
+	if !ok {
+		b = &Bulkhead{target: target, slots: make(chan struct{}, limit)}
+		registry.bulkheads[target] = b
+	}
+	if cap(b.slots) != limit {
+		return nil, fmt.Errorf("%s has a MaxInFlight of %d, conflicting with %d", target, cap(b.slots), limit)
+	}
+	fmt.Println("lib/internal/bulkhead/bulkhead.go::Registry::Get end")
+	return b, nil
+}
+
+// Stats returns the saturation metrics of all the bulkheads of the registry, by target
+func (registry *Registry) Stats() []Stats {
+
+	fmt.Println("lib/internal/bulkhead/bulkhead.go::Registry::Stats start")
+	registry.mu.Lock()
+	result := make([]Stats, 0, len(registry.bulkheads))
+	for _, b := range registry.bulkheads {
+		result = append(result, b.stats())
+	}
+	registry.mu.Unlock()
+	sort.Slice(result, func(i, j int) bool { return result[i].Target < result[j].Target })
+	fmt.Println("lib/internal/bulkhead/bulkhead.go::Registry::Stats end")
+	return result
+}
+
+// Acquire takes a slot, waiting for at most timeout (negative waits forever)
+// or until ctx is done
+func (b *Bulkhead) Acquire(ctx context.Context, timeout time.Duration) error {
+
+	fmt.Println("lib/internal/bulkhead/bulkhead.go::Bulkhead::Acquire start")
+	select {
+	case b.slots <- struct{}{}:
+		atomic.AddInt64(&b.inFlight, 1)
+		return nil
+	default:
+	}
+
+	atomic.AddInt64(&b.saturated, 1)
+	atomic.AddInt64(&b.queued, 1)
+	defer atomic.AddInt64(&b.queued, -1)
+
+	var expired <-chan time.Time
+	if timeout >= 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		atomic.AddInt64(&b.inFlight, 1)
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-expired:
+		atomic.AddInt64(&b.timedOut, 1)
+		return fmt.Errorf("%w for %s after %v, %d calls in flight",
+			ErrFull, b.target, timeout, cap(b.slots))
+	}
+	fmt.Println("lib/internal/bulkhead/bulkhead.go::Bulkhead::Acquire end")
+	return nil
+}
+
+// Release frees a slot
+func (b *Bulkhead) Release() {
+
+	fmt.Println("lib/internal/bulkhead/bulkhead.go::Bulkhead::Release start")
+	atomic.AddInt64(&b.inFlight, -1)
+	atomic.AddInt64(&b.completed, 1)
+	<-b.slots
+	fmt.Println("lib/internal/bulkhead/bulkhead.go::Bulkhead::Release end")
+}
+
+// Do executes call within the bulkhead
+func (b *Bulkhead) Do(ctx context.Context, timeout time.Duration, call func() ([]byte, error)) ([]byte, error) {
+
+	err := b.Acquire(ctx, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Release()
+	return call()
+}
+
+// stats returns the saturation metrics of the bulkhead
+func (b *Bulkhead) stats() Stats {
+
+	return Stats{
+		Target:    b.target,
+		Limit:     cap(b.slots),
+		InFlight:  atomic.LoadInt64(&b.inFlight),
+		Queued:    atomic.LoadInt64(&b.queued),
+		Saturated: atomic.LoadInt64(&b.saturated),
+		TimedOut:  atomic.LoadInt64(&b.timedOut),
+		Completed: atomic.LoadInt64(&b.completed),
+	}
+}
@@ -0,0 +1,118 @@
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistryGet(t *testing.T) {
+
+	registry := NewRegistry()
+	first, err := registry.Get("function:f", 2)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	same, err := registry.Get("function:f", 2)
+	if err != nil || same != first {
+		t.Fatalf("expected the registered bulkhead, got %v", err)
+	}
+	_, err = registry.Get("function:f", 3)
+	if err == nil {
+		t.Fatalf("expected a conflicting limit to fail")
+	}
+	other, err := registry.Get("function:g", 3)
+	if err != nil || other == first {
+		t.Fatalf("expected a bulkhead per target, got %v", err)
+	}
+}
+
+func TestBulkheadCapsConcurrentCalls(t *testing.T) {
+
+	b, _ := NewRegistry().Get("target", 3)
+	var inFlight, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := b.Do(context.Background(), -1, func() ([]byte, error) {
+				current := atomic.AddInt32(&inFlight, 1)
+				for {
+					max := atomic.LoadInt32(&peak)
+					if current <= max || atomic.CompareAndSwapInt32(&peak, max, current) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&inFlight, -1)
+				return nil, nil
+			})
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak > 3 {
+		t.Fatalf("expected at most 3 calls in flight, got %d", peak)
+	}
+	stats := b.stats()
+	if stats.Completed != 20 || stats.InFlight != 0 || stats.Queued != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestBulkheadAcquire(t *testing.T) {
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		timeout  time.Duration
+		expected error
+	}{
+		{"queue timeout", context.Background(), 10 * time.Millisecond, ErrFull},
+		{"no wait", context.Background(), 0, ErrFull},
+		{"context done", cancelled, -1, context.Canceled},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, _ := NewRegistry().Get("target", 1)
+			if err := b.Acquire(context.Background(), -1); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			err := b.Acquire(test.ctx, test.timeout)
+			if !errors.Is(err, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, err)
+			}
+			b.Release()
+			if err := b.Acquire(context.Background(), 0); err != nil {
+				t.Fatalf("expected the released slot, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRegistryStats(t *testing.T) {
+
+	registry := NewRegistry()
+	registry.Get("b", 1)
+	a, _ := registry.Get("a", 2)
+	a.Acquire(context.Background(), -1)
+	a.Acquire(context.Background(), -1)
+	a.Acquire(context.Background(), 0)
+
+	stats := registry.Stats()
+	if len(stats) != 2 || stats[0].Target != "a" || stats[1].Target != "b" {
+		t.Fatalf("expected the stats by target, got %+v", stats)
+	}
+	expected := Stats{Target: "a", Limit: 2, InFlight: 2, Saturated: 1, TimedOut: 1}
+	if stats[0] != expected {
+		t.Fatalf("expected %+v, got %+v", expected, stats[0])
+	}
+}
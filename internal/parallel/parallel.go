@@ -0,0 +1,293 @@
+// Package parallel limits the items of a foreach branch executing at once and
+// groups the items in batches, it is shared by the openfaas and goflow packages
+package parallel
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+const (
+	// DefaultTimeout the default maximum wait of an item for a slot
+	DefaultTimeout = time.Minute
+	// pollInterval the interval between two attempts to take a slot
+	pollInterval = 100 * time.Millisecond
+	// updateRetries the attempts to free a slot of a count updated concurrently
+	updateRetries = 10
+)
+
+var (
+	// ErrTimeout denotes that an item timed out waiting for a slot
+	ErrTimeout = fmt.Errorf("parallel slot wait timeout")
+)
+
+// Store the part of the StateStore of the request the slots are kept in
+type Store interface {
+	// Set a value (override existing, or create one)
+	Set(key string, value string) error
+	// Get a value
+	Get(key string) (string, error)
+	// Compare and Update a value
+	Update(key string, oldValue string, newValue string) error
+}
+
+// Limiter counts the slots taken in the StateStore of the request, so that the
+// items executing on other replicas share the slots
+type Limiter struct {
+	store Store
+	poll  time.Duration
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// Gate takes or frees a slot for an item of a foreach branch
+type Gate struct {
+	Vertex  string        // The foreach vertex
+	Key     string        // The key of the slots of the foreach vertex
+	Limit   int           // The maximum items executing at once
+	Timeout time.Duration // The maximum wait for a slot
+	Release bool          // Frees the slot instead of taking it
+	Limiter *Limiter      // The limiter keeping the slots
+}
+
+// BatchItem an item of a batch executed by a foreach branch with BatchSize
+type BatchItem struct {
+	Key   string          `json:"key"`             // The foreach key of the item
+	Data  json.RawMessage `json:"data,omitempty"`  // The item, if JSON
+	Bytes []byte          `json:"bytes,omitempty"` // The item, if not JSON
+}
+
+// NewLimiter creates a limiter keeping the slots in store
+func NewLimiter(store Store) *Limiter {
+
+	return &Limiter{store: store, poll: pollInterval, now: time.Now, sleep: time.Sleep}
+}
+
+// Init creates the count of the slots of key, unless an execution of the foreach
+// vertex within the same request created it already. The count is created once
+// the foreach vertex executes, before its items take a slot, as the StateStore
+// can't create a value atomically
+func (limiter *Limiter) Init(key string) error {
+
+	fmt.Println("lib/internal/parallel/parallel.go::Limiter::Init start")
+	encoded, err := limiter.store.Get(key)
+	if err == nil && encoded != "" {
+		return nil
+	}
+	err = limiter.store.Set(key, "0")
+	if err != nil {
+		return fmt.Errorf("failed to create the slot count of %s, %v", key, err)
+	}
+	fmt.Println("lib/internal/parallel/parallel.go::Limiter::Init end")
+	return nil
+}
+
+// Acquire takes one of the limit slots of key, waiting for at most timeout. The
+// item polls the count every pollInterval, the items aren't queued: with n items
+// of duration d behind limit slots, the last one waits about (n/limit - 1) * d,
+// which must stay within timeout
+func (limiter *Limiter) Acquire(key string, limit int, timeout time.Duration) error {
+
+	fmt.Println("lib/internal/parallel/parallel.go::Limiter::Acquire start")
+	deadline := limiter.now().Add(timeout)
+	for {
+		encoded, err := limiter.store.Get(key)
+		if err != nil {
+			return fmt.Errorf("no slot count for %s, %v", key, err)
+		}
+		taken, err := strconv.Atoi(encoded)
+		if err != nil {
+			return fmt.Errorf("invalid slot count %q of %s, %v", encoded, key, err)
+		}
+		if taken < limit {
+			if limiter.store.Update(key, encoded, strconv.Itoa(taken+1)) == nil {
+				fmt.Println("lib/internal/parallel/parallel.go::Limiter::Acquire end")
+				return nil
+			}
+			// taken concurrently, try again at once
+			continue
+		}
+		if !limiter.now().Before(deadline) {
+			return fmt.Errorf("%w for %s after %v, %d items executing", ErrTimeout, key, timeout, limit)
+		}
+		wait := limiter.poll
+		if remaining := deadline.Sub(limiter.now()); remaining < wait {
+			wait = remaining
+		}
+		limiter.sleep(wait)
+	}
+}
+
+// Release frees a slot of key
+func (limiter *Limiter) Release(key string) error {
+
+	fmt.Println("lib/internal/parallel/parallel.go::Limiter::Release start")
+	var serr error
+	for i := 0; i < updateRetries; i++ {
+		encoded, err := limiter.store.Get(key)
+		if err != nil {
+			return fmt.Errorf("no slot held for %s, %v", key, err)
+		}
+		taken, err := strconv.Atoi(encoded)
+		if err != nil {
+			return fmt.Errorf("invalid slot count %q of %s, %v", encoded, key, err)
+		}
+		if taken <= 0 {
+			return fmt.Errorf("no slot held for %s", key)
+		}
+		serr = limiter.store.Update(key, encoded, strconv.Itoa(taken-1))
+		if serr == nil {
+			fmt.Println("lib/internal/parallel/parallel.go::Limiter::Release end")
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to release slot of %s, %v", key, serr)
+}
+
+// Key returns the key of the slots of a foreach vertex, the slots are shared
+// by the items of every execution of the vertex within a request
+func Key(node *sdk.Node) string {
+
+	return "parallel-" + node.GetUniqueId()
+}
+
+func (gate *Gate) GetId() string {
+
+	if gate.Release {
+		return "parallel-release"
+	}
+	return "parallel-acquire"
+}
+
+func (gate *Gate) Encode() []byte {
+
+	return []byte("")
+}
+
+func (gate *Gate) GetProperties() map[string][]string {
+
+	fmt.Println("lib/internal/parallel/parallel.go::Gate::GetProperties start")
+	result := make(map[string][]string)
+	result["isMod"] = []string{"true"}
+	result["isFunction"] = []string{"false"}
+	result["isHttpRequest"] = []string{"false"}
+	result["maxParallel"] = []string{strconv.Itoa(gate.Limit)}
+	fmt.Println("lib/internal/parallel/parallel.go::Gate::GetProperties end")
+	return result
+}
+
+// Execute takes or frees a slot of the foreach vertex of the gate
+func (gate *Gate) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+
+	fmt.Println("lib/internal/parallel/parallel.go::Gate::Execute start")
+	if gate.Release {
+		err := gate.Limiter.Release(gate.Key)
+		if err != nil {
+			return nil, fmt.Errorf("ForEachBranch(%s), error: failed to release slot, %w", gate.Vertex, err)
+		}
+		return data, nil
+	}
+	err := gate.Limiter.Acquire(gate.Key, gate.Limit, gate.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("ForEachBranch(%s), error: failed to acquire slot, %w", gate.Vertex, err)
+	}
+	fmt.Println("lib/internal/parallel/parallel.go::Gate::Execute end")
+	return data, nil
+}
+
+// InitForEach creates the slot count of the foreach vertex of gate each time the
+// vertex executes, before its items are dispatched
+func InitForEach(foreach sdk.ForEach, gate *Gate) sdk.ForEach {
+
+	return func(data []byte) map[string][]byte {
+
+		fmt.Println("lib/internal/parallel/parallel.go::InitForEach start")
+		err := gate.Limiter.Init(gate.Key)
+		if err != nil {
+			panic(fmt.Sprintf("ForEachBranch(%s), error: %v", gate.Vertex, err))
+		}
+		fmt.Println("lib/internal/parallel/parallel.go::InitForEach end")
+		return foreach(data)
+	}
+}
+
+// DecodeBatch returns the items of a batch executed by a foreach branch with BatchSize
+func DecodeBatch(data []byte) ([]BatchItem, error) {
+
+	fmt.Println("lib/internal/parallel/parallel.go::DecodeBatch start")
+	var batch []BatchItem
+	err := json.Unmarshal(data, &batch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode batch, %v", err)
+	}
+	fmt.Println("lib/internal/parallel/parallel.go::DecodeBatch end")
+	return batch, nil
+}
+
+// Payload returns the item
+func (item *BatchItem) Payload() []byte {
+
+	if item.Bytes != nil {
+		return item.Bytes
+	}
+	return []byte(item.Data)
+}
+
+// itemLess orders the foreach keys, numeric keys are ordered by value
+func itemLess(a string, b string) bool {
+
+	na, aerr := strconv.Atoi(a)
+	nb, berr := strconv.Atoi(b)
+	if aerr == nil && berr == nil {
+		return na < nb
+	}
+	return a < b
+}
+
+// BatchForEach groups the items of foreach in batches of size, in the order
+// of their keys. The batch keys keep the order of the batches when sorted
+func BatchForEach(foreach sdk.ForEach, size int) sdk.ForEach {
+
+	return func(data []byte) map[string][]byte {
+
+		fmt.Println("lib/internal/parallel/parallel.go::BatchForEach start")
+		items := foreach(data)
+		keys := make([]string, 0, len(items))
+		for key := range items {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return itemLess(keys[i], keys[j]) })
+
+		count := (len(keys) + size - 1) / size
+		width := len(strconv.Itoa(count - 1))
+		batches := make(map[string][]byte, count)
+		for index := 0; index < count; index++ {
+			end := (index + 1) * size
+			if end > len(keys) {
+				end = len(keys)
+			}
+			batch := []BatchItem{}
+			for _, key := range keys[index*size : end] {
+				item := BatchItem{Key: key}
+				if json.Valid(items[key]) {
+					item.Data = items[key]
+				} else {
+					item.Bytes = items[key]
+				}
+				batch = append(batch, item)
+			}
+			encoded, err := json.Marshal(batch)
+			if err != nil {
+				panic(fmt.Sprintf("failed to encode batch %d, %v", index, err))
+			}
+			batches[fmt.Sprintf("batch-%0*d", width, index)] = encoded
+		}
+		fmt.Println("lib/internal/parallel/parallel.go::BatchForEach end")
+		return batches
+	}
+}
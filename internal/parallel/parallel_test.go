@@ -0,0 +1,389 @@
+package parallel
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memoryStore in memory Store, a missing key fails as in the stores of the executor
+type memoryStore struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func newMemoryStore() *memoryStore {
+
+	return &memoryStore{values: make(map[string]string)}
+}
+
+func (store *memoryStore) Set(key string, value string) error {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.values[key] = value
+	return nil
+}
+
+func (store *memoryStore) Get(key string) (string, error) {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	value, ok := store.values[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found", key)
+	}
+	return value, nil
+}
+
+func (store *memoryStore) Update(key string, oldValue string, newValue string) error {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.values[key] != oldValue {
+		return fmt.Errorf("key %s was updated", key)
+	}
+	store.values[key] = newValue
+	return nil
+}
+
+// fakeClock a clock advanced by the sleeps of the limiter
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	slept time.Duration
+}
+
+func (clock *fakeClock) Now() time.Time {
+
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+func (clock *fakeClock) Sleep(d time.Duration) {
+
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	clock.now = clock.now.Add(d)
+	clock.slept += d
+}
+
+func newFakeLimiter(store Store) (*Limiter, *fakeClock) {
+
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	limiter := NewLimiter(store)
+	limiter.now = clock.Now
+	limiter.sleep = clock.Sleep
+	return limiter, clock
+}
+
+func TestLimiterAcquire(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		limit   int
+		taken   int
+		timeout time.Duration
+		err     bool
+		slept   time.Duration
+	}{
+		{"first slot", 2, 0, time.Second, false, 0},
+		{"missing count", 2, -1, time.Second, true, 0},
+		{"free slot", 2, 1, time.Second, false, 0},
+		{"no free slot", 2, 2, time.Second, true, time.Second},
+		{"no free slot without wait", 1, 1, 0, true, 0},
+		{"wait shorter than the poll interval", 1, 1, 30 * time.Millisecond, true, 30 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newMemoryStore()
+			limiter, clock := newFakeLimiter(store)
+			if test.taken >= 0 {
+				store.Set("key", fmt.Sprint(test.taken))
+			}
+			err := limiter.Acquire("key", test.limit, test.timeout)
+			if (err != nil) != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if test.taken < 0 {
+				if err == nil || !strings.Contains(err.Error(), "no slot count for key") {
+					t.Fatalf("expected a missing count, got %v", err)
+				}
+				if _, err := store.Get("key"); err == nil {
+					t.Fatalf("expected the count not created by an item")
+				}
+				return
+			}
+			if err != nil && !errors.Is(err, ErrTimeout) {
+				t.Fatalf("expected ErrTimeout, got %v", err)
+			}
+			if clock.slept != test.slept {
+				t.Fatalf("expected a wait of %v, waited %v", test.slept, clock.slept)
+			}
+			expected := fmt.Sprint(test.taken + 1)
+			if test.err {
+				expected = fmt.Sprint(test.taken)
+			}
+			if value, _ := store.Get("key"); value != expected {
+				t.Fatalf("expected %s slots taken, got %s", expected, value)
+			}
+		})
+	}
+}
+
+func TestLimiterAcquireAfterRelease(t *testing.T) {
+
+	store := newMemoryStore()
+	store.Set("key", "0")
+	limiter, clock := newFakeLimiter(store)
+	if err := limiter.Acquire("key", 1, 0); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// a replica frees the slot while the item waits
+	limiter.sleep = func(d time.Duration) {
+		clock.Sleep(d)
+		if clock.slept >= 300*time.Millisecond {
+			if err := NewLimiter(store).Release("key"); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		}
+	}
+	if err := limiter.Acquire("key", 1, time.Second); err != nil {
+		t.Fatalf("expected the freed slot, got %v", err)
+	}
+	if clock.slept != 300*time.Millisecond {
+		t.Fatalf("expected a wait of 300ms, waited %v", clock.slept)
+	}
+}
+
+func TestLimiterRelease(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		value string
+		left  string
+		err   bool
+	}{
+		{"held slot", "2", "1", false},
+		{"last slot", "1", "0", false},
+		{"no slot held", "0", "0", true},
+		{"missing count", "", "", true},
+		{"invalid count", "x", "x", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newMemoryStore()
+			if test.value != "" {
+				store.Set("key", test.value)
+			}
+			err := NewLimiter(store).Release("key")
+			if (err != nil) != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if value, _ := store.Get("key"); value != test.left {
+				t.Fatalf("expected %q slots taken, got %q", test.left, value)
+			}
+		})
+	}
+}
+
+func TestLimiterCapsConcurrentItems(t *testing.T) {
+
+	store := newMemoryStore()
+	store.Set("key", "0")
+	var inFlight, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every item uses its own limiter, as on separate replicas
+			limiter := NewLimiter(store)
+			limiter.poll = time.Millisecond
+			if err := limiter.Acquire("key", 3, 10*time.Second); err != nil {
+				t.Errorf("unexpected error %v", err)
+				return
+			}
+			current := atomic.AddInt32(&inFlight, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if current <= old || atomic.CompareAndSwapInt32(&peak, old, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			if err := limiter.Release("key"); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak > 3 {
+		t.Fatalf("expected at most 3 items at once, got %d", peak)
+	}
+	if value, _ := store.Get("key"); value != "0" {
+		t.Fatalf("expected every slot freed, %s taken", value)
+	}
+}
+
+func TestInitForEach(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		value string
+		count string
+	}{
+		{"first execution", "", "0"},
+		{"slots held by another execution", "2", "2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newMemoryStore()
+			if test.value != "" {
+				store.Set("key", test.value)
+			}
+			gate := &Gate{Vertex: "items", Key: "key", Limiter: NewLimiter(store)}
+			foreach := InitForEach(func(data []byte) map[string][]byte {
+				return map[string][]byte{"0": data}
+			}, gate)
+			if items := foreach([]byte("a")); string(items["0"]) != "a" {
+				t.Fatalf("expected the items of the foreach function, got %v", items)
+			}
+			if value, _ := store.Get("key"); value != test.count {
+				t.Fatalf("expected %s slots taken, got %s", test.count, value)
+			}
+		})
+	}
+}
+
+func TestInitForEachConcurrentItems(t *testing.T) {
+
+	// the items start together right after the foreach vertex
+	store := newMemoryStore()
+	gate := &Gate{Vertex: "items", Key: "key", Limiter: NewLimiter(store)}
+	items := InitForEach(func(data []byte) map[string][]byte {
+		return map[string][]byte{"0": data, "1": data, "2": data, "3": data}
+	}, gate)([]byte("a"))
+
+	var inFlight, peak int32
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for range items {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter := NewLimiter(store)
+			limiter.poll = time.Millisecond
+			<-start
+			if err := limiter.Acquire("key", 2, 10*time.Second); err != nil {
+				t.Errorf("unexpected error %v", err)
+				return
+			}
+			current := atomic.AddInt32(&inFlight, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if current <= old || atomic.CompareAndSwapInt32(&peak, old, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			if err := limiter.Release("key"); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	if peak > 2 {
+		t.Fatalf("expected at most 2 items at once, got %d", peak)
+	}
+	if value, _ := store.Get("key"); value != "0" {
+		t.Fatalf("expected every slot freed, %s taken", value)
+	}
+}
+
+func TestGateExecute(t *testing.T) {
+
+	store := newMemoryStore()
+	store.Set("key", "0")
+	limiter, _ := newFakeLimiter(store)
+	acquire := &Gate{Vertex: "items", Key: "key", Limit: 1, Timeout: time.Second, Limiter: limiter}
+	release := &Gate{Vertex: "items", Key: "key", Limit: 1, Release: true, Limiter: limiter}
+
+	result, err := acquire.Execute([]byte("item"), nil)
+	if err != nil || string(result) != "item" {
+		t.Fatalf("unexpected result %q, %v", result, err)
+	}
+	_, err = acquire.Execute([]byte("other"), nil)
+	if !errors.Is(err, ErrTimeout) || !strings.Contains(err.Error(), "ForEachBranch(items)") {
+		t.Fatalf("expected the second item to time out, got %v", err)
+	}
+	result, err = release.Execute([]byte("done"), nil)
+	if err != nil || string(result) != "done" {
+		t.Fatalf("unexpected result %q, %v", result, err)
+	}
+	if _, err = release.Execute([]byte("done"), nil); err == nil {
+		t.Fatalf("expected a release without slot to fail")
+	}
+}
+
+func TestBatchForEach(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		items   map[string][]byte
+		size    int
+		batches map[string]string
+	}{
+		{"numeric keys ordered by value", map[string][]byte{"10": []byte(`10`), "2": []byte(`2`), "1": []byte(`1`)}, 2,
+			map[string]string{
+				"batch-0": `[{"key":"1","data":1},{"key":"2","data":2}]`,
+				"batch-1": `[{"key":"10","data":10}]`,
+			}},
+		{"bytes items", map[string][]byte{"a": []byte("not json")}, 5,
+			map[string]string{"batch-0": `[{"key":"a","bytes":"bm90IGpzb24="}]`}},
+		{"batch keys padded", map[string][]byte{"a": nil, "b": nil, "c": nil, "d": nil, "e": nil, "f": nil,
+			"g": nil, "h": nil, "i": nil, "j": nil, "k": nil}, 1, nil},
+		{"no items", map[string][]byte{}, 2, map[string]string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			batches := BatchForEach(func([]byte) map[string][]byte { return test.items }, test.size)(nil)
+			if test.batches == nil {
+				if _, ok := batches["batch-00"]; !ok || len(batches) != len(test.items) {
+					t.Fatalf("expected padded batch keys, got %d batches", len(batches))
+				}
+				return
+			}
+			if len(batches) != len(test.batches) {
+				t.Fatalf("expected %d batches, got %d", len(test.batches), len(batches))
+			}
+			for key, expected := range test.batches {
+				if string(batches[key]) != expected {
+					t.Fatalf("batch %s is %s, expected %s", key, batches[key], expected)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeBatch(t *testing.T) {
+
+	batch, err := DecodeBatch([]byte(`[{"key":"1","data":{"a":1}},{"key":"2","bytes":"eHl6"}]`))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(batch) != 2 || string(batch[0].Payload()) != `{"a":1}` || string(batch[1].Payload()) != "xyz" {
+		t.Fatalf("unexpected batch %+v", batch)
+	}
+	if _, err := DecodeBatch([]byte("not a batch")); err == nil {
+		t.Fatalf("expected an invalid batch to fail")
+	}
+}
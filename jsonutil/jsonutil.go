@@ -0,0 +1,313 @@
+// Package jsonutil provides ready-made JSON modifiers, forwarders and aggregators
+// for the flows of the openfaas and goflow packages. Modifiers are plain
+// func([]byte) ([]byte, error) so they can be given to Modify and Apply, errors
+// point at the failing path of the payload with a PathError
+package jsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+// decodeJSON decodes a JSON value, keeping the numbers as they are
+func decodeJSON(data []byte) (interface{}, error) {
+
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after the value")
+	}
+	return doc, nil
+}
+
+// decode decodes a JSON payload for op
+func decode(op string, data []byte) (interface{}, error) {
+
+	doc, err := decodeJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s, payload is not valid JSON, %v", op, err)
+	}
+	return doc, nil
+}
+
+// encode encodes a decoded payload for op
+func encode(op string, doc interface{}) ([]byte, error) {
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s, failed to encode the result, %v", op, err)
+	}
+	return data, nil
+}
+
+// Pick returns a modifier keeping only the values at the given paths, at the same path.
+// The modifier fails if a path is not found
+func Pick(paths ...string) func([]byte) ([]byte, error) {
+
+	fmt.Println("lib/jsonutil/jsonutil.go::Pick start")
+	compiled := make([]*Path, len(paths))
+	for i, source := range paths {
+		compiled[i] = mustCompilePath("Pick", source)
+	}
+	fmt.Println("lib/jsonutil/jsonutil.go::Pick end")
+	return func(data []byte) ([]byte, error) {
+		doc, err := decode("Pick", data)
+		if err != nil {
+			return nil, err
+		}
+		var result interface{}
+		for _, path := range compiled {
+			value, err := path.Get("Pick", doc)
+			if err != nil {
+				return nil, err
+			}
+			result, err = path.Set("Pick", result, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if result == nil {
+			result = make(map[string]interface{})
+		}
+		return encode("Pick", result)
+	}
+}
+
+// Rename returns a modifier moving the value at path from to path to, creating the
+// missing objects along to. The modifier fails if from is not found
+func Rename(from, to string) func([]byte) ([]byte, error) {
+
+	fmt.Println("lib/jsonutil/jsonutil.go::Rename start")
+	fromPath := mustCompilePath("Rename", from)
+	toPath := mustCompilePath("Rename", to)
+	if fromPath.Root() || toPath.Root() {
+		panic(fmt.Sprintf("Error at Rename, `%s` to `%s` can't move the root", from, to))
+	}
+	fmt.Println("lib/jsonutil/jsonutil.go::Rename end")
+	return func(data []byte) ([]byte, error) {
+		doc, err := decode("Rename", data)
+		if err != nil {
+			return nil, err
+		}
+		value, err := fromPath.Get("Rename", doc)
+		if err != nil {
+			return nil, err
+		}
+		err = fromPath.Delete("Rename", doc)
+		if err != nil {
+			return nil, err
+		}
+		doc, err = toPath.Set("Rename", doc, value)
+		if err != nil {
+			return nil, err
+		}
+		return encode("Rename", doc)
+	}
+}
+
+// Merge returns a modifier deep merging the objects at the given paths into one object,
+// later paths winning on conflicts. The modifier fails if a path is not found or
+// doesn't select an object
+func Merge(paths ...string) func([]byte) ([]byte, error) {
+
+	fmt.Println("lib/jsonutil/jsonutil.go::Merge start")
+	compiled := make([]*Path, len(paths))
+	for i, source := range paths {
+		compiled[i] = mustCompilePath("Merge", source)
+	}
+	fmt.Println("lib/jsonutil/jsonutil.go::Merge end")
+	return func(data []byte) ([]byte, error) {
+		doc, err := decode("Merge", data)
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]interface{})
+		for _, path := range compiled {
+			value, err := path.Get("Merge", doc)
+			if err != nil {
+				return nil, err
+			}
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, &PathError{Op: "Merge", Path: path.String(), Err: "expected an object, found " + kindOf(value)}
+			}
+			result = deepMerge(result, object)
+		}
+		return encode("Merge", result)
+	}
+}
+
+// Wrap returns a modifier wrapping the payload in an envelope at path,
+// such as {"data": <payload>} for $.data
+func Wrap(path string) func([]byte) ([]byte, error) {
+
+	fmt.Println("lib/jsonutil/jsonutil.go::Wrap start")
+	compiled := mustCompilePath("Wrap", path)
+	fmt.Println("lib/jsonutil/jsonutil.go::Wrap end")
+	return func(data []byte) ([]byte, error) {
+		doc, err := decode("Wrap", data)
+		if err != nil {
+			return nil, err
+		}
+		result, err := compiled.Set("Wrap", nil, doc)
+		if err != nil {
+			return nil, err
+		}
+		return encode("Wrap", result)
+	}
+}
+
+// Unwrap returns a modifier replacing the payload with the value at path,
+// the inverse of Wrap. The modifier fails if path is not found
+func Unwrap(path string) func([]byte) ([]byte, error) {
+
+	fmt.Println("lib/jsonutil/jsonutil.go::Unwrap start")
+	compiled := mustCompilePath("Unwrap", path)
+	fmt.Println("lib/jsonutil/jsonutil.go::Unwrap end")
+	return func(data []byte) ([]byte, error) {
+		doc, err := decode("Unwrap", data)
+		if err != nil {
+			return nil, err
+		}
+		value, err := compiled.Get("Unwrap", doc)
+		if err != nil {
+			return nil, err
+		}
+		return encode("Unwrap", value)
+	}
+}
+
+// ForwardErrorHandler handles the error of the modifier of a forwarder, it
+// returns the data forwarded instead
+type ForwardErrorHandler func(data []byte, err error) []byte
+
+// Forward adapts a modifier as a forwarder. A forwarder can't fail, the data
+// forwarded when the modifier fails is returned by onError. The ForwardWith
+// edge option of the openfaas package forwards a failure instead
+func Forward(modifier func([]byte) ([]byte, error), onError ForwardErrorHandler) sdk.Forwarder {
+
+	fmt.Println("lib/jsonutil/jsonutil.go::Forward start")
+	if modifier == nil {
+		panic("Error at Forward, modifier not specified")
+	}
+	if onError == nil {
+		panic("Error at Forward, error handler not specified")
+	}
+	fmt.Println("lib/jsonutil/jsonutil.go::Forward end")
+	return func(data []byte) []byte {
+		result, err := modifier(data)
+		if err != nil {
+			return onError(data, err)
+		}
+		return result
+	}
+}
+
+// sortedInputs returns the vertex of the aggregated inputs in order
+func sortedInputs(inputs map[string][]byte) []string {
+
+	vertices := make([]string, 0, len(inputs))
+	for vertex := range inputs {
+		vertices = append(vertices, vertex)
+	}
+	sort.Strings(vertices)
+	return vertices
+}
+
+// decodeInput decodes the input of a vertex for op
+func decodeInput(op string, vertex string, data []byte) (interface{}, error) {
+
+	doc, err := decodeJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s, input of vertex `%s` is not valid JSON, %v", op, vertex, err)
+	}
+	return doc, nil
+}
+
+// MergeByVertex returns an aggregator building an object of the inputs keyed by their vertex,
+// such as {"vertex1": <input1>, "vertex2": <input2>}
+func MergeByVertex() sdk.Aggregator {
+
+	fmt.Println("lib/jsonutil/jsonutil.go::MergeByVertex start")
+	fmt.Println("lib/jsonutil/jsonutil.go::MergeByVertex end")
+	return func(inputs map[string][]byte) ([]byte, error) {
+		result := make(map[string]interface{})
+		for _, vertex := range sortedInputs(inputs) {
+			doc, err := decodeInput("MergeByVertex", vertex, inputs[vertex])
+			if err != nil {
+				return nil, err
+			}
+			result[vertex] = doc
+		}
+		return encode("MergeByVertex", result)
+	}
+}
+
+// ConcatArrays returns an aggregator concatenating the array inputs in the order of their vertex
+func ConcatArrays() sdk.Aggregator {
+
+	fmt.Println("lib/jsonutil/jsonutil.go::ConcatArrays start")
+	fmt.Println("lib/jsonutil/jsonutil.go::ConcatArrays end")
+	return func(inputs map[string][]byte) ([]byte, error) {
+		result := []interface{}{}
+		for _, vertex := range sortedInputs(inputs) {
+			doc, err := decodeInput("ConcatArrays", vertex, inputs[vertex])
+			if err != nil {
+				return nil, err
+			}
+			array, ok := doc.([]interface{})
+			if !ok {
+				return nil, &PathError{Op: "ConcatArrays", Vertex: vertex, Path: "$", Err: "expected an array, found " + kindOf(doc)}
+			}
+			result = append(result, array...)
+		}
+		return encode("ConcatArrays", result)
+	}
+}
+
+// DeepMerge returns an aggregator deep merging the object inputs in the order of their vertex.
+// Nested objects are merged, other values of later vertex replace the earlier ones
+func DeepMerge() sdk.Aggregator {
+
+	fmt.Println("lib/jsonutil/jsonutil.go::DeepMerge start")
+	fmt.Println("lib/jsonutil/jsonutil.go::DeepMerge end")
+	return func(inputs map[string][]byte) ([]byte, error) {
+		result := make(map[string]interface{})
+		for _, vertex := range sortedInputs(inputs) {
+			doc, err := decodeInput("DeepMerge", vertex, inputs[vertex])
+			if err != nil {
+				return nil, err
+			}
+			object, ok := doc.(map[string]interface{})
+			if !ok {
+				return nil, &PathError{Op: "DeepMerge", Vertex: vertex, Path: "$", Err: "expected an object, found " + kindOf(doc)}
+			}
+			result = deepMerge(result, object)
+		}
+		return encode("DeepMerge", result)
+	}
+}
+
+// deepMerge merges src into dst, nested objects are merged and other values replaced
+func deepMerge(dst, src map[string]interface{}) map[string]interface{} {
+
+	for key, value := range src {
+		srcObject, srcOk := value.(map[string]interface{})
+		dstObject, dstOk := dst[key].(map[string]interface{})
+		if srcOk && dstOk {
+			dst[key] = deepMerge(dstObject, srcObject)
+			continue
+		}
+		dst[key] = value
+	}
+	return dst
+}
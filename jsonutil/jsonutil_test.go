@@ -0,0 +1,150 @@
+package jsonutil
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestModifiers(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		modifier func([]byte) ([]byte, error)
+		data     string
+		result   string
+		err      string
+	}{
+		{"pick", Pick("$.a.b", "$.c"), `{"a":{"b":1,"x":2},"c":[3],"d":4}`, `{"a":{"b":1},"c":[3]}`, ""},
+		{"pick nothing", Pick(), `{"a":1}`, `{}`, ""},
+		{"pick missing", Pick("$.a.z"), `{"a":{}}`, "", "Pick, at `$.a.z`: not found"},
+		{"rename", Rename("$.a", "$.b.c"), `{"a":1,"d":2}`, `{"b":{"c":1},"d":2}`, ""},
+		{"rename missing", Rename("$.z", "$.b"), `{"a":1}`, "", "Rename, at `$.z`: not found"},
+		{"merge", Merge("$.a", "$.b"), `{"a":{"x":{"y":1},"z":1},"b":{"x":{"w":2},"z":2}}`,
+			`{"x":{"w":2,"y":1},"z":2}`, ""},
+		{"merge not an object", Merge("$.a"), `{"a":[1]}`, "", "Merge, at `$.a`: expected an object, found array"},
+		{"wrap", Wrap("$.data"), `[1,2]`, `{"data":[1,2]}`, ""},
+		{"unwrap", Unwrap("$.data[0]"), `{"data":[{"a":1}]}`, `{"a":1}`, ""},
+		{"large numbers kept", Unwrap("$.n"), `{"n":12345678901234567890}`, `12345678901234567890`, ""},
+		{"invalid payload", Unwrap("$.n"), `{"n":`, "", "Unwrap, payload is not valid JSON"},
+		{"trailing data", Unwrap("$.n"), `{"n":1} {}`, "", "unexpected data after the value"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := test.modifier([]byte(test.data))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil || string(result) != test.result {
+				t.Fatalf("expected %s, got %s, %v", test.result, result, err)
+			}
+		})
+	}
+}
+
+func TestModifiersRejectPaths(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		define func()
+		err    string
+	}{
+		{"invalid path", func() { Pick("a") }, "Error at Pick, invalid path `a`"},
+		{"rename the root", func() { Rename("$", "$.a") }, "Error at Rename, `$` to `$.a` can't move the root"},
+		{"forward without a modifier", func() { Forward(nil, nil) }, "Error at Forward, modifier not specified"},
+		{"forward without an error handler", func() { Forward(Pick(), nil) }, "Error at Forward, error handler"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), test.err) {
+					t.Fatalf("expected panic %q, got %v", test.err, r)
+				}
+			}()
+			test.define()
+		})
+	}
+}
+
+func TestForward(t *testing.T) {
+
+	var handled error
+	forwarder := Forward(Unwrap("$.data"), func(data []byte, err error) []byte {
+		handled = err
+		return []byte(`"failed"`)
+	})
+	if result := forwarder([]byte(`{"data":1}`)); string(result) != `1` || handled != nil {
+		t.Fatalf("expected the data unwrapped, got %s, %v", result, handled)
+	}
+	if result := forwarder([]byte(`{}`)); string(result) != `"failed"` {
+		t.Fatalf("expected the data of the error handler, got %s", result)
+	}
+	var pathErr *PathError
+	if !errors.As(handled, &pathErr) || pathErr.Path != "$.data" {
+		t.Fatalf("expected the error of the modifier, got %v", handled)
+	}
+}
+
+func TestAggregators(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		inputs map[string]string
+		result map[string]string // result by aggregator
+		err    map[string]string // error by aggregator
+	}{
+		{"objects", map[string]string{"b": `{"x":{"y":2},"z":2}`, "a": `{"x":{"w":1},"z":1}`},
+			map[string]string{
+				"MergeByVertex": `{"a":{"x":{"w":1},"z":1},"b":{"x":{"y":2},"z":2}}`,
+				"DeepMerge":     `{"x":{"w":1,"y":2},"z":2}`,
+			},
+			map[string]string{"ConcatArrays": "ConcatArrays, input of vertex `a` at `$`: expected an array, found object"}},
+		{"arrays", map[string]string{"b": `[3]`, "a": `[1,2]`},
+			map[string]string{"MergeByVertex": `{"a":[1,2],"b":[3]}`, "ConcatArrays": `[1,2,3]`},
+			map[string]string{"DeepMerge": "DeepMerge, input of vertex `a` at `$`: expected an object, found array"}},
+		{"invalid input", map[string]string{"a": `{`}, nil, map[string]string{
+			"MergeByVertex": "MergeByVertex, input of vertex `a` is not valid JSON",
+			"ConcatArrays":  "ConcatArrays, input of vertex `a` is not valid JSON",
+			"DeepMerge":     "DeepMerge, input of vertex `a` is not valid JSON",
+		}},
+	}
+	aggregators := map[string]func(map[string][]byte) ([]byte, error){
+		"MergeByVertex": MergeByVertex(), "ConcatArrays": ConcatArrays(), "DeepMerge": DeepMerge(),
+	}
+	for _, test := range tests {
+		inputs := make(map[string][]byte)
+		for vertex, data := range test.inputs {
+			inputs[vertex] = []byte(data)
+		}
+		for name, aggregator := range aggregators {
+			t.Run(test.name+" "+name, func(t *testing.T) {
+				result, err := aggregator(inputs)
+				if expected, ok := test.err[name]; ok {
+					if err == nil || !strings.Contains(err.Error(), expected) {
+						t.Fatalf("expected error %q, got %v", expected, err)
+					}
+					return
+				}
+				if err != nil || string(result) != test.result[name] {
+					t.Fatalf("expected %s, got %s, %v", test.result[name], result, err)
+				}
+			})
+		}
+	}
+}
+
+func TestAggregatorsReturnPathErrors(t *testing.T) {
+
+	inputs := map[string][]byte{"a": []byte(`"text"`)}
+	for _, aggregator := range []func(map[string][]byte) ([]byte, error){ConcatArrays(), DeepMerge()} {
+		_, err := aggregator(inputs)
+		var pathErr *PathError
+		if !errors.As(err, &pathErr) || pathErr.Vertex != "a" || pathErr.Path != "$" {
+			t.Fatalf("expected a PathError at the input of a, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package jsonutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// keyEscaper escapes a key written as a quoted path segment
+var keyEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// Path a compiled JSONPath selector of a single value, such as $.order.items[0]['unit price']
+type Path struct {
+	source   string
+	segments []interface{} // string keys and int indexes
+}
+
+// PathError an error at a path of a payload
+type PathError struct {
+	Op     string // The failing helper
+	Vertex string // The vertex of the failing input of an aggregator, if any
+	Path   string // The path the error occurred at
+	Err    string // The description of the error
+}
+
+func (err *PathError) Error() string {
+
+	if err.Vertex != "" {
+		return fmt.Sprintf("%s, input of vertex `%s` at `%s`: %s", err.Op, err.Vertex, err.Path, err.Err)
+	}
+	return fmt.Sprintf("%s, at `%s`: %s", err.Op, err.Path, err.Err)
+}
+
+// CompilePath compiles a JSONPath selector
+func CompilePath(source string) (*Path, error) {
+
+	path, end, err := compilePath(source, 0)
+	if err != nil {
+		return nil, err
+	}
+	if end < len(source) {
+		return nil, fmt.Errorf("invalid path `%s`, unexpected `%c` at %d", source, source[end], end)
+	}
+	return path, nil
+}
+
+// ScanPath returns the end of the JSONPath selector starting with `$` at pos of a
+// larger source, such as an expression. The selector ends before the first character
+// that doesn't continue it, the brackets are scanned as CompilePath does
+func ScanPath(source string, pos int) (int, error) {
+
+	_, end, err := compilePath(source, pos)
+	return end, err
+}
+
+// compilePath compiles the selector starting at pos of source, it returns the path and
+// the position of the first character after it
+func compilePath(source string, pos int) (*Path, int, error) {
+
+	if !strings.HasPrefix(source[pos:], "$") {
+		return nil, 0, fmt.Errorf("invalid path `%s`, expected `$` at %d", source, pos)
+	}
+	path := &Path{source: source}
+	start := pos
+	pos++
+	for pos < len(source) {
+		switch source[pos] {
+		case '.':
+			name := pos + 1
+			pos = name
+			for pos < len(source) && IsNameChar(source[pos]) {
+				pos++
+			}
+			if pos == name {
+				return nil, 0, fmt.Errorf("invalid path `%s`, expected a field name at %d", source, name)
+			}
+			path.segments = append(path.segments, source[name:pos])
+		case '[':
+			segment, next, err := compileBracket(source, pos)
+			if err != nil {
+				return nil, 0, err
+			}
+			path.segments = append(path.segments, segment)
+			pos = next
+		default:
+			path.source = source[start:pos]
+			return path, pos, nil
+		}
+	}
+	path.source = source[start:]
+	return path, pos, nil
+}
+
+// compileBracket compiles the bracket segment of source at pos, a quoted key such as
+// ['a]b'] or an index such as [0]. Quotes and backslashes are escaped with a backslash
+// in quoted keys. It returns the segment and the position after the closing bracket
+func compileBracket(source string, pos int) (interface{}, int, error) {
+
+	start := pos
+	pos = skipSpaces(source, pos+1)
+	if pos < len(source) && (source[pos] == '\'' || source[pos] == '"') {
+		quote := source[pos]
+		var key strings.Builder
+		pos++
+		for ; pos < len(source) && source[pos] != quote; pos++ {
+			if source[pos] == '\\' && pos+1 < len(source) {
+				pos++
+			}
+			key.WriteByte(source[pos])
+		}
+		if pos == len(source) {
+			return nil, 0, fmt.Errorf("invalid path `%s`, unterminated quote at %d", source, start+1)
+		}
+		pos = skipSpaces(source, pos+1)
+		if pos == len(source) || source[pos] != ']' {
+			return nil, 0, fmt.Errorf("invalid path `%s`, expected `]` at %d", source, pos)
+		}
+		return key.String(), pos + 1, nil
+	}
+	close := strings.IndexByte(source[pos:], ']')
+	if close < 0 {
+		return nil, 0, fmt.Errorf("invalid path `%s`, unterminated `[` at %d", source, start)
+	}
+	inner := strings.TrimSpace(source[pos : pos+close])
+	index, err := strconv.Atoi(inner)
+	if err != nil || index < 0 {
+		return nil, 0, fmt.Errorf("invalid path `%s`, invalid index `%s` at %d", source, inner, start+1)
+	}
+	return index, pos + close + 1, nil
+}
+
+// skipSpaces returns the position of the first non space character of source from pos
+func skipSpaces(source string, pos int) int {
+
+	for pos < len(source) && source[pos] == ' ' {
+		pos++
+	}
+	return pos
+}
+
+// mustCompilePath compiles a path given to a helper, it panics if the path is invalid
+func mustCompilePath(op string, source string) *Path {
+
+	path, err := CompilePath(source)
+	if err != nil {
+		panic(fmt.Sprintf("Error at %s, %v", op, err))
+	}
+	return path
+}
+
+// IsNameChar checks if c can be part of a dotted field name
+func IsNameChar(c byte) bool {
+
+	return c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// String returns the source of the path
+func (path *Path) String() string {
+
+	return path.source
+}
+
+// Root checks if the path selects the whole payload
+func (path *Path) Root() bool {
+
+	return len(path.segments) == 0
+}
+
+// prefix returns the source of the first n segments of the path
+func (path *Path) prefix(n int) string {
+
+	var b strings.Builder
+	b.WriteString("$")
+	for _, segment := range path.segments[:n] {
+		switch key := segment.(type) {
+		case string:
+			if key != "" && strings.IndexFunc(key, func(r rune) bool { return r > 0x7f || !IsNameChar(byte(r)) }) < 0 {
+				b.WriteString("." + key)
+			} else {
+				b.WriteString("['" + keyEscaper.Replace(key) + "']")
+			}
+		case int:
+			b.WriteString("[" + strconv.Itoa(key) + "]")
+		}
+	}
+	return b.String()
+}
+
+// Lookup selects the value of the path in a decoded payload
+func (path *Path) Lookup(doc interface{}) (interface{}, bool) {
+
+	value, err := path.Get("Lookup", doc)
+	return value, err == nil
+}
+
+// Get selects the value of the path in a decoded payload, the
+// error of op points at the first segment not found
+func (path *Path) Get(op string, doc interface{}) (interface{}, error) {
+
+	value := doc
+	for i := range path.segments {
+		next, err := path.step(op, i, value)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			return nil, &PathError{Op: op, Path: path.prefix(i + 1), Err: "not found"}
+		}
+		value = *next
+	}
+	return value, nil
+}
+
+// step selects segment i in value, it returns nil if the segment is not found
+func (path *Path) step(op string, i int, value interface{}) (*interface{}, error) {
+
+	switch key := path.segments[i].(type) {
+	case string:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, &PathError{Op: op, Path: path.prefix(i), Err: "expected an object, found " + kindOf(value)}
+		}
+		field, ok := object[key]
+		if !ok {
+			return nil, nil
+		}
+		return &field, nil
+	case int:
+		array, ok := value.([]interface{})
+		if !ok {
+			return nil, &PathError{Op: op, Path: path.prefix(i), Err: "expected an array, found " + kindOf(value)}
+		}
+		if key >= len(array) {
+			return nil, &PathError{Op: op, Path: path.prefix(i + 1),
+				Err: fmt.Sprintf("index out of range, array has %d items", len(array))}
+		}
+		return &array[key], nil
+	}
+	return nil, nil
+}
+
+// Set sets the value of the path in a decoded payload, creating the missing objects
+// and arrays along the path, arrays are padded with null. It returns the payload,
+// which is value for the root path
+func (path *Path) Set(op string, doc interface{}, value interface{}) (interface{}, error) {
+
+	return path.set(op, 0, doc, value)
+}
+
+// set sets value at segment i and after in parent, it returns the updated parent
+func (path *Path) set(op string, i int, parent interface{}, value interface{}) (interface{}, error) {
+
+	if i == len(path.segments) {
+		return value, nil
+	}
+	switch key := path.segments[i].(type) {
+	case string:
+		if parent == nil {
+			parent = make(map[string]interface{})
+		}
+		object, ok := parent.(map[string]interface{})
+		if !ok {
+			return nil, &PathError{Op: op, Path: path.prefix(i), Err: "expected an object, found " + kindOf(parent)}
+		}
+		child, err := path.set(op, i+1, object[key], value)
+		if err != nil {
+			return nil, err
+		}
+		object[key] = child
+		return object, nil
+	case int:
+		if parent == nil {
+			parent = []interface{}{}
+		}
+		array, ok := parent.([]interface{})
+		if !ok {
+			return nil, &PathError{Op: op, Path: path.prefix(i), Err: "expected an array, found " + kindOf(parent)}
+		}
+		for len(array) <= key {
+			array = append(array, nil)
+		}
+		child, err := path.set(op, i+1, array[key], value)
+		if err != nil {
+			return nil, err
+		}
+		array[key] = child
+		return array, nil
+	}
+	return parent, nil
+}
+
+// Delete removes the field at the path from a decoded payload
+func (path *Path) Delete(op string, doc interface{}) error {
+
+	if path.Root() {
+		return &PathError{Op: op, Path: path.source, Err: "the root can't be removed"}
+	}
+	last := len(path.segments) - 1
+	parent, err := (&Path{source: path.prefix(last), segments: path.segments[:last]}).Get(op, doc)
+	if err != nil {
+		return err
+	}
+	key, ok := path.segments[last].(string)
+	if !ok {
+		return &PathError{Op: op, Path: path.source, Err: "array items can't be removed"}
+	}
+	object, ok := parent.(map[string]interface{})
+	if !ok {
+		return &PathError{Op: op, Path: path.prefix(last), Err: "expected an object, found " + kindOf(parent)}
+	}
+	if _, ok := object[key]; !ok {
+		return &PathError{Op: op, Path: path.source, Err: "not found"}
+	}
+	delete(object, key)
+	return nil
+}
+
+// kindOf returns the JSON kind of a decoded value
+func kindOf(value interface{}) string {
+
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,140 @@
+package jsonutil
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompilePath(t *testing.T) {
+
+	tests := []struct {
+		source   string
+		segments []interface{}
+		err      string
+	}{
+		{"$", nil, ""},
+		{"$.order.items[0]", []interface{}{"order", "items", 0}, ""},
+		{"$['unit price']", []interface{}{"unit price"}, ""},
+		{`$["unit price"]`, []interface{}{"unit price"}, ""},
+		{"$['a]b']", []interface{}{"a]b"}, ""},
+		{"$[ 'a]b' ].c", []interface{}{"a]b", "c"}, ""},
+		{`$['it\'s']`, []interface{}{"it's"}, ""},
+		{`$['a\\b']`, []interface{}{`a\b`}, ""},
+		{"$[ 2 ]", []interface{}{2}, ""},
+		{"order", nil, "expected `$` at 0"},
+		{"$.", nil, "expected a field name at 2"},
+		{"$.a b", nil, "unexpected ` ` at 3"},
+		{"$[0", nil, "unterminated `[` at 1"},
+		{"$['a]", nil, "unterminated quote at 2"},
+		{"$['a'b]", nil, "expected `]` at 5"},
+		{"$[-1]", nil, "invalid index `-1`"},
+		{"$[a]", nil, "invalid index `a`"},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			path, err := CompilePath(test.source)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(path.segments, test.segments) {
+				t.Fatalf("expected %v, got %v, %v", test.segments, path, err)
+			}
+		})
+	}
+}
+
+func TestScanPath(t *testing.T) {
+
+	tests := []struct {
+		source string
+		pos    int
+		end    int
+		err    string
+	}{
+		{"$.a == 1", 0, 3, ""},
+		{"$['a]b'] == 1", 0, 8, ""},
+		{`1 == $["a\"]"].b`, 5, 16, ""},
+		{"$[0]", 0, 4, ""},
+		{"$['a] == 1", 0, 0, "unterminated quote at 2"},
+		{"$. == 1", 0, 0, "expected a field name at 2"},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			end, err := ScanPath(test.source, test.pos)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil || end != test.end {
+				t.Fatalf("expected the end %d, got %d, %v", test.end, end, err)
+			}
+		})
+	}
+}
+
+func TestPathPrefix(t *testing.T) {
+
+	tests := []struct {
+		source string
+		prefix string
+	}{
+		{"$.a[1].b", "$.a[1].b"},
+		{"$['unit price']", "$['unit price']"},
+		{`$['it\'s']['a]b']`, `$['it\'s']['a]b']`},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			path, err := CompilePath(test.source)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			prefix := path.prefix(len(path.segments))
+			if prefix != test.prefix {
+				t.Fatalf("expected %s, got %s", test.prefix, prefix)
+			}
+			// the prefix compiles back to the same path
+			if compiled, err := CompilePath(prefix); err != nil || !reflect.DeepEqual(compiled.segments, path.segments) {
+				t.Fatalf("expected %s to compile to %v, got %v, %v", prefix, path.segments, compiled, err)
+			}
+		})
+	}
+}
+
+func TestPathGet(t *testing.T) {
+
+	doc, _ := decodeJSON([]byte(`{"a":{"b":[1,{"c":true}]},"s":"x"}`))
+	tests := []struct {
+		source string
+		value  interface{}
+		err    string
+	}{
+		{"$.a.b[1].c", true, ""},
+		{"$.s", "x", ""},
+		{"$.a.z", nil, "Get, at `$.a.z`: not found"},
+		{"$.a.b[5]", nil, "Get, at `$.a.b[5]`: index out of range, array has 2 items"},
+		{"$.s.t", nil, "Get, at `$.s`: expected an object, found string"},
+		{"$.a[0]", nil, "Get, at `$.a`: expected an array, found object"},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			value, err := mustCompilePath("Get", test.source).Get("Get", doc)
+			if test.err != "" {
+				var pathErr *PathError
+				if !errors.As(err, &pathErr) || err.Error() != test.err {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(value, test.value) {
+				t.Fatalf("expected %v, got %v, %v", test.value, value, err)
+			}
+		})
+	}
+}
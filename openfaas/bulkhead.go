@@ -0,0 +1,62 @@
+package openfaas
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/internal/bulkhead"
+)
+
+var (
+	// ERR_BULKHEAD_FULL denotes that a call timed out waiting in the bulkhead queue
+	ERR_BULKHEAD_FULL = bulkhead.ErrFull
+
+	// bulkheads is the process wide bulkhead registry shared by all operations
+	bulkheads = bulkhead.NewRegistry()
+)
+
+// BulkheadStats saturation metrics of the bulkhead of a target
+type BulkheadStats = bulkhead.Stats
+
+// GetBulkheadStats returns the saturation metrics of all the bulkheads of the process
+func GetBulkheadStats() []BulkheadStats {
+
+	fmt.Println("lib/openfaas/bulkhead.go::GetBulkheadStats start")
+	fmt.Println("lib/openfaas/bulkhead.go::GetBulkheadStats end")
+	return bulkheads.Stats()
+}
+
+// targetKey returns the key of the target the operation calls
+func (operation *FaasOperation) targetKey() string {
+
+	if operation.Function != "" {
+		return "function:" + operation.Function
+	}
+	return "url:" + operation.HttpRequestUrl
+}
+
+// registerBulkhead registers the bulkhead of the operation, it panics
+// if the target already has a bulkhead with another limit
+func (operation *FaasOperation) registerBulkhead() {
+
+	_, err := bulkheads.Get(operation.targetKey(), operation.MaxInFlight)
+	if err != nil {
+		panic(fmt.Sprintf("Error at MaxInFlight, %v", err))
+	}
+}
+
+// withBulkhead executes call within the bulkhead of the operation
+func (operation *FaasOperation) withBulkhead(ctx context.Context, call func() ([]byte, error)) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/bulkhead.go::withBulkhead start")
+	if operation.MaxInFlight <= 0 {
+		return call()
+	}
+
+	b, err := bulkheads.Get(operation.targetKey(), operation.MaxInFlight)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("lib/openfaas/bulkhead.go::withBulkhead end")
+	return b.Do(ctx, operation.QueueTimeout, call)
+}
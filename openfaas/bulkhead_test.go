@@ -0,0 +1,17 @@
+package openfaas
+
+import (
+	"testing"
+)
+
+func TestMaxInFlightConflictingLimitPanics(t *testing.T) {
+
+	createFunction("bulkhead-conflict").applyOptions([]Option{MaxInFlight(2)})
+	createFunction("bulkhead-conflict").applyOptions([]Option{MaxInFlight(2)})
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected a conflicting MaxInFlight to panic")
+		}
+	}()
+	createFunction("bulkhead-conflict").applyOptions([]Option{MaxInFlight(3)})
+}
@@ -0,0 +1,120 @@
+package openfaas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// inflightCall a call in progress or completed for a coalescing key
+type inflightCall struct {
+	wg     sync.WaitGroup
+	result []byte
+	err    error
+}
+
+// callGroup coalesces identical concurrent calls into one upstream call
+type callGroup struct {
+	mu    sync.Mutex
+	calls map[string]*inflightCall
+}
+
+var (
+	// requestGroup is the process wide group shared by all coalesced operations
+	requestGroup = &callGroup{calls: make(map[string]*inflightCall)}
+)
+
+// do executes fn once for all concurrent callers sharing the same key,
+// every caller receives its own copy of the result and whether it was shared
+func (group *callGroup) do(key string, fn func() ([]byte, error)) ([]byte, bool, error) {
+
+	fmt.Println("lib/openfaas/coalesce.go::do start")
+	group.mu.Lock()
+	if call, ok := group.calls[key]; ok {
+		group.mu.Unlock()
+		call.wg.Wait()
+		fmt.Println("lib/openfaas/coalesce.go::do end")
+		return copyBytes(call.result), true, call.err
+	}
+	call := &inflightCall{err: fmt.Errorf("coalesced call did not complete")}
+	call.wg.Add(1)
+	group.calls[key] = call
+	group.mu.Unlock()
+
+	func() {
+		// release the waiters even if fn panics
+		defer func() {
+			group.mu.Lock()
+			delete(group.calls, key)
+			group.mu.Unlock()
+			call.wg.Done()
+		}()
+		call.result, call.err = fn()
+	}()
+
+	fmt.Println("lib/openfaas/coalesce.go::do end")
+	return copyBytes(call.result), false, call.err
+}
+
+// copyBytes returns a copy of data so that waiters never share a buffer
+func copyBytes(data []byte) []byte {
+
+	if data == nil {
+		return nil
+	}
+	result := make([]byte, len(data))
+	copy(result, data)
+	return result
+}
+
+// coalesceScope identifies the operations allowed to share their calls. It is the
+// path of the vertex, stable across the requests, and the operation itself when it
+// has a request or response handler, handlers can't be compared so that their calls
+// are only shared by the same operation
+func (operation *FaasOperation) coalesceScope() string {
+
+	scope := ""
+	if operation.node != nil {
+		scope = vertexPath(operation.node)
+	}
+	if operation.Requesthandler != nil || operation.OnResphandler != nil {
+		scope = fmt.Sprintf("%s@%p", scope, operation)
+	}
+	return scope
+}
+
+// coalesceKey builds the key identifying an upstream call by the scope of the
+// operation, its target, method, body, query and headers
+func coalesceKey(scope string, target string, method string, data []byte, params map[string][]string,
+	headers map[string]string) string {
+
+	fmt.Println("lib/openfaas/coalesce.go::coalesceKey start")
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%s\n", scope, method, target)
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range params[key] {
+			fmt.Fprintf(hash, "q:%s=%s\n", key, value)
+		}
+	}
+
+	keys = keys[:0]
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(hash, "h:%s=%s\n", key, headers[key])
+	}
+
+	hash.Write(data)
+	fmt.Println("lib/openfaas/coalesce.go::coalesceKey end")
+	return hex.EncodeToString(hash.Sum(nil))
+}
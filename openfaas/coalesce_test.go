@@ -0,0 +1,210 @@
+package openfaas
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// runConcurrently runs fn n times concurrently, release is closed once every goroutine started
+func runConcurrently(n int, release chan struct{}, fn func(i int)) {
+
+	var started, done sync.WaitGroup
+	started.Add(n)
+	done.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer done.Done()
+			started.Done()
+			fn(i)
+		}(i)
+	}
+	started.Wait()
+	// let the callers reach the group before the shared call completes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	done.Wait()
+}
+
+func TestCallGroupSharesConcurrentCalls(t *testing.T) {
+
+	group := &callGroup{calls: make(map[string]*inflightCall)}
+	release := make(chan struct{})
+	var calls, shared int32
+	results := make([][]byte, 10)
+	runConcurrently(10, release, func(i int) {
+		result, isShared, err := group.do("key", func() ([]byte, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return []byte("result"), nil
+		})
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+		if isShared {
+			atomic.AddInt32(&shared, 1)
+		}
+		results[i] = result
+	})
+
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+	if shared != 9 {
+		t.Fatalf("expected 9 shared results, got %d", shared)
+	}
+	results[0][0] = 'X'
+	for i, result := range results[1:] {
+		if string(result) != "result" {
+			t.Fatalf("result %d is %q, the callers must not share a buffer", i+1, result)
+		}
+	}
+	if len(group.calls) != 0 {
+		t.Fatalf("expected the completed call to be removed, %d left", len(group.calls))
+	}
+}
+
+func TestCallGroupReleasesWaitersOnPanic(t *testing.T) {
+
+	group := &callGroup{calls: make(map[string]*inflightCall)}
+	func() {
+		defer func() { recover() }()
+		group.do("key", func() ([]byte, error) { panic("failure") })
+	}()
+	_, _, err := group.do("key", func() ([]byte, error) { return nil, nil })
+	if err != nil {
+		t.Fatalf("expected a new call after the panic, got %v", err)
+	}
+}
+
+func TestInvokeCoalescesUpstreamHits(t *testing.T) {
+
+	release := make(chan struct{})
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	operation := createHttpRequest(server.URL + "/coalesced")
+	operation.applyOptions([]Option{Coalesce()})
+	runConcurrently(10, release, func(i int) {
+		result, err := operation.invoke("request", "", []byte("same body"))
+		if err != nil || string(result) != "ok" {
+			t.Errorf("unexpected result %q, %v", result, err)
+		}
+	})
+	if hits != 1 {
+		t.Fatalf("expected a single upstream hit, got %d", hits)
+	}
+}
+
+func TestInvokeDoesNotShareCallsOfOtherHandlers(t *testing.T) {
+
+	release := make(chan struct{})
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	operations := make([]*FaasOperation, 2)
+	for i, token := range []string{"token-a", "token-b"} {
+		token := token
+		operations[i] = createHttpRequest(server.URL + "/coalesced")
+		operations[i].applyOptions([]Option{Coalesce(), RequestHandler(func(req *http.Request) {
+			req.Header.Set("Authorization", token)
+		})})
+	}
+	results := make([]string, 4)
+	runConcurrently(4, release, func(i int) {
+		result, err := operations[i%2].invoke("request", "", []byte("same body"))
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+		results[i] = string(result)
+	})
+	if hits != 2 {
+		t.Fatalf("expected one upstream hit per operation, got %d", hits)
+	}
+	for i, result := range results {
+		expected := []string{"token-a", "token-b"}[i%2]
+		if result != expected {
+			t.Fatalf("caller %d received %q, expected %q", i, result, expected)
+		}
+	}
+}
+
+func TestCoalesceKey(t *testing.T) {
+
+	base := func() (string, string, string, []byte, map[string][]string, map[string]string) {
+		return "dag.vertex", "http://gateway/function/f", "POST", []byte("body"),
+			map[string][]string{"a": {"1", "2"}, "b": {"3"}}, map[string]string{"x": "1", "y": "2"}
+	}
+	scope, target, method, data, params, headers := base()
+	key := coalesceKey(scope, target, method, data, params, headers)
+
+	tests := []struct {
+		name  string
+		apply func(scope, target, method *string, data *[]byte, params map[string][]string, headers map[string]string)
+		same  bool
+	}{
+		{"identical call", func(_, _, _ *string, _ *[]byte, _ map[string][]string, _ map[string]string) {}, true},
+		{"other scope", func(scope, _, _ *string, _ *[]byte, _ map[string][]string, _ map[string]string) {
+			*scope = "dag.other"
+		}, false},
+		{"other target", func(_, target, _ *string, _ *[]byte, _ map[string][]string, _ map[string]string) {
+			*target = "http://gateway/function/g"
+		}, false},
+		{"other method", func(_, _, method *string, _ *[]byte, _ map[string][]string, _ map[string]string) {
+			*method = "GET"
+		}, false},
+		{"other body", func(_, _, _ *string, data *[]byte, _ map[string][]string, _ map[string]string) {
+			*data = []byte("other")
+		}, false},
+		{"other query", func(_, _, _ *string, _ *[]byte, params map[string][]string, _ map[string]string) {
+			params["a"] = []string{"2", "1"}
+		}, false},
+		{"other header", func(_, _, _ *string, _ *[]byte, _ map[string][]string, headers map[string]string) {
+			headers["x"] = "2"
+		}, false},
+		{"header moved to the query", func(_, _, _ *string, _ *[]byte, params map[string][]string, headers map[string]string) {
+			delete(headers, "y")
+			params["y"] = []string{"2"}
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scope, target, method, data, params, headers := base()
+			test.apply(&scope, &target, &method, &data, params, headers)
+			other := coalesceKey(scope, target, method, data, params, headers)
+			if (other == key) != test.same {
+				t.Fatalf("expected same key %v, got %v", test.same, other == key)
+			}
+		})
+	}
+}
+
+func TestCoalesceScope(t *testing.T) {
+
+	plain := createFunction("f")
+	other := createFunction("f")
+	if plain.coalesceScope() != other.coalesceScope() {
+		t.Fatalf("operations without handlers must share the scope")
+	}
+	handled := createFunction("f")
+	handled.addRequestHandler(func(req *http.Request) {})
+	if handled.coalesceScope() == plain.coalesceScope() {
+		t.Fatalf("an operation with a handler must have its own scope")
+	}
+	if handled.coalesceScope() != handled.coalesceScope() {
+		t.Fatalf("the scope of an operation must be stable")
+	}
+}
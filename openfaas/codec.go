@@ -0,0 +1,105 @@
+package openfaas
+
+import (
+	"fmt"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/codec"
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+// codecConversion the conversion of the data forwarded on an edge
+type codecConversion struct {
+	from codec.Codec
+	to   codec.Codec
+}
+
+func (operation *FaasOperation) addCodec(c codec.Codec) {
+
+	fmt.Printf("lib/openfaas/codec.go::addCodec start")
+	operation.Codec = c
+	operation.addheader("Content-Type", c.ContentType())
+	fmt.Printf("lib/openfaas/codec.go::addCodec end")
+}
+
+// addAccept sets the Accept header of a call with a Codec, unless given with Header. The
+// Codec is preferred, and the payload format of the flow accepted as it needs no conversion
+func (operation *FaasOperation) addAccept() {
+
+	if operation.Codec == nil {
+		return
+	}
+	if _, ok := operation.Header["accept"]; ok {
+		return
+	}
+	if operation.FlowCodec != nil {
+		operation.addheader("Accept", codec.Accept(operation.Codec, operation.FlowCodec))
+		return
+	}
+	operation.addheader("Accept", codec.Accept(operation.Codec))
+}
+
+func (operation *FaasOperation) addFlowCodec(c codec.Codec) {
+
+	fmt.Printf("lib/openfaas/codec.go::addFlowCodec start")
+	operation.FlowCodec = c
+	fmt.Printf("lib/openfaas/codec.go::addFlowCodec end")
+}
+
+// encodeInput converts the input of the call from the payload format of the flow
+func (operation *FaasOperation) encodeInput(data []byte) ([]byte, error) {
+
+	if operation.FlowCodec == nil || len(data) == 0 {
+		return data, nil
+	}
+	fmt.Printf("lib/openfaas/codec.go::encodeInput start")
+	result, err := codec.Convert(data, operation.FlowCodec, operation.Codec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert the input to %s, %w", operation.Codec.Name(), err)
+	}
+	fmt.Printf("lib/openfaas/codec.go::encodeInput end")
+	return result, nil
+}
+
+// decodeOutput converts the response of the call to the payload format of the flow. The
+// response is decoded with the Codec when the media type of its Content-Type matches, with
+// the codec registered for it otherwise. A response without a known Content-Type is decoded
+// with the codec its Accept header negotiates, the Codec by default
+func (operation *FaasOperation) decodeOutput(contentType string, data []byte) ([]byte, error) {
+
+	if operation.FlowCodec == nil || len(data) == 0 {
+		return data, nil
+	}
+	fmt.Printf("lib/openfaas/codec.go::decodeOutput start")
+	from, ok := codec.ForContentType(contentType, operation.Codec)
+	if !ok {
+		from, ok = codec.Negotiate(operation.Header["accept"], operation.Codec)
+	}
+	if !ok {
+		from = operation.Codec
+	}
+	result, err := codec.Convert(data, from, operation.FlowCodec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert the response from %s, %w", from.Name(), err)
+	}
+	fmt.Printf("lib/openfaas/codec.go::decodeOutput end")
+	return result, nil
+}
+
+// forwarder converts the data forwarded by forwarder, markers pass through. A failed
+// conversion forwards a failure, caught by a TrySubDag or failing the operations it reaches
+func (conversion *codecConversion) forwarder(from, to string, forwarder sdk.Forwarder) sdk.Forwarder {
+
+	return func(data []byte) []byte {
+		data = forwarder(data)
+		if isMarker(data) || len(data) == 0 {
+			return data
+		}
+		result, err := codec.Convert(data, conversion.from, conversion.to)
+		if err != nil {
+			err = fmt.Errorf("Edge(%s-%s), error: %w", from, to, err)
+			fmt.Println(err)
+			return encodeFailure(from, "convert", data, err)
+		}
+		return result
+	}
+}
@@ -0,0 +1,110 @@
+package openfaas
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/codec"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestInvokeConvertsPayloads(t *testing.T) {
+
+	typed := codec.ProtobufOf(&structpb.Struct{})
+	message, _ := structpb.NewStruct(map[string]interface{}{"total": 3})
+	encoded, _ := proto.Marshal(message)
+	tests := []struct {
+		name        string
+		opts        []Option
+		contentType string
+		response    []byte
+		accept      string
+		result      string
+	}{
+		{"response of the Codec", []Option{Codec(typed), ConvertFrom(codec.JSON)}, "application/x-protobuf",
+			encoded, "application/x-protobuf, application/json;q=0.9", `{"total":3}`},
+		{"response in the flow format", []Option{Codec(typed), ConvertFrom(codec.JSON)}, "application/json",
+			[]byte(`{"total":3}`), "application/x-protobuf, application/json;q=0.9", `{"total":3}`},
+		{"response of another codec", []Option{Codec(codec.CBOR), ConvertFrom(codec.JSON)}, "application/msgpack",
+			[]byte{0x81, 0xa5, 't', 'o', 't', 'a', 'l', 0x03}, "application/cbor, application/json;q=0.9", `{"total":3}`},
+		{"response without Content-Type", []Option{Codec(typed), ConvertFrom(codec.JSON)}, "",
+			encoded, "application/x-protobuf, application/json;q=0.9", `{"total":3}`},
+		{"response negotiated by the Accept header", []Option{Header("Accept", "application/msgpack"),
+			Codec(typed), ConvertFrom(codec.JSON)}, "",
+			[]byte{0x81, 0xa5, 't', 'o', 't', 'a', 'l', 0x03}, "application/msgpack", `{"total":3}`},
+		{"Codec without conversion", []Option{Codec(codec.CBOR)}, "application/cbor",
+			[]byte{0xa0}, "application/cbor", "\xa0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var accept, contentType string
+			var body []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				accept, contentType = r.Header.Get("Accept"), r.Header.Get("Content-Type")
+				body, _ = ioutil.ReadAll(r.Body)
+				w.Header()["Content-Type"] = []string{test.contentType}
+				w.Write(test.response)
+			}))
+			defer server.Close()
+
+			operation := createHttpRequest(server.URL)
+			operation.applyOptions(test.opts)
+			result, err := operation.invoke("r", "", []byte(`{"total":3}`))
+			if err != nil || string(result) != test.result {
+				t.Fatalf("expected %q, got %q, %v", test.result, result, err)
+			}
+			if accept != test.accept {
+				t.Fatalf("expected Accept %s, got %s", test.accept, accept)
+			}
+			if contentType != operation.Codec.ContentType() {
+				t.Fatalf("expected Content-Type %s, got %s", operation.Codec.ContentType(), contentType)
+			}
+			if operation.FlowCodec != nil {
+				if converted, _ := codec.Convert(body, operation.Codec, codec.JSON); string(converted) != `{"total":3}` {
+					t.Fatalf("expected the input converted to %s, got %x", operation.Codec.Name(), body)
+				}
+			}
+		})
+	}
+}
+
+func TestConversionForwarder(t *testing.T) {
+
+	conversion := &codecConversion{from: codec.JSON, to: codec.MsgPack}
+	forward := conversion.forwarder("a", "b", func(data []byte) []byte { return data })
+	tests := []struct {
+		name    string
+		data    []byte
+		result  []byte
+		failure bool
+	}{
+		{"converted", []byte(`{"n":1}`), []byte{0x81, 0xa1, 'n', 0x01}, false},
+		{"marker passed through", skippedPayload, skippedPayload, false},
+		{"empty data", []byte{}, []byte{}, false},
+		{"conversion fails", []byte(`{"n":`), nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := forward(test.data)
+			if test.failure {
+				envelope := &ErrorEnvelope{}
+				if !isFailure(result) || json.Unmarshal(decodeFailure(result), envelope) != nil {
+					t.Fatalf("expected a failure, got %s", result)
+				}
+				if envelope.Vertex != "a" || envelope.Type != "codec-error" ||
+					!strings.Contains(envelope.Message, "Edge(a-b)") {
+					t.Fatalf("unexpected envelope %+v", envelope)
+				}
+				return
+			}
+			if string(result) != string(test.result) {
+				t.Fatalf("expected %x, got %x", test.result, result)
+			}
+		})
+	}
+}
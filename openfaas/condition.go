@@ -0,0 +1,284 @@
+package openfaas
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+const (
+	// ElseCondition is the key of the dag of a ConditionalBranch with Else
+	// that executes when no condition matches
+	ElseCondition = "else"
+
+	// failedCondition is the key of the dag failing a ConditionalBranch whose condition failed
+	failedCondition = "condition-failed"
+
+	// matchAll executes the dag of every matched condition
+	matchAll = "all"
+	// matchFirst executes the dag of the first matched condition
+	matchFirst = "first"
+)
+
+// checkedCondition a condition function that fails with an error
+type checkedCondition func(data []byte) ([]string, error)
+
+// conditionPolicy the conditions of a ConditionalBranch and how they are matched
+type conditionPolicy struct {
+	vertex     string
+	conditions map[string]bool
+	elseBranch bool
+	mode       string
+}
+
+// validate checks the conditions are non-empty and unique
+func (policy *conditionPolicy) validate(conditions []string) {
+
+	fmt.Println("lib/openfaas/condition.go::conditionPolicy::validate start")
+	policy.conditions = make(map[string]bool)
+	for _, key := range conditions {
+		if key == "" {
+			panic(fmt.Sprintf("Error at AddConditionalBranch for %s, empty condition", policy.vertex))
+		}
+		if policy.conditions[key] {
+			panic(fmt.Sprintf("Error at AddConditionalBranch for %s, duplicate condition %s", policy.vertex, key))
+		}
+		policy.conditions[key] = true
+	}
+	if policy.elseBranch && policy.conditions[ElseCondition] {
+		panic(fmt.Sprintf("Error at AddConditionalBranch for %s, condition %s is reserved for Else",
+			policy.vertex, ElseCondition))
+	}
+	if policy.conditions[failedCondition] {
+		panic(fmt.Sprintf("Error at AddConditionalBranch for %s, condition %s is reserved",
+			policy.vertex, failedCondition))
+	}
+	fmt.Println("lib/openfaas/condition.go::conditionPolicy::validate end")
+}
+
+// known returns the sorted conditions
+func (policy *conditionPolicy) known() string {
+
+	keys := []string{}
+	for key := range policy.conditions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+// match returns the conditions matched by condition, keeps the first one in
+// first match mode and falls back to the else dag if none matched. It fails
+// if condition fails or returns an unknown condition
+func (policy *conditionPolicy) match(condition checkedCondition, data []byte) ([]string, error) {
+
+	fmt.Println("lib/openfaas/condition.go::conditionPolicy::match start")
+	keys, err := condition(data)
+	if err != nil {
+		return nil, err
+	}
+	matched := []string{}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if !policy.conditions[key] {
+			return nil, fmt.Errorf("condition function returned unknown condition `%s`, expected one of [%s]",
+				key, policy.known())
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		matched = append(matched, key)
+		if policy.mode == matchFirst {
+			break
+		}
+	}
+	if len(matched) == 0 && policy.elseBranch {
+		matched = append(matched, ElseCondition)
+	}
+	fmt.Println("lib/openfaas/condition.go::conditionPolicy::match end")
+	return matched, nil
+}
+
+// condition selects the conditions matched by condition, if the match fails
+// the dag failing the branch executes instead
+func (policy *conditionPolicy) condition(condition checkedCondition) sdk.Condition {
+
+	return func(data []byte) []string {
+
+		fmt.Println("lib/openfaas/condition.go::conditionPolicy::condition start")
+		matched, err := policy.match(condition, data)
+		if err != nil {
+			fmt.Printf("ConditionalBranch %s failed, %v\n", policy.vertex, err)
+			return []string{failedCondition}
+		}
+		fmt.Println("lib/openfaas/condition.go::conditionPolicy::condition end")
+		return matched
+	}
+}
+
+// conditionFailure fails a ConditionalBranch whose condition failed, the
+// condition is checked again for the error as a condition returns no error
+type conditionFailure struct {
+	vertex    string           // the branch vertex
+	policy    *conditionPolicy // the conditions of the branch
+	condition checkedCondition // the condition of the branch
+	outer     *dagScope        // the scope of the branch vertex
+
+	ErrorVertex string // The vertex routing the failures, if any
+}
+
+// failureDag returns the dag failing the branch when its condition fails
+func (policy *conditionPolicy) failureDag(condition checkedCondition, outer *dagScope) *Dag {
+
+	fmt.Println("lib/openfaas/condition.go::conditionPolicy::failureDag start")
+	dag := NewDag()
+	outer.attach(dag.scope)
+	node := dag.Node(failedCondition)
+	operation := &conditionFailure{vertex: policy.vertex, policy: policy, condition: condition, outer: outer}
+	node.register(operation)
+	node.unode.AddOperation(operation)
+	fmt.Println("lib/openfaas/condition.go::conditionPolicy::failureDag end")
+	return dag
+}
+
+func (operation *conditionFailure) bind(node *sdk.Node, scope *dagScope) {
+}
+
+func (operation *conditionFailure) routeErrors(vertex string) {
+
+	operation.ErrorVertex = vertex
+}
+
+// routed checks if the failure of the branch is routed to an error edge or caught
+func (operation *conditionFailure) routed() bool {
+
+	_, ok := operation.outer.errorEdges[operation.vertex]
+	return ok || operation.ErrorVertex != ""
+}
+
+func (operation *conditionFailure) GetId() string {
+
+	fmt.Println("lib/openfaas/condition.go::conditionFailure::GetId start")
+	fmt.Println("lib/openfaas/condition.go::conditionFailure::GetId end")
+	return "condition-" + operation.vertex
+}
+
+func (operation *conditionFailure) Encode() []byte {
+
+	fmt.Println("lib/openfaas/condition.go::conditionFailure::Encode start")
+	fmt.Println("lib/openfaas/condition.go::conditionFailure::Encode end")
+	return []byte("")
+}
+
+func (operation *conditionFailure) GetProperties() map[string][]string {
+
+	fmt.Println("lib/openfaas/condition.go::conditionFailure::GetProperties start")
+	result := make(map[string][]string)
+	result["isMod"] = []string{"true"}
+	result["isFunction"] = []string{"false"}
+	result["isHttpRequest"] = []string{"false"}
+	fmt.Println("lib/openfaas/condition.go::conditionFailure::GetProperties end")
+	return result
+}
+
+func (operation *conditionFailure) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/condition.go::conditionFailure::Execute start")
+	_, err := operation.policy.match(operation.condition, data)
+	if err == nil {
+		err = fmt.Errorf("condition failed for the input of the branch")
+	}
+	err = fmt.Errorf("ConditionalBranch(%s), error: %v", operation.vertex, err)
+	if operation.routed() {
+		fmt.Printf("[Request `%v`] Routing failure of vertex `%s` to its error edge, %v\n",
+			option["request-id"], operation.vertex, err)
+		return encodeFailure(operation.vertex, operation.GetId(), data, err), nil
+	}
+	fmt.Println("lib/openfaas/condition.go::conditionFailure::Execute end")
+	return nil, err
+}
+
+// guard a predicate over a payload, and the condition it selects
+type guard struct {
+	source string                     // the expression, or func for a Go predicate
+	key    string                     // the condition selected, if any
+	eval   func([]byte) (bool, error) // evaluates the predicate
+}
+
+// newGuard creates a guard from an expression or a Go predicate
+func newGuard(predicate interface{}, key string) *guard {
+
+	fmt.Println("lib/openfaas/condition.go::newGuard start")
+	g := &guard{key: key}
+	switch p := predicate.(type) {
+	case string:
+		expr, err := CompileExpression(p)
+		if err != nil {
+			panic(fmt.Sprintf("Error at When, %v", err))
+		}
+		g.source = p
+		g.eval = expr.Eval
+	case *Expression:
+		g.source = p.String()
+		g.eval = p.Eval
+	case func([]byte) bool:
+		g.source = "func"
+		g.eval = func(data []byte) (bool, error) { return p(data), nil }
+	default:
+		panic(fmt.Sprintf("Error at When, invalid predicate type %T", predicate))
+	}
+	fmt.Println("lib/openfaas/condition.go::newGuard end")
+	return g
+}
+
+// guardCondition selects the conditions of the guards whose predicate holds, in order.
+// It fails if a predicate fails to evaluate
+func guardCondition(vertex string, guards []*guard) checkedCondition {
+
+	return func(data []byte) ([]string, error) {
+
+		fmt.Println("lib/openfaas/condition.go::guardCondition start")
+		matched := []string{}
+		for _, g := range guards {
+			ok, err := g.eval(data)
+			if err != nil {
+				return nil, fmt.Errorf("When `%s` of condition %s failed, %v", g.source, g.key, err)
+			}
+			if ok {
+				matched = append(matched, g.key)
+			}
+		}
+		fmt.Println("lib/openfaas/condition.go::guardCondition end")
+		return matched, nil
+	}
+}
+
+// forwarder forwards the output of the vertex through forwarder when
+// the predicate holds, otherwise the path is skipped. A predicate failing
+// to evaluate forwards a failure, caught by a TrySubDag or failing the
+// operations it reaches
+func (g *guard) forwarder(from string, to string, forwarder sdk.Forwarder) sdk.Forwarder {
+
+	return func(data []byte) []byte {
+
+		fmt.Println("lib/openfaas/condition.go::guard::forwarder start")
+		if isMarker(data) {
+			return data
+		}
+		ok, err := g.eval(data)
+		if err != nil {
+			err = fmt.Errorf("Edge(%s-%s), error: When `%s` failed, %v", from, to, g.source, err)
+			fmt.Println(err)
+			return encodeFailure(from, "when", data, err)
+		}
+		if !ok {
+			fmt.Printf("Edge %s-%s not taken, `%s` doesn't hold\n", from, to, g.source)
+			return skippedPayload
+		}
+		fmt.Println("lib/openfaas/condition.go::guard::forwarder end")
+		return forwarder(data)
+	}
+}
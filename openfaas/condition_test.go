@@ -0,0 +1,300 @@
+package openfaas
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/jsonutil"
+)
+
+// fixedCondition a condition returning keys
+func fixedCondition(keys ...string) checkedCondition {
+
+	return func(data []byte) ([]string, error) { return keys, nil }
+}
+
+func TestConditionPolicyMatch(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		mode       string
+		elseBranch bool
+		condition  checkedCondition
+		matched    []string
+		err        string
+	}{
+		{"every match", matchAll, false, fixedCondition("a", "b"), []string{"a", "b"}, ""},
+		{"duplicates ignored", matchAll, false, fixedCondition("a", "a"), []string{"a"}, ""},
+		{"first match", matchFirst, false, fixedCondition("b", "a"), []string{"b"}, ""},
+		{"no match", matchAll, false, fixedCondition(), []string{}, ""},
+		{"no match with else", matchAll, true, fixedCondition(), []string{ElseCondition}, ""},
+		{"unknown condition", matchAll, false, fixedCondition("a", "z"), nil, "unknown condition `z`"},
+		{"failing condition", matchAll, true, func([]byte) ([]string, error) {
+			return nil, fmt.Errorf("invalid input")
+		}, nil, "invalid input"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := &conditionPolicy{vertex: "branch", mode: test.mode, elseBranch: test.elseBranch}
+			policy.validate([]string{"a", "b"})
+			matched, err := policy.match(test.condition, nil)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(matched, test.matched) {
+				t.Fatalf("expected %v, got %v, %v", test.matched, matched, err)
+			}
+		})
+	}
+}
+
+func TestConditionSelectsFailureDag(t *testing.T) {
+
+	policy := &conditionPolicy{vertex: "branch", mode: matchAll}
+	policy.validate([]string{"a"})
+	matched := policy.condition(fixedCondition("z"))(nil)
+	if !reflect.DeepEqual(matched, []string{failedCondition}) {
+		t.Fatalf("expected the failure dag, got %v", matched)
+	}
+}
+
+func TestConditionFailure(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		define func(dag *Dag)
+		routed bool
+	}{
+		{"uncaught", func(dag *Dag) {}, false},
+		{"routed by an error edge", func(dag *Dag) {
+			dag.Node("handler")
+			dag.ErrorEdge("branch", "handler")
+		}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dag := NewDag()
+			dags := dag.ConditionalBranch("branch", []string{"a"}, func([]byte) []string { return []string{"z"} })
+			dags["a"].Node("a")
+			test.define(dag)
+			operation := failureOperation(t, dag)
+
+			result, err := operation.Execute([]byte(`{"n":1}`), map[string]interface{}{"request-id": "r"})
+			if !test.routed {
+				if err == nil || !strings.Contains(err.Error(), "ConditionalBranch(branch)") ||
+					!strings.Contains(err.Error(), "unknown condition `z`") {
+					t.Fatalf("expected the branch to fail, got %s, %v", result, err)
+				}
+				return
+			}
+			if err != nil || !isFailure(result) {
+				t.Fatalf("expected a failure marker, got %s, %v", result, err)
+			}
+			envelope := &ErrorEnvelope{}
+			json.Unmarshal(decodeFailure(result), envelope)
+			if envelope.Vertex != "branch" || string(envelope.Input) != `{"n":1}` {
+				t.Fatalf("unexpected envelope %+v", envelope)
+			}
+		})
+	}
+}
+
+func TestConditionFailureCaughtByTry(t *testing.T) {
+
+	body := NewDag()
+	dags := body.ConditionalBranch("branch", []string{"a"}, func([]byte) []string { return []string{"z"} })
+	dags["a"].Node("a")
+	operation := failureOperation(t, body)
+	NewDag().TrySubDag("try", body, NewDag())
+	if !operation.routed() {
+		t.Fatalf("expected the failure caught by the TrySubDag")
+	}
+}
+
+func TestConditionalBranchReservesFailureKey(t *testing.T) {
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected the reserved condition to panic")
+		}
+	}()
+	NewDag().ConditionalBranch("branch", []string{failedCondition}, func([]byte) []string { return nil })
+}
+
+// failureOperation returns the operation failing the branch vertex of dag
+func failureOperation(t *testing.T, dag *Dag) *conditionFailure {
+
+	failed := dag.udag.GetNode("branch").GetConditionalDag(failedCondition)
+	if failed == nil {
+		t.Fatalf("expected the failure dag of the branch")
+	}
+	operations := failed.GetNode(failedCondition).Operations()
+	if len(operations) != 1 {
+		t.Fatalf("expected the failure operation, got %d operations", len(operations))
+	}
+	return operations[0].(*conditionFailure)
+}
+
+func TestGuardCondition(t *testing.T) {
+
+	guards := []*guard{newGuard(`$.amount > 1000`, "large"), newGuard(`$.amount > 10`, "medium")}
+	tests := []struct {
+		name    string
+		data    string
+		matched []string
+		err     bool
+	}{
+		{"every guard holds", `{"amount":5000}`, []string{"large", "medium"}, false},
+		{"one guard holds", `{"amount":50}`, []string{"medium"}, false},
+		{"no guard holds", `{"amount":1}`, []string{}, false},
+		{"invalid payload", `not json`, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matched, err := guardCondition("branch", guards)([]byte(test.data))
+			if (err != nil) != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if !test.err && !reflect.DeepEqual(matched, test.matched) {
+				t.Fatalf("expected %v, got %v", test.matched, matched)
+			}
+		})
+	}
+}
+
+func TestConditionalBranchFailsOnGuardError(t *testing.T) {
+
+	dag := NewDag()
+	dags := dag.ConditionalBranch("branch", []string{"large"}, nil, When(`$.amount > 1000`, "large"))
+	dags["large"].Node("large")
+
+	matched := dag.udag.GetNode("branch").GetCondition()([]byte("not json"))
+	if !reflect.DeepEqual(matched, []string{failedCondition}) {
+		t.Fatalf("expected the failure dag, got %v", matched)
+	}
+	_, err := failureOperation(t, dag).Execute([]byte("not json"), map[string]interface{}{})
+	if err == nil || !strings.Contains(err.Error(), "When `$.amount > 1000` of condition large failed") {
+		t.Fatalf("expected the When failure, got %v", err)
+	}
+}
+
+func TestGuardForwarder(t *testing.T) {
+
+	forward := newGuard(`$.amount > 1000`, "").forwarder("a", "b", func(data []byte) []byte { return data })
+	tests := []struct {
+		name    string
+		data    []byte
+		result  []byte
+		failure bool
+	}{
+		{"predicate holds", []byte(`{"amount":5000}`), []byte(`{"amount":5000}`), false},
+		{"predicate doesn't hold", []byte(`{"amount":1}`), skippedPayload, false},
+		{"marker passed through", skippedPayload, skippedPayload, false},
+		{"predicate fails", []byte(`not json`), nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := forward(test.data)
+			if test.failure {
+				envelope := &ErrorEnvelope{}
+				if !isFailure(result) || json.Unmarshal(decodeFailure(result), envelope) != nil {
+					t.Fatalf("expected a failure, got %s", result)
+				}
+				if envelope.Vertex != "a" || !strings.Contains(envelope.Message, "Edge(a-b)") {
+					t.Fatalf("unexpected envelope %+v", envelope)
+				}
+				return
+			}
+			if string(result) != string(test.result) {
+				t.Fatalf("expected %s, got %s", test.result, result)
+			}
+		})
+	}
+}
+
+func TestForwardWith(t *testing.T) {
+
+	dag := NewDag()
+	dag.Node("a")
+	dag.Node("b")
+	dag.Edge("a", "b", ForwardWith(jsonutil.Unwrap("$.data")))
+	forward := dag.udag.GetNode("a").GetForwarder("b")
+	tests := []struct {
+		name    string
+		data    []byte
+		result  []byte
+		failure bool
+	}{
+		{"modified", []byte(`{"data":{"id":1}}`), []byte(`{"id":1}`), false},
+		{"marker passed through", skippedPayload, skippedPayload, false},
+		{"modifier fails", []byte(`{}`), nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := forward(test.data)
+			if test.failure {
+				envelope := &ErrorEnvelope{}
+				if !isFailure(result) || json.Unmarshal(decodeFailure(result), envelope) != nil {
+					t.Fatalf("expected a failure, got %s", result)
+				}
+				if envelope.Vertex != "a" || envelope.Operation != "forwarder" ||
+					!strings.Contains(envelope.Message, "Edge(a-b), error: forwarder failed, Unwrap, at `$.data`") {
+					t.Fatalf("unexpected envelope %+v", envelope)
+				}
+				return
+			}
+			if string(result) != string(test.result) {
+				t.Fatalf("expected %s, got %s", test.result, result)
+			}
+		})
+	}
+}
+
+func TestPassMarker(t *testing.T) {
+
+	failure := encodeFailure("a", "when", []byte("input"), fmt.Errorf("When failed"))
+	tests := []struct {
+		name        string
+		data        []byte
+		errorVertex string
+		err         bool
+	}{
+		{"skipped path", skippedPayload, "", false},
+		{"routed failure", failure, "b", false},
+		{"uncaught failure", failure, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := passMarker(test.data, test.errorVertex)
+			if test.err {
+				if err == nil || !strings.Contains(err.Error(), "vertex a failed, When failed") {
+					t.Fatalf("expected the failure, got %v", err)
+				}
+				return
+			}
+			if err != nil || string(result) != string(test.data) {
+				t.Fatalf("expected the marker passed through, got %s, %v", result, err)
+			}
+		})
+	}
+}
+
+func TestOperationFailsOnUncaughtFailure(t *testing.T) {
+
+	failure := encodeFailure("a", "when", []byte("input"), fmt.Errorf("When failed"))
+	operation := createFunction("f")
+	if _, err := operation.Execute(failure, map[string]interface{}{}); err == nil {
+		t.Fatalf("expected the uncaught failure to fail the operation")
+	}
+	operation.routeErrors("b")
+	result, err := operation.Execute(failure, map[string]interface{}{})
+	if err != nil || string(result) != string(failure) {
+		t.Fatalf("expected the caught failure passed through, got %s, %v", result, err)
+	}
+}
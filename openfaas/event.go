@@ -0,0 +1,460 @@
+package openfaas
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+const (
+	// EventApprove the action of an event approving a waiting branch
+	EventApprove = "approve"
+	// EventReject the action of an event rejecting a waiting branch
+	EventReject = "reject"
+)
+
+var (
+	// ERR_EVENT_TIMEOUT denotes that no event resumed a waiting branch in time
+	ERR_EVENT_TIMEOUT = fmt.Errorf("event wait timed out")
+	// ERR_EVENT_DELIVERED denotes that a waiting branch was already resumed
+	ERR_EVENT_DELIVERED = fmt.Errorf("event already delivered")
+	// ERR_EVENT_UNKNOWN denotes that no branch waits on a token
+	ERR_EVENT_UNKNOWN = fmt.Errorf("no branch waiting on token")
+
+	// timeoutPrefix starts the payload of a timeout routed by a timeout edge
+	timeoutPrefix = []byte(`{"__faasflow__":"timeout","event":`)
+	// suspendedPrefix starts the output of a vertex waiting for an event
+	suspendedPrefix = []byte(`{"__faasflow__":"suspended","token":`)
+)
+
+// TokenHandler handles the resume token issued by a WaitForEvent with the input of the vertex
+type TokenHandler func(token string, data []byte) error
+
+// Event an external event resuming a waiting branch
+type Event struct {
+	Token   string          `json:"token"`             // The resume token of the waiting branch
+	Action  string          `json:"action"`            // EventApprove, EventReject or a custom action
+	Payload json.RawMessage `json:"payload,omitempty"` // The payload of the event, if any
+}
+
+// EventTimeoutEnvelope the description of a timeout forwarded to a timeout handler vertex
+type EventTimeoutEnvelope struct {
+	Token      string          `json:"token"`                 // The resume token of the waiting branch
+	Vertex     string          `json:"vertex"`                // The waiting vertex
+	Timeout    string          `json:"timeout"`               // The elapsed timeout
+	Input      json.RawMessage `json:"input,omitempty"`       // The input of the vertex, if JSON
+	InputBytes []byte          `json:"input-bytes,omitempty"` // The input of the vertex, if not JSON
+}
+
+// EventOperation suspends a branch until an external event is posted for its token
+type EventOperation struct {
+	Vertex       string        // The vertex the operation belongs to
+	Timeout      time.Duration // The maximum wait, 0 waits forever
+	TokenHandler TokenHandler  // Announces the resume token, optional
+	ErrorVertex  string        // The vertex routing the failures, if any
+
+	node  *sdk.Node // the vertex the operation belongs to
+	scope *dagScope // the dag defining the vertex
+	index int       // the index of the operation in the vertex
+}
+
+// Resume posts an event to the branch waiting on token, it fails with ERR_EVENT_UNKNOWN
+// if no branch waits on token and with ERR_EVENT_DELIVERED if the branch was resumed
+func Resume(token string, action string, payload []byte) error {
+
+	fmt.Println("lib/openfaas/event.go::Resume start")
+	if token == "" {
+		return fmt.Errorf("resume token not specified")
+	}
+	if action == "" {
+		return fmt.Errorf("event action not specified")
+	}
+	event := &Event{Token: token, Action: action}
+	if len(payload) != 0 {
+		if !json.Valid(payload) {
+			return fmt.Errorf("event payload is not valid JSON")
+		}
+		event.Payload = append(json.RawMessage{}, payload...)
+	}
+	err := getSuspender().deliver(token, event)
+	fmt.Println("lib/openfaas/event.go::Resume end")
+	return err
+}
+
+// Approve resumes the branch waiting on token with an approval
+func Approve(token string, payload []byte) error {
+
+	return Resume(token, EventApprove, payload)
+}
+
+// Reject resumes the branch waiting on token with a rejection
+func Reject(token string, payload []byte) error {
+
+	return Resume(token, EventReject, payload)
+}
+
+// PendingEvents returns the tokens of the branches waiting for an event in the
+// in memory store of the Suspender, it returns nil when a SuspendStore was set
+func PendingEvents() []string {
+
+	store, ok := getSuspender().store.(*memorySuspendStore)
+	if !ok {
+		return nil
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	tokens := []string{}
+	for key, encoded := range store.values {
+		record := &suspension{}
+		if json.Unmarshal([]byte(encoded), record) != nil {
+			continue
+		}
+		if record.Kind == suspendEvent && record.Status == suspendPending {
+			tokens = append(tokens, strings.TrimPrefix(key, "suspend-"))
+		}
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// ResumeHandler an http handler resuming waiting branches, it accepts
+// a POSTed JSON Event such as {"token": "...", "action": "approve", "payload": {...}}
+func ResumeHandler() http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to read event, %v", err), http.StatusBadRequest)
+			return
+		}
+		event := &Event{}
+		err = json.Unmarshal(body, event)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid event, %v", err), http.StatusBadRequest)
+			return
+		}
+		err = Resume(event.Token, event.Action, event.Payload)
+		switch {
+		case errors.Is(err, ERR_EVENT_UNKNOWN):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ERR_EVENT_DELIVERED):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+}
+
+// WaitForEvent adds an operation to the given vertex that suspends the branch until
+// an event is posted for its resume token with Resume, Approve, Reject or the
+// ResumeHandler. The token is passed to the OnEventToken handler, the vertex outputs
+// the JSON Event; edges can follow the action with When(`$.action == "approve"`).
+// When the EventTimeout elapses the branch follows the TimeoutEdge of the vertex,
+// or fails. The invocation ends, the branch is kept by the Suspender and resumed by
+// the replica the event is posted to, the executor must be wrapped with
+// SuspendingExecutor. The wait must be the last operation of the vertex and the next
+// vertices can't be joins
+func (node *Node) WaitForEvent(opts ...Option) *Node {
+
+	fmt.Println("lib/openfaas/event.go::WaitForEvent start")
+	operation := &EventOperation{Vertex: node.unode.Id}
+	o := &Options{}
+	for _, opt := range opts {
+		o.reset()
+		opt(o)
+		if o.eventTimeout != 0 {
+			operation.Timeout = o.eventTimeout
+		}
+		if o.tokenHandler != nil {
+			operation.TokenHandler = o.tokenHandler
+		}
+	}
+	operation.index = len(node.unode.Operations())
+	node.register(operation)
+	node.unode.AddOperation(operation)
+	for _, child := range node.unode.Children() {
+		resumeEdge(node.unode, child)
+	}
+	fmt.Println("lib/openfaas/event.go::WaitForEvent end")
+	return node
+}
+
+func (operation *EventOperation) bind(node *sdk.Node, scope *dagScope) {
+
+	operation.node = node
+	operation.scope = scope
+}
+
+func (operation *EventOperation) routeErrors(vertex string) {
+
+	operation.ErrorVertex = vertex
+}
+
+// token returns the resume token of the operation for a request, the items
+// of a foreach vertex have their own token
+func (operation *EventOperation) token(reqId string) string {
+
+	return fmt.Sprintf("%s.%s.%d", reqId, executionPath(operation.node, operation.scope), operation.index)
+}
+
+// timedOut checks if the timeouts of the vertex are routed to a timeout edge
+func (operation *EventOperation) timedOut() bool {
+
+	_, ok := operation.scope.timeoutEdges[operation.Vertex]
+	return ok
+}
+
+func (operation *EventOperation) GetId() string {
+
+	fmt.Println("lib/openfaas/event.go::GetId start")
+	fmt.Println("lib/openfaas/event.go::GetId end")
+	return "event-" + operation.Vertex
+}
+
+func (operation *EventOperation) Encode() []byte {
+
+	fmt.Println("lib/openfaas/event.go::Encode start")
+	fmt.Println("lib/openfaas/event.go::Encode end")
+	return []byte("")
+}
+
+func (operation *EventOperation) GetProperties() map[string][]string {
+
+	fmt.Println("lib/openfaas/event.go::GetProperties start")
+	result := make(map[string][]string)
+	result["isMod"] = []string{"false"}
+	result["isFunction"] = []string{"false"}
+	result["isHttpRequest"] = []string{"false"}
+	result["isEvent"] = []string{"true"}
+	if operation.Timeout != 0 {
+		result["eventTimeout"] = []string{operation.Timeout.String()}
+	}
+	fmt.Println("lib/openfaas/event.go::GetProperties end")
+	return result
+}
+
+func (operation *EventOperation) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/event.go::Execute start")
+	// a skipped path or a routed failure passes through the vertex
+	if isMarker(data) {
+		return passMarker(data, operation.ErrorVertex)
+	}
+	reqId := fmt.Sprintf("%v", option["request-id"])
+	result, err := operation.wait(reqId, data)
+	fmt.Println("lib/openfaas/event.go::Execute end")
+	return operation.routed(reqId, data, result, err)
+}
+
+// routed routes the failure of the operation to the error edges of the vertex, if any
+func (operation *EventOperation) routed(reqId string, data []byte, result []byte, err error) ([]byte, error) {
+
+	if err != nil && operation.ErrorVertex != "" {
+		fmt.Printf("[Request `%s`] Routing failure of vertex `%s` to its error edge, %v\n",
+			reqId, operation.ErrorVertex, err)
+		return encodeFailure(operation.ErrorVertex, operation.GetId(), data, err), nil
+	}
+	return result, err
+}
+
+// wait suspends the branch of the request until the event, the vertex outputs the
+// token which the next vertices resolve once the branch is resumed
+func (operation *EventOperation) wait(reqId string, data []byte) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/event.go::wait start")
+	s := getSuspender()
+	token := operation.token(reqId)
+	record, _, err := s.load(token)
+	if err != nil {
+		return nil, fmt.Errorf("WaitForEvent(%s), %v", operation.Vertex, err)
+	}
+	if record != nil && record.Status != suspendPending {
+		// the vertex is executed again once resumed
+		return operation.resume(token, record)
+	}
+	err = checkSuspend(operation.node, operation.index)
+	if err != nil {
+		return nil, fmt.Errorf("WaitForEvent(%s), %v", operation.Vertex, err)
+	}
+	if record == nil {
+		record = &suspension{Kind: suspendEvent, Status: suspendPending, Vertex: operation.Vertex, Input: data}
+		if operation.Timeout != 0 {
+			record.At = getClock().Now().Add(operation.Timeout)
+		}
+		err = s.persist(token, record)
+		if err != nil {
+			return nil, fmt.Errorf("WaitForEvent(%s), %v", operation.Vertex, err)
+		}
+		// the token is announced once the branch can be resumed
+		if operation.TokenHandler != nil {
+			err = operation.TokenHandler(token, data)
+			if err != nil {
+				return nil, fmt.Errorf("WaitForEvent(%s), token handler failed, %v", operation.Vertex, err)
+			}
+		}
+	}
+
+	var pipeline *sdk.Pipeline
+	if flow := operation.scope.workflow(); flow != nil {
+		pipeline = flow.pipeline
+	}
+	s.suspend(reqId, token, operation.node, pipeline)
+	fmt.Printf("[Request `%s`] Vertex `%s` waiting for event `%s`\n", reqId, operation.Vertex, token)
+	encoded, _ := json.Marshal(token)
+	payload := append([]byte{}, suspendedPrefix...)
+	payload = append(payload, encoded...)
+	payload = append(payload, '}')
+	fmt.Println("lib/openfaas/event.go::wait end")
+	return payload, nil
+}
+
+// resume returns the output of the vertex resumed as token, the event or its timeout
+func (operation *EventOperation) resume(token string, record *suspension) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/event.go::resume start")
+	switch {
+	case record == nil || record.Status == suspendPending:
+		return nil, fmt.Errorf("WaitForEvent(%s), branch %s wasn't resumed", operation.Vertex, token)
+	case record.Status == suspendDelivered:
+		result, err := json.Marshal(record.Event)
+		if err != nil {
+			return nil, fmt.Errorf("WaitForEvent(%s), failed to encode event, %v", operation.Vertex, err)
+		}
+		return result, nil
+	}
+
+	if !operation.timedOut() {
+		return nil, fmt.Errorf("WaitForEvent(%s), %w after %v", operation.Vertex, ERR_EVENT_TIMEOUT, operation.Timeout)
+	}
+	envelope := &EventTimeoutEnvelope{Token: token, Vertex: operation.Vertex, Timeout: operation.Timeout.String()}
+	if json.Valid(record.Input) {
+		envelope.Input = record.Input
+	} else {
+		envelope.InputBytes = record.Input
+	}
+	encoded, _ := json.Marshal(envelope)
+	payload := append([]byte{}, timeoutPrefix...)
+	payload = append(payload, encoded...)
+	payload = append(payload, '}')
+	fmt.Println("lib/openfaas/event.go::resume end")
+	return payload, nil
+}
+
+// isSuspended checks if a payload is the output of a vertex waiting for an event
+func isSuspended(data []byte) bool {
+
+	return bytes.HasPrefix(data, suspendedPrefix)
+}
+
+// resumeAggregator resolves the outputs of the vertices waiting for an event into the
+// inputs of node once the branch is resumed, the other inputs are aggregated by aggregator
+func resumeAggregator(node *sdk.Node, aggregator sdk.Aggregator) sdk.Aggregator {
+
+	return func(inputs map[string][]byte) ([]byte, error) {
+		fmt.Println("lib/openfaas/event.go::resumeAggregator start")
+		for vertex, data := range inputs {
+			if !isSuspended(data) {
+				continue
+			}
+			var token string
+			err := json.Unmarshal(data[len(suspendedPrefix):len(data)-1], &token)
+			if err != nil {
+				return nil, fmt.Errorf("invalid output of vertex %s, %v", vertex, err)
+			}
+			parent := node.ParentDag().GetNode(vertex)
+			operation := eventOperation(parent)
+			if operation == nil {
+				return nil, fmt.Errorf("vertex %s doesn't wait for an event", vertex)
+			}
+			record, _, err := getSuspender().load(token)
+			if err != nil {
+				return nil, err
+			}
+			var input []byte
+			if record != nil {
+				input = record.Input
+			}
+			result, err := operation.resume(token, record)
+			result, err = operation.routed(strings.SplitN(token, ".", 2)[0], input, result, err)
+			if err != nil {
+				return nil, err
+			}
+			// the edge is taken as if the event was the output of the vertex
+			inputs[vertex] = parent.GetForwarder(node.Id)(result)
+		}
+		if aggregator != nil {
+			return aggregator(inputs)
+		}
+		for _, data := range inputs {
+			fmt.Println("lib/openfaas/event.go::resumeAggregator end")
+			return data, nil
+		}
+		return nil, nil
+	}
+}
+
+// eventOperation returns the operation of a vertex waiting for an event, nil if the vertex doesn't wait
+func eventOperation(node *sdk.Node) *EventOperation {
+
+	operations := node.Operations()
+	if len(operations) == 0 {
+		return nil
+	}
+	operation, _ := operations[len(operations)-1].(*EventOperation)
+	return operation
+}
+
+// resumeEdge resolves the output of the vertex from into the input of the vertex to
+// once the branch is resumed, if from waits for an event
+func resumeEdge(from *sdk.Node, to *sdk.Node) {
+
+	if eventOperation(from) != nil {
+		to.AddAggregator(resumeAggregator(to, to.GetAggregator()))
+	}
+}
+
+// isTimeout checks if a payload is a routed timeout
+func isTimeout(data []byte) bool {
+
+	return bytes.HasPrefix(data, timeoutPrefix)
+}
+
+// timeoutForwarder forwards the routed timeouts of a vertex as JSON, other outputs are
+// skipped. The output of a suspended vertex is forwarded as is, to be resolved once resumed
+func timeoutForwarder(data []byte) []byte {
+
+	fmt.Println("lib/openfaas/event.go::timeoutForwarder start")
+	if isSuspended(data) {
+		return data
+	}
+	if !isTimeout(data) {
+		return skippedPayload
+	}
+	fmt.Println("lib/openfaas/event.go::timeoutForwarder end")
+	return append([]byte{}, data[len(timeoutPrefix):len(data)-1]...)
+}
+
+// eventForwarder skips the routed timeouts, other outputs are forwarded by forwarder
+func eventForwarder(forwarder sdk.Forwarder) sdk.Forwarder {
+
+	return func(data []byte) []byte {
+		if isTimeout(data) {
+			return skippedPayload
+		}
+		return forwarder(data)
+	}
+}
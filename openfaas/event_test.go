@@ -0,0 +1,290 @@
+package openfaas
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+	"github.com/Abhishekghosh1998/faasflow-sdk/executor"
+)
+
+// approvalDag returns a dag waiting for an approval at the vertex approval, followed by the
+// vertices approved and rejected, it records the token issued in token
+func approvalDag(token *string, opts ...Option) *Dag {
+
+	handler := OnEventToken(func(issued string, data []byte) error {
+		*token = issued
+		return nil
+	})
+	dag := NewDag()
+	dag.Node("approval").WaitForEvent(append(opts, handler)...)
+	dag.Node("approved")
+	dag.Node("rejected")
+	dag.Edge("approval", "approved", When(`$.action == "approve"`))
+	dag.Edge("approval", "rejected", When(`$.action == "reject"`))
+	return dag
+}
+
+// suspendApproval executes the vertex approval of dag for request r, and hands the
+// states of its next vertices to exec as the executor does. It returns the inputs
+// of the next vertices
+func suspendApproval(t *testing.T, dag *Dag, exec executor.Executor, input string) map[string][]byte {
+
+	t.Helper()
+	node := dag.udag.GetNode("approval")
+	result, err := eventOperation(node).Execute([]byte(input), map[string]interface{}{"request-id": "r"})
+	if err != nil || !isSuspended(result) {
+		t.Fatalf("expected the branch suspended, got %s, %v", result, err)
+	}
+	inputs := make(map[string][]byte)
+	for _, child := range node.Children() {
+		inputs[child.Id] = node.GetForwarder(child.Id)(result)
+		if err := exec.HandleNextNode(nextState(t, "r", child.Id, nil)); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	return inputs
+}
+
+// resumedInput returns the input of vertex once the branch is resumed
+func resumedInput(dag *Dag, vertex string, data []byte) ([]byte, error) {
+
+	return dag.udag.GetNode(vertex).GetAggregator()(map[string][]byte{"approval": data})
+}
+
+func TestWaitForEvent(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		resume   func(token string) error
+		approved string
+		rejected string
+	}{
+		{"approved", func(token string) error { return Approve(token, []byte(`{"by":"alice"}`)) },
+			`"action":"approve","payload":{"by":"alice"}`, ""},
+		{"rejected", func(token string) error { return Reject(token, nil) }, "", `"action":"reject"`},
+		{"custom action", func(token string) error { return Resume(token, "escalate", nil) }, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, exec, states := suspendTest(t)
+			var token string
+			dag := approvalDag(&token)
+			inputs := suspendApproval(t, dag, exec, `{"amount":5000}`)
+			if token != "r.approval.0" {
+				t.Fatalf("unexpected token %s", token)
+			}
+			expectForward(t, states, false)
+
+			if err := test.resume(token); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			expectForward(t, states, true)
+			expectForward(t, states, true)
+			for vertex, expected := range map[string]string{"approved": test.approved, "rejected": test.rejected} {
+				data, err := resumedInput(dag, vertex, inputs[vertex])
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if expected == "" && !IsSkipped(data) || expected != "" && !strings.Contains(string(data), expected) {
+					t.Fatalf("unexpected input of %s, %s", vertex, data)
+				}
+			}
+		})
+	}
+}
+
+func TestWaitForEventTimeout(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		define func(dag *Dag)
+		check  func(t *testing.T, dag *Dag, inputs map[string][]byte)
+	}{
+		{"routed to the timeout edge", func(dag *Dag) {
+			dag.Node("expired")
+			dag.TimeoutEdge("approval", "expired")
+		}, func(t *testing.T, dag *Dag, inputs map[string][]byte) {
+			data, err := resumedInput(dag, "expired", inputs["expired"])
+			envelope := &EventTimeoutEnvelope{}
+			if err != nil || json.Unmarshal(data, envelope) != nil {
+				t.Fatalf("expected the timeout, got %s, %v", data, err)
+			}
+			if envelope.Timeout != "1h0m0s" || string(envelope.Input) != `{"amount":5000}` {
+				t.Fatalf("unexpected timeout %+v", envelope)
+			}
+			if data, _ := resumedInput(dag, "approved", inputs["approved"]); !IsSkipped(data) {
+				t.Fatalf("expected the approval skipped, got %s", data)
+			}
+		}},
+		{"routed to the error edge", func(dag *Dag) {
+			dag.Node("failed")
+			dag.ErrorEdge("approval", "failed")
+		}, func(t *testing.T, dag *Dag, inputs map[string][]byte) {
+			data, err := resumedInput(dag, "failed", inputs["failed"])
+			envelope := &ErrorEnvelope{}
+			if err != nil || json.Unmarshal(data, envelope) != nil || envelope.Type != "event-timeout" {
+				t.Fatalf("expected the failure, got %s, %v", data, err)
+			}
+		}},
+		{"uncaught", func(dag *Dag) {}, func(t *testing.T, dag *Dag, inputs map[string][]byte) {
+			_, err := resumedInput(dag, "approved", inputs["approved"])
+			if !errors.Is(err, ERR_EVENT_TIMEOUT) {
+				t.Fatalf("expected the timeout to fail the branch, got %v", err)
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock, exec, states := suspendTest(t)
+			var token string
+			dag := approvalDag(&token, EventTimeout(time.Hour))
+			test.define(dag)
+			inputs := suspendApproval(t, dag, exec, `{"amount":5000}`)
+
+			clock.Advance(time.Hour - time.Second)
+			expectForward(t, states, false)
+			clock.Advance(time.Second)
+			for range inputs {
+				expectForward(t, states, true)
+			}
+			if err := Approve(token, nil); !errors.Is(err, ERR_EVENT_DELIVERED) {
+				t.Fatalf("expected a late event to be rejected, got %v", err)
+			}
+			test.check(t, dag, inputs)
+		})
+	}
+}
+
+func TestResumeRejectsTokens(t *testing.T) {
+
+	_, exec, _ := suspendTest(t)
+	var token string
+	suspendApproval(t, approvalDag(&token), exec, `{}`)
+
+	if err := Approve("r.unknown.0", nil); !errors.Is(err, ERR_EVENT_UNKNOWN) {
+		t.Fatalf("expected an unknown token to be rejected, got %v", err)
+	}
+	if err := Approve(token, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := Approve(token, nil); !errors.Is(err, ERR_EVENT_DELIVERED) {
+		t.Fatalf("expected a delivered token to be rejected, got %v", err)
+	}
+}
+
+func TestResumeHandler(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"approval", http.MethodPost, `{"token":"r.approval.0","action":"approve"}`, http.StatusAccepted},
+		{"unknown token", http.MethodPost, `{"token":"r.other.0","action":"approve"}`, http.StatusNotFound},
+		{"missing action", http.MethodPost, `{"token":"r.approval.0"}`, http.StatusBadRequest},
+		{"invalid event", http.MethodPost, `not json`, http.StatusBadRequest},
+		{"not a post", http.MethodGet, ``, http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, exec, _ := suspendTest(t)
+			var token string
+			suspendApproval(t, approvalDag(&token), exec, `{}`)
+			recorder := httptest.NewRecorder()
+			ResumeHandler().ServeHTTP(recorder, httptest.NewRequest(test.method, "/", bytes.NewBufferString(test.body)))
+			if recorder.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, recorder.Code)
+			}
+		})
+	}
+
+	_, exec, _ := suspendTest(t)
+	var token string
+	suspendApproval(t, approvalDag(&token), exec, `{}`)
+	Approve(token, nil)
+	recorder := httptest.NewRecorder()
+	body := bytes.NewBufferString(`{"token":"r.approval.0","action":"approve"}`)
+	ResumeHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", body))
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected a delivered token to conflict, got %d", recorder.Code)
+	}
+}
+
+func TestResumeOnAnotherReplica(t *testing.T) {
+
+	_, exec, states := suspendTest(t)
+	store := newMemoryStore()
+	SetSuspender(NewSuspender(store, nil))
+	var token string
+	dag := approvalDag(&token)
+	inputs := suspendApproval(t, dag, exec, `{}`)
+
+	// the event is posted to a replica sharing the store
+	SetSuspender(NewSuspender(store, nil))
+	if err := Approve(token, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expectForward(t, states, true)
+	expectForward(t, states, true)
+	if data, err := resumedInput(dag, "approved", inputs["approved"]); err != nil || IsSkipped(data) {
+		t.Fatalf("expected the approval, got %s, %v", data, err)
+	}
+}
+
+func TestWaitForEventTokenPerItem(t *testing.T) {
+
+	suspendTest(t)
+	pipeline := sdk.CreatePipeline()
+	flow := GetWorkflow(pipeline)
+	items := flow.Dag().ForEachBranch("items", func(data []byte) map[string][]byte { return nil },
+		Aggregator(func(map[string][]byte) ([]byte, error) { return nil, nil }))
+	var token string
+	items.Node("approval").WaitForEvent(OnEventToken(func(issued string, data []byte) error {
+		token = issued
+		return nil
+	}))
+	items.Node("approved")
+	items.Edge("approval", "approved")
+	operation := eventOperation(items.udag.GetNode("approval"))
+
+	tokens := map[string]bool{}
+	for _, item := range []string{"a", "b"} {
+		enterForEach(pipeline, "items", item, "approval")
+		if _, err := operation.Execute([]byte(`{}`), map[string]interface{}{"request-id": "r"}); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		tokens[token] = true
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("expected a token per item, got %v", tokens)
+	}
+}
+
+func TestPendingEvents(t *testing.T) {
+
+	_, exec, _ := suspendTest(t)
+	// the in memory store of the default Suspender
+	SetSuspender(nil)
+	var token string
+	suspendApproval(t, approvalDag(&token), exec, `{}`)
+	if pending := PendingEvents(); len(pending) != 1 || pending[0] != token {
+		t.Fatalf("expected %s pending, got %v", token, pending)
+	}
+	Approve(token, nil)
+	if pending := PendingEvents(); len(pending) != 0 {
+		t.Fatalf("expected no pending event, got %v", pending)
+	}
+
+	SetSuspender(NewSuspender(newMemoryStore(), nil))
+	if PendingEvents() != nil {
+		t.Fatalf("expected no pending events for a SuspendStore")
+	}
+}
@@ -0,0 +1,531 @@
+package openfaas
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/jsonutil"
+)
+
+// Expression a predicate over a JSON payload, such as `$.amount > 1000`.
+// Operands are JSONPath selectors ($, $.field, $['field'], $[index]),
+// numbers, quoted strings, true, false and null. They are compared with
+// == != < <= > >= and combined with && || ! and parentheses. A selector
+// that doesn't match the payload is null
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// exprKind the static type of an expression node
+type exprKind int
+
+const (
+	kindAny exprKind = iota
+	kindBool
+	kindNumber
+	kindString
+	kindNull
+)
+
+// exprNode a node of a compiled expression
+type exprNode interface {
+	// kind returns the static type of the node
+	kind() exprKind
+	// eval evaluates the node against a decoded payload
+	eval(doc interface{}) (interface{}, error)
+}
+
+// exprToken a lexical token of an expression
+type exprToken struct {
+	kind string // path, number, string, ident, op or eof
+	text string
+	pos  int
+}
+
+// exprParser a recursive descent parser of an expression
+type exprParser struct {
+	source string
+	tokens []exprToken
+	next   int
+}
+
+type literalNode struct {
+	value interface{}
+	vkind exprKind
+}
+
+type pathNode struct {
+	path *jsonutil.Path
+}
+
+type notNode struct {
+	operand exprNode
+}
+
+type logicalNode struct {
+	op          string
+	left, right exprNode
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+}
+
+// CompileExpression compiles and type checks an expression
+func CompileExpression(source string) (*Expression, error) {
+
+	fmt.Println("lib/openfaas/expression.go::CompileExpression start")
+	tokens, err := lexExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	parser := &exprParser{source: source, tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != "eof" {
+		return nil, parser.errorf(token, "unexpected `%s`", token.text)
+	}
+	if kind := root.kind(); kind != kindBool && kind != kindAny {
+		return nil, fmt.Errorf("invalid expression `%s`, expected a boolean expression", source)
+	}
+	fmt.Println("lib/openfaas/expression.go::CompileExpression end")
+	return &Expression{source: source, root: root}, nil
+}
+
+// String returns the source of the expression
+func (expr *Expression) String() string {
+
+	return expr.source
+}
+
+// Eval evaluates the expression against a JSON payload
+func (expr *Expression) Eval(data []byte) (bool, error) {
+
+	fmt.Println("lib/openfaas/expression.go::Eval start")
+	var doc interface{}
+	if len(data) != 0 {
+		err := json.Unmarshal(data, &doc)
+		if err != nil {
+			return false, fmt.Errorf("expression `%s`, payload is not valid JSON, %v", expr.source, err)
+		}
+	}
+	value, err := expr.root.eval(doc)
+	if err != nil {
+		return false, fmt.Errorf("expression `%s`, %v", expr.source, err)
+	}
+	result, err := truth(value)
+	if err != nil {
+		return false, fmt.Errorf("expression `%s`, %v", expr.source, err)
+	}
+	fmt.Println("lib/openfaas/expression.go::Eval end")
+	return result, nil
+}
+
+// lexExpression splits an expression into tokens
+func lexExpression(source string) ([]exprToken, error) {
+
+	tokens := []exprToken{}
+	pos := 0
+	for pos < len(source) {
+		c := source[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			pos++
+
+		case c == '$':
+			end, err := scanPath(source, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, exprToken{kind: "path", text: source[pos:end], pos: pos})
+			pos = end
+
+		case c == '\'' || c == '"':
+			value, end, err := scanString(source, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, exprToken{kind: "string", text: value, pos: pos})
+			pos = end
+
+		case c >= '0' && c <= '9' || c == '-' || c == '.':
+			end := pos + 1
+			for end < len(source) && strings.IndexByte("0123456789.eE+-", source[end]) >= 0 {
+				if (source[end] == '+' || source[end] == '-') && source[end-1] != 'e' && source[end-1] != 'E' {
+					break
+				}
+				end++
+			}
+			if _, err := strconv.ParseFloat(source[pos:end], 64); err != nil {
+				return nil, fmt.Errorf("invalid expression `%s` at %d, invalid number `%s`", source, pos, source[pos:end])
+			}
+			tokens = append(tokens, exprToken{kind: "number", text: source[pos:end], pos: pos})
+			pos = end
+
+		case unicode.IsLetter(rune(c)):
+			end := pos
+			for end < len(source) && (unicode.IsLetter(rune(source[end])) || unicode.IsDigit(rune(source[end]))) {
+				end++
+			}
+			tokens = append(tokens, exprToken{kind: "ident", text: source[pos:end], pos: pos})
+			pos = end
+
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")"} {
+				if strings.HasPrefix(source[pos:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("invalid expression `%s` at %d, unexpected `%c`", source, pos, c)
+			}
+			tokens = append(tokens, exprToken{kind: "op", text: op, pos: pos})
+			pos += len(op)
+		}
+	}
+	tokens = append(tokens, exprToken{kind: "eof", text: "end of expression", pos: len(source)})
+	return tokens, nil
+}
+
+// scanPath returns the end of the JSONPath selector starting at pos
+func scanPath(source string, pos int) (int, error) {
+
+	end, err := jsonutil.ScanPath(source, pos)
+	if err != nil {
+		return 0, fmt.Errorf("invalid expression `%s`, %v", source, err)
+	}
+	return end, nil
+}
+
+// scanString returns the value and the end of the quoted string starting at pos
+func scanString(source string, pos int) (string, int, error) {
+
+	quote := source[pos]
+	value := strings.Builder{}
+	for end := pos + 1; end < len(source); end++ {
+		c := source[end]
+		switch {
+		case c == '\\' && end+1 < len(source):
+			end++
+			value.WriteByte(source[end])
+		case c == quote:
+			return value.String(), end + 1, nil
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("invalid expression `%s` at %d, unterminated string", source, pos)
+}
+
+func (parser *exprParser) peek() exprToken {
+
+	return parser.tokens[parser.next]
+}
+
+func (parser *exprParser) take() exprToken {
+
+	token := parser.tokens[parser.next]
+	if token.kind != "eof" {
+		parser.next++
+	}
+	return token
+}
+
+func (parser *exprParser) errorf(token exprToken, format string, args ...interface{}) error {
+
+	return fmt.Errorf("invalid expression `%s` at %d, %s", parser.source, token.pos, fmt.Sprintf(format, args...))
+}
+
+func (parser *exprParser) parseOr() (exprNode, error) {
+
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for parser.peek().text == "||" {
+		token := parser.take()
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.checkBool(token, left, right); err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (parser *exprParser) parseAnd() (exprNode, error) {
+
+	left, err := parser.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for parser.peek().text == "&&" {
+		token := parser.take()
+		right, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.checkBool(token, left, right); err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (parser *exprParser) parseUnary() (exprNode, error) {
+
+	if parser.peek().text == "!" {
+		token := parser.take()
+		operand, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.checkBool(token, operand); err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return parser.parseCompare()
+}
+
+func (parser *exprParser) parseCompare() (exprNode, error) {
+
+	left, err := parser.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	token := parser.peek()
+	switch token.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return left, nil
+	}
+	parser.take()
+	right, err := parser.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	lkind, rkind := left.kind(), right.kind()
+	switch token.text {
+	case "==", "!=":
+		if lkind != kindAny && rkind != kindAny && lkind != kindNull && rkind != kindNull && lkind != rkind {
+			return nil, parser.errorf(token, "`%s` compares a %s with a %s", token.text, lkind, rkind)
+		}
+	default:
+		for _, kind := range []exprKind{lkind, rkind} {
+			if kind != kindAny && kind != kindNumber && kind != kindString {
+				return nil, parser.errorf(token, "`%s` can't order a %s", token.text, kind)
+			}
+		}
+		if lkind != kindAny && rkind != kindAny && lkind != rkind {
+			return nil, parser.errorf(token, "`%s` compares a %s with a %s", token.text, lkind, rkind)
+		}
+	}
+	return &compareNode{op: token.text, left: left, right: right}, nil
+}
+
+func (parser *exprParser) parseOperand() (exprNode, error) {
+
+	token := parser.take()
+	switch token.kind {
+	case "path":
+		path, err := jsonutil.CompilePath(token.text)
+		if err != nil {
+			return nil, parser.errorf(token, "%v", err)
+		}
+		return &pathNode{path: path}, nil
+	case "number":
+		value, _ := strconv.ParseFloat(token.text, 64)
+		return &literalNode{value: value, vkind: kindNumber}, nil
+	case "string":
+		return &literalNode{value: token.text, vkind: kindString}, nil
+	case "ident":
+		switch token.text {
+		case "true":
+			return &literalNode{value: true, vkind: kindBool}, nil
+		case "false":
+			return &literalNode{value: false, vkind: kindBool}, nil
+		case "null":
+			return &literalNode{value: nil, vkind: kindNull}, nil
+		}
+		return nil, parser.errorf(token, "unknown identifier `%s`", token.text)
+	case "op":
+		if token.text == "(" {
+			inner, err := parser.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if close := parser.take(); close.text != ")" {
+				return nil, parser.errorf(close, "expected `)`, found `%s`", close.text)
+			}
+			return inner, nil
+		}
+	}
+	return nil, parser.errorf(token, "expected an operand, found `%s`", token.text)
+}
+
+// checkBool checks the operands of a logical operator are boolean
+func (parser *exprParser) checkBool(token exprToken, operands ...exprNode) error {
+
+	for _, operand := range operands {
+		if kind := operand.kind(); kind != kindBool && kind != kindAny {
+			return parser.errorf(token, "`%s` expects a boolean, found a %s", token.text, kind)
+		}
+	}
+	return nil
+}
+
+func (kind exprKind) String() string {
+
+	switch kind {
+	case kindBool:
+		return "boolean"
+	case kindNumber:
+		return "number"
+	case kindString:
+		return "string"
+	case kindNull:
+		return "null"
+	}
+	return "value"
+}
+
+func (node *literalNode) kind() exprKind { return node.vkind }
+
+func (node *literalNode) eval(doc interface{}) (interface{}, error) { return node.value, nil }
+
+func (node *pathNode) kind() exprKind { return kindAny }
+
+func (node *pathNode) eval(doc interface{}) (interface{}, error) {
+
+	value, _ := node.path.Lookup(doc)
+	return value, nil
+}
+
+func (node *notNode) kind() exprKind { return kindBool }
+
+func (node *notNode) eval(doc interface{}) (interface{}, error) {
+
+	value, err := node.operand.eval(doc)
+	if err != nil {
+		return nil, err
+	}
+	result, err := truth(value)
+	if err != nil {
+		return nil, err
+	}
+	return !result, nil
+}
+
+func (node *logicalNode) kind() exprKind { return kindBool }
+
+func (node *logicalNode) eval(doc interface{}) (interface{}, error) {
+
+	value, err := node.left.eval(doc)
+	if err != nil {
+		return nil, err
+	}
+	left, err := truth(value)
+	if err != nil {
+		return nil, err
+	}
+	if node.op == "&&" && !left || node.op == "||" && left {
+		return left, nil
+	}
+	value, err = node.right.eval(doc)
+	if err != nil {
+		return nil, err
+	}
+	return truth(value)
+}
+
+func (node *compareNode) kind() exprKind { return kindBool }
+
+func (node *compareNode) eval(doc interface{}) (interface{}, error) {
+
+	left, err := node.left.eval(doc)
+	if err != nil {
+		return nil, err
+	}
+	right, err := node.right.eval(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node.op {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	}
+
+	// ordering a missing value or values of different types is false
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false, nil
+		}
+		return order(node.op, compareFloat(l, r)), nil
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false, nil
+		}
+		return order(node.op, strings.Compare(l, r)), nil
+	}
+	return false, nil
+}
+
+// compareFloat compares two numbers
+func compareFloat(a float64, b float64) int {
+
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// order applies an ordering operator to the result of a comparison
+func order(op string, cmp int) bool {
+
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// truth returns the truth of a value, a missing value is false
+func truth(value interface{}) (bool, error) {
+
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("expected a boolean, found %v", value)
+}
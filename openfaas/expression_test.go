@@ -0,0 +1,57 @@
+package openfaas
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpressionEval(t *testing.T) {
+
+	tests := []struct {
+		source string
+		data   string
+		result bool
+	}{
+		{"$.amount > 1000", `{"amount":1500}`, true},
+		{"$['a]b'] == 1", `{"a]b":1}`, true},
+		{`$["a\"]"] == 'x' && $.b != null`, `{"a\"]":"x","b":2}`, true},
+		{"$['unit price'] <= 2", `{"unit price":3}`, false},
+		{"$.items[1] == 'b'", `{"items":["a","b"]}`, true},
+		{"!($.missing == null)", `{}`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			expr, err := CompileExpression(test.source)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			result, err := expr.Eval([]byte(test.data))
+			if err != nil || result != test.result {
+				t.Fatalf("expected %v, got %v, %v", test.result, result, err)
+			}
+		})
+	}
+}
+
+func TestExpressionCompileErrors(t *testing.T) {
+
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{"$['a] == 1", "unterminated quote at 2"},
+		{"$. == 1", "expected a field name at 2"},
+		{"$[0 == 1", "unterminated `[` at 1"},
+		{"$.a == 'x", "unterminated string"},
+		{"$.a +", "unexpected `+`"},
+		{"$.a == 1 2", "unexpected `2`"},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			_, err := CompileExpression(test.source)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package openfaas
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -9,6 +10,10 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/codec"
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
 )
 
 var (
@@ -27,6 +32,16 @@ type RespHandler func(*http.Response) ([]byte, error)
 // Reqhandler definition for RequestHdlr() option on operation
 type ReqHandler func(*http.Request)
 
+// StatusError error of a call that returned a non 2xx status
+type StatusError struct {
+	StatusCode int    // The returned status
+	Url        string // The called url
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("invalid return status %d while connecting %s", err.StatusCode, err.Url)
+}
+
 type FaasOperation struct {
 	// FaasOperations
 	Function       string   // The name of the function
@@ -40,6 +55,28 @@ type FaasOperation struct {
 	FailureHandler FuncErrorHandler // The Failure handler of the operation
 	Requesthandler ReqHandler       // The http request handler of the operation
 	OnResphandler  RespHandler      // The http Resp handler of the operation
+
+	Coalesce     bool             // Share identical in-flight calls
+	RateLimit    *RateLimitPolicy // The rate limit of the upstream calls
+	MaxInFlight  int              // The maximum concurrent calls to the target, 0 is unlimited
+	QueueTimeout time.Duration    // The maximum wait for a call slot, negative waits forever
+	Idempotent   bool             // The call can safely be repeated
+	Hedge        *HedgePolicy     // The hedging of the upstream calls
+	Mirrors      []*MirrorPolicy  // The shadow calls of the function
+	Fallbacks    []*FaasOperation // The alternate targets executed on failure, in order
+	FallbackOn   ErrorClassifier  // The failures that trigger the fallbacks, all if nil
+	Compensation *FaasOperation   // The undo of the operation in saga mode
+	Codec        codec.Codec      // The payload format of the target, if any
+	FlowCodec    codec.Codec      // The payload format of the flow, converted from and to Codec
+
+	TemplateContext *Context // The context the templates of the url, headers and query read, if any
+
+	ErrorVertex string // The vertex whose failures are routed to an error edge, if any
+
+	step      *sagaStep                   // the saga step of the operation
+	node      *sdk.Node                   // the vertex the operation belongs to
+	scope     *dagScope                   // the scope of the dag the operation belongs to
+	templates map[string]*requestTemplate // the compiled templates of the call
 }
 
 // createFunction Create a function with execution name
@@ -50,6 +87,7 @@ func createFunction(name string) *FaasOperation {
 	operation.Function = name
 	operation.Header = make(map[string]string)
 	operation.Param = make(map[string][]string)
+	operation.QueueTimeout = -1
 	fmt.Printf("lib/openfaas/faas_operation.go::createFunction end")
 	return operation
 }
@@ -72,6 +110,7 @@ func createHttpRequest(url string) *FaasOperation {
 	operation.HttpRequestUrl = url
 	operation.Header = make(map[string]string)
 	operation.Param = make(map[string][]string)
+	operation.QueueTimeout = -1
 	fmt.Printf("lib/openfaas/faas_operation.go::createHttpRequest end")
 	return operation
 }
@@ -118,6 +157,110 @@ func (operation *FaasOperation) addRequestHandler(handler ReqHandler) {
 	fmt.Printf("lib/openfaas/faas_operation.go::addRequestHandler end")
 }
 
+func (operation *FaasOperation) enableCoalesce() {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::enableCoalesce start")
+	operation.Coalesce = true
+	fmt.Printf("lib/openfaas/faas_operation.go::enableCoalesce end")
+}
+
+func (operation *FaasOperation) addRateLimit(rps float64, burst int) {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::addRateLimit start")
+	policy := operation.getRateLimitPolicy()
+	policy.Rps = rps
+	policy.Burst = burst
+	fmt.Printf("lib/openfaas/faas_operation.go::addRateLimit end")
+}
+
+func (operation *FaasOperation) addRateLimitScope(scope string) {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::addRateLimitScope start")
+	operation.getRateLimitPolicy().Scope = scope
+	fmt.Printf("lib/openfaas/faas_operation.go::addRateLimitScope end")
+}
+
+func (operation *FaasOperation) addRateLimitMaxWait(maxWait time.Duration) {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::addRateLimitMaxWait start")
+	operation.getRateLimitPolicy().MaxWait = maxWait
+	fmt.Printf("lib/openfaas/faas_operation.go::addRateLimitMaxWait end")
+}
+
+func (operation *FaasOperation) addMaxInFlight(limit int) {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::addMaxInFlight start")
+	operation.MaxInFlight = limit
+	fmt.Printf("lib/openfaas/faas_operation.go::addMaxInFlight end")
+}
+
+func (operation *FaasOperation) addQueueTimeout(timeout time.Duration) {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::addQueueTimeout start")
+	operation.QueueTimeout = timeout
+	fmt.Printf("lib/openfaas/faas_operation.go::addQueueTimeout end")
+}
+
+func (operation *FaasOperation) markIdempotent() {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::markIdempotent start")
+	operation.Idempotent = true
+	fmt.Printf("lib/openfaas/faas_operation.go::markIdempotent end")
+}
+
+func (operation *FaasOperation) addHedge(after time.Duration, maxExtra int) {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::addHedge start")
+	operation.Hedge = &HedgePolicy{After: after, MaxExtra: maxExtra}
+	fmt.Printf("lib/openfaas/faas_operation.go::addHedge end")
+}
+
+func (operation *FaasOperation) addMirror(function string, sampleRate float64, sink MirrorSink) {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::addMirror start")
+	policy := &MirrorPolicy{Function: function, SampleRate: sampleRate, Sink: sink, Timeout: DefaultMirrorTimeout}
+	operation.Mirrors = append(operation.Mirrors, policy)
+	fmt.Printf("lib/openfaas/faas_operation.go::addMirror end")
+}
+
+func (operation *FaasOperation) addFallback(fallback *FaasOperation) {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::addFallback start")
+	target := *fallback
+	if target.Function != "" {
+		// the fallback shares the call options of the operation
+		target.Header = operation.Header
+		target.Param = operation.Param
+		target.Requesthandler = operation.Requesthandler
+	}
+	operation.Fallbacks = append(operation.Fallbacks, &target)
+	fmt.Printf("lib/openfaas/faas_operation.go::addFallback end")
+}
+
+func (operation *FaasOperation) addFallbackClassifier(classifier ErrorClassifier) {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::addFallbackClassifier start")
+	operation.FallbackOn = classifier
+	fmt.Printf("lib/openfaas/faas_operation.go::addFallbackClassifier end")
+}
+
+func (operation *FaasOperation) addCompensation(compensation *FaasOperation) {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::addCompensation start")
+	target := *compensation
+	operation.Compensation = &target
+	fmt.Printf("lib/openfaas/faas_operation.go::addCompensation end")
+}
+
+// getRateLimitPolicy returns the rate limit policy, creating a default one
+func (operation *FaasOperation) getRateLimitPolicy() *RateLimitPolicy {
+
+	if operation.RateLimit == nil {
+		operation.RateLimit = &RateLimitPolicy{Scope: ScopeFunction, MaxWait: -1}
+	}
+	return operation.RateLimit
+}
+
 func (operation *FaasOperation) GetParams() map[string][]string {
 
 	fmt.Printf("lib/openfaas/faas_operation.go::GetParams start")
@@ -185,17 +328,37 @@ func makeQueryStringFromParam(params map[string][]string) string {
 	return result
 }
 
+// getMethod returns the http method for a call, the `method` header
+// overrides the `default-method` env, which defaults to POST
+func getMethod(headers map[string]string) string {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::getMethod start")
+	method := os.Getenv("default-method")
+	if method == "" {
+		method = "POST"
+	}
+
+	if m, ok := headers["method"]; ok {
+		method = m
+	}
+	fmt.Printf("lib/openfaas/faas_operation.go::getMethod end")
+	return method
+}
+
 // buildHttpRequest build upstream request for function
-func buildHttpRequest(url string, method string, data []byte, params map[string][]string,
+func buildHttpRequest(ctx context.Context, url string, method string, data []byte, params map[string][]string,
 	headers map[string]string) (*http.Request, error) {
 
 	fmt.Printf("lib/openfaas/faas_operation.go::buildHttpRequest start")
 	queryString := makeQueryStringFromParam(params)
-	if queryString != "" {
+	if queryString != "" && strings.Contains(url, "?") {
+		// the url already has a query string
+		url = url + "&" + queryString[1:]
+	} else if queryString != "" {
 		url = url + queryString
 	}
 
-	httpReq, err := http.NewRequest(method, url, bytes.NewReader(data))
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
 	if err != nil {
 		return nil, err
 	}
@@ -209,7 +372,7 @@ func buildHttpRequest(url string, method string, data []byte, params map[string]
 }
 
 // executeFunction executes a function call
-func executeFunction(gateway string, operation *FaasOperation, data []byte) ([]byte, error) {
+func executeFunction(ctx context.Context, gateway string, operation *FaasOperation, data []byte) ([]byte, error) {
 
 	fmt.Printf("lib/openfaas/faas_operation.go::executeFunction start")
 	var err error
@@ -221,16 +384,9 @@ func executeFunction(gateway string, operation *FaasOperation, data []byte) ([]b
 
 	funcUrl := buildURL("http://"+gateway, "function", name)
 
-	method := os.Getenv("default-method")
-	if method == "" {
-		method = "POST"
-	}
+	method := getMethod(headers)
 
-	if m, ok := headers["method"]; ok {
-		method = m
-	}
-
-	httpReq, err := buildHttpRequest(funcUrl, method, data, params, headers)
+	httpReq, err := buildHttpRequest(ctx, funcUrl, method, data, params, headers)
 	if err != nil {
 		return []byte{}, fmt.Errorf("cannot connect to Function on URL: %s", funcUrl)
 	}
@@ -250,18 +406,21 @@ func executeFunction(gateway string, operation *FaasOperation, data []byte) ([]b
 		result, err = operation.OnResphandler(resp)
 	} else {
 		if resp.StatusCode < 200 || resp.StatusCode > 299 {
-			err = fmt.Errorf("invalid return status %d while connecting %s", resp.StatusCode, funcUrl)
+			err = &StatusError{StatusCode: resp.StatusCode, Url: funcUrl}
 			result, _ = ioutil.ReadAll(resp.Body)
 		} else {
 			result, err = ioutil.ReadAll(resp.Body)
 		}
+		if err == nil {
+			result, err = operation.decodeOutput(resp.Header.Get("Content-Type"), result)
+		}
 	}
 	fmt.Printf("lib/openfaas/faas_operation.go::executeFunction end")
 	return result, err
 }
 
 // executeHttpRequest executes a httpRequest
-func executeHttpRequest(operation *FaasOperation, data []byte) ([]byte, error) {
+func executeHttpRequest(ctx context.Context, operation *FaasOperation, data []byte) ([]byte, error) {
 
 	fmt.Printf("lib/openfaas/faas_operation.go::executeHttpRequest start")
 	var err error
@@ -271,16 +430,9 @@ func executeHttpRequest(operation *FaasOperation, data []byte) ([]byte, error) {
 	params := operation.GetParams()
 	headers := operation.GetHeaders()
 
-	method := os.Getenv("default-method")
-	if method == "" {
-		method = "POST"
-	}
-
-	if m, ok := headers["method"]; ok {
-		method = m
-	}
+	method := getMethod(headers)
 
-	httpReq, err := buildHttpRequest(httpUrl, method, data, params, headers)
+	httpReq, err := buildHttpRequest(ctx, httpUrl, method, data, params, headers)
 	if err != nil {
 		return nil, fmt.Errorf("cannot connect to Function on URL: %s", httpUrl)
 	}
@@ -300,57 +452,140 @@ func executeHttpRequest(operation *FaasOperation, data []byte) ([]byte, error) {
 		_, err = operation.OnResphandler(resp)
 	} else {
 		if resp.StatusCode < 200 || resp.StatusCode > 299 {
-			err = fmt.Errorf("invalid return status %d while connecting %s", resp.StatusCode, httpUrl)
+			err = &StatusError{StatusCode: resp.StatusCode, Url: httpUrl}
 			result, _ = ioutil.ReadAll(resp.Body)
 		} else {
 			result, err = ioutil.ReadAll(resp.Body)
 		}
+		if err == nil {
+			result, err = operation.decodeOutput(resp.Header.Get("Content-Type"), result)
+		}
 	}
 	fmt.Printf("lib/openfaas/faas_operation.go::executeHttpRequest end")
 	return result, err
 
 }
 
+// invoke performs the upstream call of a function or a httpRequest
+func (operation *FaasOperation) invoke(reqId string, gateway string, data []byte) ([]byte, error) {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::invoke start")
+	// the templates read the payload of the flow, before its conversion
+	resolved, err := operation.resolve(data)
+	if err != nil {
+		return nil, err
+	}
+	data, err = operation.encodeInput(data)
+	if err != nil {
+		return nil, err
+	}
+	attempt := func(ctx context.Context) ([]byte, error) {
+		err := operation.waitRateLimit(ctx, gateway)
+		if err != nil {
+			return nil, err
+		}
+		return operation.withBulkhead(ctx, func() ([]byte, error) {
+			if operation.Function != "" {
+				return executeFunction(ctx, gateway, resolved, data)
+			}
+			return executeHttpRequest(ctx, resolved, data)
+		})
+	}
+	call := func() ([]byte, error) {
+		return operation.withHedge(reqId, attempt)
+	}
+
+	if !operation.Coalesce {
+		fmt.Printf("lib/openfaas/faas_operation.go::invoke end")
+		return call()
+	}
+
+	target := resolved.HttpRequestUrl
+	if operation.Function != "" {
+		target = buildURL("http://"+gateway, "function", operation.Function)
+	}
+	headers := resolved.GetHeaders()
+	key := coalesceKey(operation.coalesceScope(), target, getMethod(headers), data, resolved.GetParams(), headers)
+	result, shared, err := requestGroup.do(key, call)
+	if shared {
+		fmt.Printf("[Request `%s`] Coalesced call to `%s` with an in-flight request\n",
+			reqId, operation.GetId())
+	}
+	fmt.Printf("lib/openfaas/faas_operation.go::invoke end")
+	return result, err
+}
+
 func (operation *FaasOperation) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
 
 	fmt.Printf("lib/openfaas/faas_operation.go::Execute start")
+	// a skipped path or a routed failure passes through the vertex
+	if isMarker(data) {
+		return passMarker(data, operation.ErrorVertex)
+	}
+	reqId := fmt.Sprintf("%v", option["request-id"])
+	result, err := operation.execute(data, option)
+	if err != nil && operation.ErrorVertex != "" {
+		fmt.Printf("[Request `%s`] Routing failure of vertex `%s` to its error edge, %v\n",
+			reqId, operation.ErrorVertex, err)
+		return encodeFailure(operation.ErrorVertex, fallbackTarget(operation), data, err), nil
+	}
+	fmt.Printf("lib/openfaas/faas_operation.go::Execute end")
+	return result, err
+}
+
+// execute executes the operation
+func (operation *FaasOperation) execute(data []byte, option map[string]interface{}) ([]byte, error) {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::execute start")
 	var result []byte
 	var err error
 
 	reqId := fmt.Sprintf("%v", option["request-id"])
 	gateway := fmt.Sprintf("%v", option["gateway"])
+	// the failure handler swallowed the failure of the call
+	swallowed := false
 
 	switch {
 	// If function
 	case operation.Function != "":
 		fmt.Printf("[Request `%s`] Executing function `%s`\n",
 			reqId, operation.Function)
-		result, err = executeFunction(gateway, operation, data)
+		mirrors := operation.startMirror(reqId, gateway, data)
+		result, err = operation.invoke(reqId, gateway, data)
+		completeMirror(mirrors, reqId, operation.Function, result, err)
 		if err != nil {
-			err = fmt.Errorf("Function(%s), error: function execution failed, %v",
+			err = fmt.Errorf("Function(%s), error: function execution failed, %w",
 				operation.Function, err)
+			result, err = operation.fallback(reqId, gateway, data, result, err)
+		}
+		if err != nil {
 			if operation.FailureHandler != nil {
 				err = operation.FailureHandler(err)
 			}
 			if err != nil {
 				return nil, err
 			}
+			swallowed = true
 		}
 
 	// If httpRequest
 	case operation.HttpRequestUrl != "":
 		fmt.Printf("[Request `%s`] Executing httpRequest `%s`\n",
 			reqId, operation.HttpRequestUrl)
-		result, err = executeHttpRequest(operation, data)
+		result, err = operation.invoke(reqId, gateway, data)
 		if err != nil {
-			err = fmt.Errorf("HttpRequest(%s), error: httpRequest failed, %v",
+			err = fmt.Errorf("HttpRequest(%s), error: httpRequest failed, %w",
 				operation.HttpRequestUrl, err)
+			result, err = operation.fallback(reqId, gateway, data, result, err)
+		}
+		if err != nil {
 			if operation.FailureHandler != nil {
 				err = operation.FailureHandler(err)
 			}
 			if err != nil {
 				return nil, err
 			}
+			swallowed = true
 		}
 		if result == nil {
 			result = []byte("")
@@ -361,14 +596,22 @@ func (operation *FaasOperation) Execute(data []byte, option map[string]interface
 		fmt.Printf("[Request `%s`] Executing modifier\n", reqId)
 		result, err = operation.Mod(data)
 		if err != nil {
-			err = fmt.Errorf("error: Failed at modifier, %v", err)
+			err = fmt.Errorf("error: Failed at modifier, %w", err)
 			return nil, err
 		}
 		if result == nil {
 			result = []byte("")
 		}
 	}
-	fmt.Printf("lib/openfaas/faas_operation.go::Execute end")
+
+	// a failed call has nothing to undo
+	if operation.Compensation != nil && !swallowed {
+		err = operation.recordStep(option, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fmt.Printf("lib/openfaas/faas_operation.go::execute end")
 	return result, nil
 }
 
@@ -382,6 +625,16 @@ func (operation *FaasOperation) GetProperties() map[string][]string {
 	isHttpRequest := "false"
 	hasFailureHandler := "false"
 	hasResponseHandler := "false"
+	isCoalesced := "false"
+	isRateLimited := "false"
+	hasBulkhead := "false"
+	isIdempotent := "false"
+	isHedged := "false"
+	isMirrored := "false"
+	hasFallback := "false"
+	hasCompensation := "false"
+	hasCodec := "false"
+	isTemplated := "false"
 
 	if operation.Mod != nil {
 		isMod = "true"
@@ -398,12 +651,52 @@ func (operation *FaasOperation) GetProperties() map[string][]string {
 	if operation.OnResphandler != nil {
 		hasResponseHandler = "true"
 	}
+	if operation.Coalesce {
+		isCoalesced = "true"
+	}
+	if operation.RateLimit != nil && operation.RateLimit.Rps > 0 {
+		isRateLimited = "true"
+	}
+	if operation.MaxInFlight > 0 {
+		hasBulkhead = "true"
+	}
+	if operation.Idempotent {
+		isIdempotent = "true"
+	}
+	if operation.Hedge != nil {
+		isHedged = "true"
+	}
+	if len(operation.Mirrors) != 0 {
+		isMirrored = "true"
+	}
+	if len(operation.Fallbacks) != 0 {
+		hasFallback = "true"
+	}
+	if operation.Compensation != nil {
+		hasCompensation = "true"
+	}
+	if operation.Codec != nil {
+		hasCodec = "true"
+	}
+	if len(operation.templates) != 0 {
+		isTemplated = "true"
+	}
 
 	result["isMod"] = []string{isMod}
 	result["isFunction"] = []string{isFunction}
 	result["isHttpRequest"] = []string{isHttpRequest}
 	result["hasFailureHandler"] = []string{hasFailureHandler}
 	result["hasResponseHandler"] = []string{hasResponseHandler}
+	result["isCoalesced"] = []string{isCoalesced}
+	result["isRateLimited"] = []string{isRateLimited}
+	result["hasBulkhead"] = []string{hasBulkhead}
+	result["isIdempotent"] = []string{isIdempotent}
+	result["isHedged"] = []string{isHedged}
+	result["isMirrored"] = []string{isMirrored}
+	result["hasFallback"] = []string{hasFallback}
+	result["hasCompensation"] = []string{hasCompensation}
+	result["hasCodec"] = []string{hasCodec}
+	result["isTemplated"] = []string{isTemplated}
 
 	fmt.Printf("lib/openfaas/faas_operation.go::GetProperties end")
 	return result
@@ -416,83 +709,137 @@ func (node *Node) Modify(mod Modifier) *Node {
 
 	fmt.Printf("lib/openfaas/faas_operation.go::Modify start")
 	newMod := createModifier(mod)
-	node.unode.AddOperation(newMod)
+	node.addOperation(newMod)
 	fmt.Printf("lib/openfaas/faas_operation.go::Modify end")
 	return node
 }
 
-// Apply adds a new function to the given vertex
-func (node *Node) Apply(function string, opts ...Option) *Node {
-
-	fmt.Printf("lib/openfaas/faas_operation.go::Apply start")
-	newfunc := createFunction(function)
+// applyOptions applies the call options to the operation
+func (operation *FaasOperation) applyOptions(opts []Option) {
 
+	fmt.Printf("lib/openfaas/faas_operation.go::applyOptions start")
 	o := &Options{}
+	var mirrorTimeout *time.Duration
 	for _, opt := range opts {
 		o.reset()
 		opt(o)
 		if len(o.header) != 0 {
 			for key, value := range o.header {
-				newfunc.addheader(key, value)
+				operation.addheader(key, value)
 			}
 		}
 		if len(o.query) != 0 {
 			for key, array := range o.query {
 				for _, value := range array {
-					newfunc.addparam(key, value)
+					operation.addparam(key, value)
 				}
 			}
 		}
 		if o.failureHandler != nil {
-			newfunc.addFailureHandler(o.failureHandler)
+			operation.addFailureHandler(o.failureHandler)
 		}
 		if o.responseHandler != nil {
-			newfunc.addResponseHandler(o.responseHandler)
+			operation.addResponseHandler(o.responseHandler)
 		}
 		if o.requestHandler != nil {
-			newfunc.addRequestHandler(o.requestHandler)
+			operation.addRequestHandler(o.requestHandler)
+		}
+		if o.coalesce {
+			operation.enableCoalesce()
+		}
+		if o.rateLimitRps > 0 {
+			operation.addRateLimit(o.rateLimitRps, o.rateLimitBurst)
+		}
+		if o.rateLimitScope != "" {
+			operation.addRateLimitScope(o.rateLimitScope)
+		}
+		if o.rateLimitMaxWait != nil {
+			operation.addRateLimitMaxWait(*o.rateLimitMaxWait)
+		}
+		if o.maxInFlight > 0 {
+			operation.addMaxInFlight(o.maxInFlight)
+		}
+		if o.queueTimeout != nil {
+			operation.addQueueTimeout(*o.queueTimeout)
+		}
+		if o.idempotent {
+			operation.markIdempotent()
+		}
+		if o.hedgeMaxExtra > 0 {
+			operation.addHedge(o.hedgeAfter, o.hedgeMaxExtra)
+		}
+		if o.mirror != "" {
+			if operation.Function == "" {
+				panic(fmt.Sprintf("Error at %s, Mirror is only supported by functions", operation.targetKey()))
+			}
+			operation.addMirror(o.mirror, o.mirrorSampleRate, o.mirrorSink)
+		}
+		if o.mirrorTimeout != nil {
+			mirrorTimeout = o.mirrorTimeout
+		}
+		if o.fallback != nil {
+			operation.addFallback(o.fallback)
+		}
+		if o.fallbackOn != nil {
+			operation.addFallbackClassifier(o.fallbackOn)
+		}
+		if o.compensation != nil {
+			operation.addCompensation(o.compensation)
+		}
+		if o.payloadCodec != nil {
+			operation.addCodec(o.payloadCodec)
+		}
+		if o.flowCodec != nil {
+			operation.addFlowCodec(o.flowCodec)
+		}
+		if o.templateContext != nil {
+			operation.TemplateContext = o.templateContext
 		}
 	}
+	operation.addAccept()
+	operation.compileTemplates()
+
+	if mirrorTimeout != nil {
+		for _, policy := range operation.Mirrors {
+			policy.Timeout = *mirrorTimeout
+		}
+	}
+	if operation.MaxInFlight > 0 {
+		operation.registerBulkhead()
+	}
+	if operation.Hedge != nil && !operation.Idempotent {
+		panic(fmt.Sprintf("Error at %s, Hedge requires the operation to be Idempotent", operation.targetKey()))
+	}
+	if operation.FlowCodec != nil && operation.Codec == nil {
+		panic(fmt.Sprintf("Error at %s, ConvertFrom requires the Codec of the operation", operation.targetKey()))
+	}
+	fmt.Printf("lib/openfaas/faas_operation.go::applyOptions end")
+}
+
+// Apply adds a new function to the given vertex
+func (node *Node) Apply(function string, opts ...Option) *Node {
+
+	fmt.Printf("lib/openfaas/faas_operation.go::Apply start")
+	newfunc := createFunction(function)
+	newfunc.applyOptions(opts)
 
-	node.unode.AddOperation(newfunc)
+	node.addOperation(newfunc)
 	fmt.Printf("lib/openfaas/faas_operation.go::Apply end")
 	return node
 }
 
-// Request adds a new http Request to the given vertex
+// Request adds a new http Request to the given vertex. The url, the Header and the Query
+// values can be templates resolved per request, such as `https://api/x/{{.payload.id}}`,
+// with the JSON payload as .payload and the TemplateContext values as .ctx. The templates
+// are checked when the flow is defined, the values are escaped for the url path, the
+// query string or the header they are written to
 func (node *Node) Request(url string, opts ...Option) *Node {
 
 	fmt.Printf("lib/openfaas/faas_operation.go::Request start")
 	newHttpRequest := createHttpRequest(url)
+	newHttpRequest.applyOptions(opts)
 
-	o := &Options{}
-	for _, opt := range opts {
-		o.reset()
-		opt(o)
-		if len(o.header) != 0 {
-			for key, value := range o.header {
-				newHttpRequest.addheader(key, value)
-			}
-		}
-		if len(o.query) != 0 {
-			for key, array := range o.query {
-				for _, value := range array {
-					newHttpRequest.addparam(key, value)
-				}
-			}
-		}
-		if o.failureHandler != nil {
-			newHttpRequest.addFailureHandler(o.failureHandler)
-		}
-		if o.responseHandler != nil {
-			newHttpRequest.addResponseHandler(o.responseHandler)
-		}
-		if o.requestHandler != nil {
-			newHttpRequest.addRequestHandler(o.requestHandler)
-		}
-	}
-
-	node.unode.AddOperation(newHttpRequest)
+	node.addOperation(newHttpRequest)
 	fmt.Printf("lib/openfaas/faas_operation.go::Request end")
 	return node
 }
@@ -0,0 +1,177 @@
+package openfaas
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrorClassifier reports whether a failure is of a kind handled by an option
+type ErrorClassifier func(error) bool
+
+// FallbackAttempt a target of a fallback chain and its failure
+type FallbackAttempt struct {
+	Target string // The function, url or modifier attempted
+	Err    error  // The failure of the target
+}
+
+// FallbackError error of a fallback chain where every target failed
+type FallbackError struct {
+	Attempts []FallbackAttempt // The attempted targets in order, starting by the primary
+}
+
+func (err *FallbackError) Error() string {
+
+	chain := []string{}
+	for _, attempt := range err.Attempts {
+		chain = append(chain, fmt.Sprintf("%s: %v", attempt.Target, attempt.Err))
+	}
+	return fmt.Sprintf("fallback chain failed, [%s]", strings.Join(chain, "; "))
+}
+
+// Unwrap returns the failure of the primary target
+func (err *FallbackError) Unwrap() error {
+
+	if len(err.Attempts) == 0 {
+		return nil
+	}
+	return err.Attempts[0].Err
+}
+
+// FunctionFallback creates a fallback target executing a function
+func FunctionFallback(function string) *FaasOperation {
+
+	fmt.Println("lib/openfaas/fallback.go::FunctionFallback start")
+	if function == "" {
+		panic("Error at FunctionFallback, function not specified")
+	}
+	fmt.Println("lib/openfaas/fallback.go::FunctionFallback end")
+	return createFunction(function)
+}
+
+// ModifierFallback creates a fallback target executing a modifier,
+// such as one returning a default response
+func ModifierFallback(mod Modifier) *FaasOperation {
+
+	fmt.Println("lib/openfaas/fallback.go::ModifierFallback start")
+	if mod == nil {
+		panic("Error at ModifierFallback, modifier not specified")
+	}
+	fmt.Println("lib/openfaas/fallback.go::ModifierFallback end")
+	return createModifier(mod)
+}
+
+// parseTarget parses a target given as a function name, a Modifier or a
+// target created by FunctionFallback or ModifierFallback
+func parseTarget(at string, target interface{}) *FaasOperation {
+
+	fmt.Println("lib/openfaas/fallback.go::parseTarget start")
+	var operation *FaasOperation
+	switch value := target.(type) {
+	case string:
+		operation = FunctionFallback(value)
+	case *FaasOperation:
+		if value == nil || (value.Function == "" && value.Mod == nil) {
+			panic(fmt.Sprintf("Error at %s, invalid target", at))
+		}
+		operation = value
+	case Modifier:
+		operation = ModifierFallback(value)
+	case func([]byte) ([]byte, error):
+		operation = ModifierFallback(value)
+	default:
+		panic(fmt.Sprintf("Error at %s, unsupported target %T", at, target))
+	}
+	fmt.Println("lib/openfaas/fallback.go::parseTarget end")
+	return operation
+}
+
+// StatusClassifier classifies the calls failed with one of the status codes
+func StatusClassifier(codes ...int) ErrorClassifier {
+
+	fmt.Println("lib/openfaas/fallback.go::StatusClassifier start")
+	fmt.Println("lib/openfaas/fallback.go::StatusClassifier end")
+	return func(err error) bool {
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			return false
+		}
+		for _, code := range codes {
+			if statusErr.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ServerErrorClassifier classifies the calls failed with a 5xx status
+// or a network error, leaving out the client errors
+func ServerErrorClassifier() ErrorClassifier {
+
+	fmt.Println("lib/openfaas/fallback.go::ServerErrorClassifier start")
+	fmt.Println("lib/openfaas/fallback.go::ServerErrorClassifier end")
+	return func(err error) bool {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			return statusErr.StatusCode >= 500
+		}
+		var netErr net.Error
+		return errors.As(err, &netErr) ||
+			errors.Is(err, ERR_RATE_LIMITED) || errors.Is(err, ERR_BULKHEAD_FULL)
+	}
+}
+
+// fallbackTarget returns the name of a fallback target
+func fallbackTarget(operation *FaasOperation) string {
+
+	switch {
+	case operation.Function != "":
+		return "Function(" + operation.Function + ")"
+	case operation.HttpRequestUrl != "":
+		return "HttpRequest(" + operation.HttpRequestUrl + ")"
+	}
+	return "Modifier"
+}
+
+// fallback executes the fallbacks of the operation in order with the same
+// input after the primary call failed with err, until one succeeds or
+// fails with an error that isn't classified for fallback
+func (operation *FaasOperation) fallback(reqId string, gateway string, data []byte,
+	result []byte, err error) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/fallback.go::fallback start")
+	if len(operation.Fallbacks) == 0 {
+		return result, err
+	}
+
+	chain := &FallbackError{}
+	chain.Attempts = append(chain.Attempts, FallbackAttempt{Target: fallbackTarget(operation), Err: err})
+	for _, fallback := range operation.Fallbacks {
+		if operation.FallbackOn != nil && !operation.FallbackOn(err) {
+			fmt.Printf("[Request `%s`] Failure of `%s` not classified for fallback\n",
+				reqId, chain.Attempts[len(chain.Attempts)-1].Target)
+			break
+		}
+
+		target := fallbackTarget(fallback)
+		fmt.Printf("[Request `%s`] Falling back to %s\n", reqId, target)
+		if fallback.Mod != nil {
+			result, err = fallback.Mod(data)
+		} else {
+			result, err = fallback.invoke(reqId, gateway, data)
+		}
+		if err == nil {
+			if result == nil {
+				result = []byte("")
+			}
+			fmt.Println("lib/openfaas/fallback.go::fallback end")
+			return result, nil
+		}
+		chain.Attempts = append(chain.Attempts, FallbackAttempt{Target: target, Err: err})
+	}
+
+	fmt.Println("lib/openfaas/fallback.go::fallback end")
+	return nil, chain
+}
@@ -0,0 +1,186 @@
+package openfaas
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fallbackServer serves the functions with the status of their name, such as
+// /function/s503, and records the order of the calls
+type fallbackServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	calls []string
+}
+
+func newFallbackServer(t *testing.T) *fallbackServer {
+
+	server := &fallbackServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		function := strings.TrimPrefix(r.URL.Path, "/function/")
+		server.mu.Lock()
+		server.calls = append(server.calls, function)
+		server.mu.Unlock()
+		status, _ := strconv.Atoi(strings.TrimPrefix(function, "s"))
+		w.WriteHeader(status)
+		w.Write([]byte(function))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// execute executes a call of function with opts
+func (server *fallbackServer) execute(function string, opts ...Option) ([]byte, error) {
+
+	operation := createFunction(function)
+	operation.applyOptions(opts)
+	return operation.execute([]byte(`{}`), map[string]interface{}{"request-id": "r",
+		"gateway": strings.TrimPrefix(server.URL, "http://")})
+}
+
+func TestFallbackChain(t *testing.T) {
+
+	defaultResponse := ModifierFallback(func(data []byte) ([]byte, error) { return []byte("default"), nil })
+	tests := []struct {
+		name    string
+		primary string
+		opts    []Option
+		result  string
+		calls   []string
+	}{
+		{"primary succeeds", "s201", []Option{Fallback("s200")}, "s201", []string{"s201"}},
+		{"first fallback", "s503", []Option{Fallback("s200"), Fallback("s202")}, "s200", []string{"s503", "s200"}},
+		{"fallbacks in order", "s503", []Option{Fallback("s500"), Fallback(FunctionFallback("s404")), Fallback("s202")},
+			"s202", []string{"s503", "s500", "s404", "s202"}},
+		{"modifier fallback", "s503", []Option{Fallback("s500"), Fallback(defaultResponse)},
+			"default", []string{"s503", "s500"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFallbackServer(t)
+			result, err := server.execute(test.primary, test.opts...)
+			if err != nil || string(result) != test.result {
+				t.Fatalf("expected %s, got %s, %v", test.result, result, err)
+			}
+			if strings.Join(server.calls, ",") != strings.Join(test.calls, ",") {
+				t.Fatalf("expected the calls %v, got %v", test.calls, server.calls)
+			}
+		})
+	}
+}
+
+func TestFallbackError(t *testing.T) {
+
+	server := newFallbackServer(t)
+	_, err := server.execute("s503", Fallback("s500"), Fallback(ModifierFallback(func(data []byte) ([]byte, error) {
+		return nil, fmt.Errorf("no default")
+	})))
+	var chain *FallbackError
+	if !errors.As(err, &chain) || len(chain.Attempts) != 3 {
+		t.Fatalf("expected a FallbackError of 3 attempts, got %v", err)
+	}
+	targets := []string{"Function(s503)", "Function(s500)", "Modifier"}
+	for i, attempt := range chain.Attempts {
+		if attempt.Target != targets[i] {
+			t.Fatalf("expected the attempt %d at %s, got %s", i, targets[i], attempt.Target)
+		}
+	}
+	// the chain unwraps to the failure of the primary
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 503 {
+		t.Fatalf("expected the status of the primary, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "fallback chain failed, [Function(s503): ") ||
+		!strings.Contains(err.Error(), "; Modifier: no default]") {
+		t.Fatalf("unexpected message %s", err.Error())
+	}
+}
+
+func TestFallbackOn(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		primary string
+		opts    []Option
+		calls   []string
+		failed  bool
+	}{
+		{"classified status", "s503", []Option{FallbackOn(StatusClassifier(503)), Fallback("s200")},
+			[]string{"s503", "s200"}, false},
+		{"status not classified", "s500", []Option{FallbackOn(StatusClassifier(503)), Fallback("s200")},
+			[]string{"s500"}, true},
+		{"server error", "s502", []Option{FallbackOn(ServerErrorClassifier()), Fallback("s200")},
+			[]string{"s502", "s200"}, false},
+		{"client error", "s400", []Option{FallbackOn(ServerErrorClassifier()), Fallback("s200")},
+			[]string{"s400"}, true},
+		{"failure of a fallback not classified", "s503",
+			[]Option{FallbackOn(StatusClassifier(503)), Fallback("s404"), Fallback("s200")},
+			[]string{"s503", "s404"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFallbackServer(t)
+			_, err := server.execute(test.primary, test.opts...)
+			if (err != nil) != test.failed {
+				t.Fatalf("expected the call to fail %v, got %v", test.failed, err)
+			}
+			if strings.Join(server.calls, ",") != strings.Join(test.calls, ",") {
+				t.Fatalf("expected the calls %v, got %v", test.calls, server.calls)
+			}
+		})
+	}
+}
+
+func TestServerErrorClassifier(t *testing.T) {
+
+	classify := ServerErrorClassifier()
+	tests := []struct {
+		name string
+		err  error
+		ok   bool
+	}{
+		{"server status", &StatusError{StatusCode: 500}, true},
+		{"client status", fmt.Errorf("call failed, %w", &StatusError{StatusCode: 429}), false},
+		{"network error", &net.OpError{Op: "dial", Err: fmt.Errorf("refused")}, true},
+		{"rate limited", fmt.Errorf("call failed, %w", ERR_RATE_LIMITED), true},
+		{"bulkhead full", ERR_BULKHEAD_FULL, true},
+		{"other error", fmt.Errorf("invalid input"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if ok := classify(test.err); ok != test.ok {
+				t.Fatalf("expected %v, got %v", test.ok, ok)
+			}
+		})
+	}
+}
+
+func TestFallbackDefinition(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		target interface{}
+		err    string
+	}{
+		{"no function", "", "Error at FunctionFallback, function not specified"},
+		{"invalid target", &FaasOperation{}, "Error at Fallback, invalid target"},
+		{"unsupported target", 1, "Error at Fallback, unsupported target int"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), test.err) {
+					t.Fatalf("expected panic %q, got %v", test.err, r)
+				}
+			}()
+			Fallback(test.target)
+		})
+	}
+}
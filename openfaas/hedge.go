@@ -0,0 +1,148 @@
+package openfaas
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// hedges is the process wide registry of hedging metrics by target
+	hedges = &hedgeRegistry{stats: make(map[string]*HedgeStats)}
+)
+
+// HedgePolicy hedging applied to an idempotent operation
+type HedgePolicy struct {
+	After    time.Duration // The delay before issuing a duplicate call
+	MaxExtra int           // The maximum duplicate calls
+}
+
+// HedgeStats metrics of the hedged calls of a target
+type HedgeStats struct {
+	Target   string  // The function or url the calls are made to
+	Calls    int64   // Hedged calls made
+	Failures int64   // Hedged calls where every attempt failed
+	Wins     []int64 // Calls won by each attempt, index 0 is the original call
+}
+
+// hedgeResult the result of an attempt
+type hedgeResult struct {
+	attempt int
+	result  []byte
+	err     error
+}
+
+// hedgeRegistry process wide hedging metrics
+type hedgeRegistry struct {
+	mu    sync.Mutex
+	stats map[string]*HedgeStats
+}
+
+// record records the outcome of a hedged call, winner is the
+// index of the winning attempt or -1 if every attempt failed
+func (registry *hedgeRegistry) record(target string, attempts int, winner int) {
+
+	fmt.Println("lib/openfaas/hedge.go::hedgeRegistry::record start")
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	stats, ok := registry.stats[target]
+	if !ok {
+		stats = &HedgeStats{Target: target}
+		registry.stats[target] = stats
+	}
+	for len(stats.Wins) < attempts {
+		stats.Wins = append(stats.Wins, 0)
+	}
+	stats.Calls++
+	if winner < 0 {
+		stats.Failures++
+	} else {
+		stats.Wins[winner]++
+	}
+	fmt.Println("lib/openfaas/hedge.go::hedgeRegistry::record end")
+}
+
+// GetHedgeStats returns the hedging metrics of all the hedged targets of the process
+func GetHedgeStats() []HedgeStats {
+
+	fmt.Println("lib/openfaas/hedge.go::GetHedgeStats start")
+	hedges.mu.Lock()
+	result := make([]HedgeStats, 0, len(hedges.stats))
+	for _, stats := range hedges.stats {
+		copied := *stats
+		copied.Wins = append([]int64{}, stats.Wins...)
+		result = append(result, copied)
+	}
+	hedges.mu.Unlock()
+	sort.Slice(result, func(i, j int) bool { return result[i].Target < result[j].Target })
+	fmt.Println("lib/openfaas/hedge.go::GetHedgeStats end")
+	return result
+}
+
+// withHedge executes call, issuing a duplicate call each time no attempt has
+// responded within After, until MaxExtra duplicates are made. The first
+// successful response is returned and the outstanding attempts are cancelled,
+// the call fails as soon as every attempt issued so far has failed
+func (operation *FaasOperation) withHedge(reqId string, call func(context.Context) ([]byte, error)) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/hedge.go::withHedge start")
+	policy := operation.Hedge
+	if policy == nil || policy.MaxExtra <= 0 {
+		return call(context.Background())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	maxAttempts := 1 + policy.MaxExtra
+	results := make(chan hedgeResult, maxAttempts)
+	launched := 0
+	finished := 0
+	launch := func() {
+		attempt := launched
+		launched++
+		if attempt > 0 {
+			fmt.Printf("[Request `%s`] Hedging call to `%s`, attempt %d\n",
+				reqId, operation.GetId(), attempt+1)
+		}
+		go func() {
+			result, err := call(ctx)
+			results <- hedgeResult{attempt: attempt, result: result, err: err}
+		}()
+	}
+
+	launch()
+	timer := time.NewTimer(policy.After)
+	defer timer.Stop()
+
+	target := operation.targetKey()
+	var err error
+	for {
+		select {
+		case <-timer.C:
+			if launched < maxAttempts {
+				launch()
+				timer.Reset(policy.After)
+			}
+
+		case res := <-results:
+			finished++
+			if res.err == nil {
+				hedges.record(target, maxAttempts, res.attempt)
+				fmt.Printf("[Request `%s`] Hedged call to `%s` won by attempt %d\n",
+					reqId, operation.GetId(), res.attempt+1)
+				fmt.Println("lib/openfaas/hedge.go::withHedge end")
+				return res.result, nil
+			}
+			err = res.err
+			if finished < launched {
+				continue
+			}
+			// every attempt made so far failed, the duplicates are only issued on delay
+			hedges.record(target, maxAttempts, -1)
+			return nil, fmt.Errorf("all %d hedged attempts failed, last error: %w", launched, err)
+		}
+	}
+}
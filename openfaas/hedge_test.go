@@ -0,0 +1,87 @@
+package openfaas
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func hedgedOperation(function string, after time.Duration, maxExtra int) *FaasOperation {
+
+	operation := createFunction(function)
+	operation.applyOptions([]Option{Idempotent(), Hedge(after, maxExtra)})
+	return operation
+}
+
+func TestHedgeDuplicateWinsAfterDelay(t *testing.T) {
+
+	operation := hedgedOperation("hedge-win", 10*time.Millisecond, 2)
+	var attempts int32
+	result, err := operation.withHedge("request", func(ctx context.Context) ([]byte, error) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return []byte("duplicate"), nil
+	})
+	if err != nil || string(result) != "duplicate" {
+		t.Fatalf("expected the duplicate to win, got %q, %v", result, err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestHedgeFailureIsNotRetried(t *testing.T) {
+
+	operation := hedgedOperation("hedge-failure", 50*time.Millisecond, 3)
+	var attempts int32
+	status := &StatusError{StatusCode: 400, Url: "http://gateway/function/hedge-failure"}
+	start := time.Now()
+	_, err := operation.withHedge("request", func(ctx context.Context) ([]byte, error) {
+		atomic.AddInt32(&attempts, 1)
+		return nil, status
+	})
+	if attempts != 1 {
+		t.Fatalf("expected a single attempt for a failed call, got %d", attempts)
+	}
+	if time.Since(start) >= 50*time.Millisecond {
+		t.Fatalf("expected the failure returned before the hedge delay")
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 400 {
+		t.Fatalf("expected the status error of the attempt, got %v", err)
+	}
+}
+
+func TestHedgeWaitsForOutstandingAttempts(t *testing.T) {
+
+	operation := hedgedOperation("hedge-outstanding", 10*time.Millisecond, 1)
+	var attempts int32
+	result, err := operation.withHedge("request", func(ctx context.Context) ([]byte, error) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			time.Sleep(30 * time.Millisecond)
+			return []byte("original"), nil
+		}
+		return nil, errors.New("duplicate failed")
+	})
+	if err != nil || string(result) != "original" {
+		t.Fatalf("expected the original to win after the duplicate failed, got %q, %v", result, err)
+	}
+}
+
+func TestHedgeAllAttemptsFailed(t *testing.T) {
+
+	operation := hedgedOperation("hedge-all-failed", 5*time.Millisecond, 2)
+	var attempts int32
+	_, err := operation.withHedge("request", func(ctx context.Context) ([]byte, error) {
+		atomic.AddInt32(&attempts, 1)
+		time.Sleep(20 * time.Millisecond)
+		return nil, errors.New("failed")
+	})
+	if err == nil || attempts != 3 {
+		t.Fatalf("expected 3 failed attempts, got %d, %v", attempts, err)
+	}
+}
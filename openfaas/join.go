@@ -0,0 +1,420 @@
+package openfaas
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+	"github.com/Abhishekghosh1998/faasflow-sdk/executor"
+)
+
+const (
+	// joinRadix the radix of the encoded join counters, it bounds the inputs of a join
+	joinRadix = 1 << 16
+	// joinFired the join counter once the join executed, below the encoded counters
+	// of the joins waiting, the increments of the late inputs keep it there
+	joinFired = -joinRadix * joinRadix * joinRadix
+)
+
+var (
+	// joinRuntime is set once the executor is wrapped with JoiningExecutor
+	joinRuntime bool
+	// joinLock guards the joinRuntime
+	joinLock sync.RWMutex
+)
+
+// joinPolicy the inputs a join vertex executes with
+type joinPolicy struct {
+	vertex string // the join vertex
+	count  int    // the inputs the join executes with, 0 is all
+}
+
+// joinGate marks a join vertex with its policy, it passes its input on
+type joinGate struct {
+	policy *joinPolicy
+}
+
+// joiningExecutor an executor executing the joins with WaitAny and WaitN
+type joiningExecutor struct {
+	executor.Executor
+	store sdk.StateStore // the StateStore of the request
+}
+
+// JoiningExecutor wraps the executor of a request so that the joins with WaitAny and WaitN
+// execute once enough inputs arrived. Each time the flow is defined it counts the inputs
+// of the joins in the in-degree counters the executor keeps in its StateStore, so that the
+// executor forwards the join once, and the inputs which didn't arrive are left out of it
+func JoiningExecutor(exec executor.Executor) executor.Executor {
+
+	fmt.Println("lib/openfaas/join.go::JoiningExecutor start")
+	joinLock.Lock()
+	defer joinLock.Unlock()
+	joinRuntime = true
+	fmt.Println("lib/openfaas/join.go::JoiningExecutor end")
+	return &joiningExecutor{Executor: exec}
+}
+
+func (exec *joiningExecutor) GetStateStore() (sdk.StateStore, error) {
+
+	// the executor configures the store for the request
+	store, err := exec.Executor.GetStateStore()
+	exec.store = store
+	return store, err
+}
+
+// checkJoinRuntime checks that the executor executes the joins of policy
+func checkJoinRuntime(policy *joinPolicy) {
+
+	joinLock.RLock()
+	defer joinLock.RUnlock()
+	if !joinRuntime {
+		panic(fmt.Sprintf("Error at Node for %s, no runtime executes the join before every input arrived, "+
+			"wrap the executor with JoiningExecutor", policy.vertex))
+	}
+}
+
+func (exec *joiningExecutor) GetFlowDefinition(pipeline *sdk.Pipeline, context *sdk.Context) error {
+
+	fmt.Println("lib/openfaas/join.go::GetFlowDefinition start")
+	err := exec.Executor.GetFlowDefinition(pipeline, context)
+	if err != nil {
+		return err
+	}
+	// the unique ids of the vertices name the counters
+	err = pipeline.Dag.Validate()
+	if err != nil || exec.store == nil {
+		// the executor fails the request
+		return err
+	}
+	fmt.Println("lib/openfaas/join.go::GetFlowDefinition end")
+	return executeJoins(pipeline, context, exec.store)
+}
+
+// executeJoins counts the inputs of the joins of the flow, it creates the counters of
+// the joins of the dags starting with the execution, and leaves the inputs which didn't
+// arrive out of the join executing
+func executeJoins(pipeline *sdk.Pipeline, context *sdk.Context, store sdk.StateStore) error {
+
+	fmt.Println("lib/openfaas/join.go::executeJoins start")
+	err := countJoins(pipeline, pipeline.Dag, store)
+	if err != nil {
+		return err
+	}
+
+	// the execution is positioned in a copy, the executor positions the new requests itself
+	position := &sdk.Pipeline{Dag: pipeline.Dag, ExecutionDepth: pipeline.ExecutionDepth,
+		ExecutionPosition: make(map[string]string), CurrentDynamicOption: pipeline.CurrentDynamicOption}
+	for depth, vertex := range pipeline.ExecutionPosition {
+		position.ExecutionPosition[depth] = vertex
+	}
+	node, dag := pipeline.Dag.GetInitialNode(), pipeline.Dag
+	if position.ExecutionPosition["0"] == "" {
+		position.ExecutionPosition["0"] = node.Id
+	} else {
+		node, dag = position.GetCurrentNodeDag()
+		skipMissingInputs(position, node, context)
+	}
+	// the sub-dags of the vertex start with it
+	for {
+		if node == dag.GetInitialNode() {
+			err = initJoins(position, dag, store)
+			if err != nil {
+				return err
+			}
+		}
+		if node.Dynamic() || node.SubDag() == nil {
+			break
+		}
+		dag = node.SubDag()
+		node = dag.GetInitialNode()
+		position.UpdatePipelineExecutionPosition(sdk.DEPTH_INCREMENT, node.Id)
+	}
+	fmt.Println("lib/openfaas/join.go::executeJoins end")
+	return nil
+}
+
+// joinOf returns the policy of a join vertex, nil for a vertex joining every input
+func joinOf(node *sdk.Node) *joinPolicy {
+
+	for _, operation := range node.Operations() {
+		if gate, ok := operation.(*joinGate); ok && gate.policy.count != 0 {
+			return gate.policy
+		}
+	}
+	return nil
+}
+
+// dagNodes returns the vertices of dag
+func dagNodes(dag *sdk.Dag) []*sdk.Node {
+
+	nodes := []*sdk.Node{}
+	visited := make(map[string]bool)
+	pending := []*sdk.Node{dag.GetInitialNode()}
+	for len(pending) != 0 {
+		node := pending[0]
+		pending = pending[1:]
+		if node == nil || visited[node.Id] {
+			continue
+		}
+		visited[node.Id] = true
+		nodes = append(nodes, node)
+		pending = append(pending, node.Children()...)
+	}
+	return nodes
+}
+
+// countJoins wraps the forwarders of the inputs of the joins of dag and its sub-dags
+func countJoins(pipeline *sdk.Pipeline, dag *sdk.Dag, store sdk.StateStore) error {
+
+	for _, node := range dagNodes(dag) {
+		if node.SubDag() != nil {
+			err := countJoins(pipeline, node.SubDag(), store)
+			if err != nil {
+				return err
+			}
+		}
+		for _, conditional := range node.GetAllConditionalDags() {
+			err := countJoins(pipeline, conditional, store)
+			if err != nil {
+				return err
+			}
+		}
+		policy := joinOf(node)
+		if policy == nil {
+			continue
+		}
+		for _, dependency := range node.Dependency() {
+			forwarder := dependency.GetForwarder(node.Id)
+			if forwarder == nil {
+				return fmt.Errorf("Join(%s), error: the input of %s isn't forwarded, it can't be counted",
+					policy.vertex, dependency.Id)
+			}
+			dependency.AddForwarder(node.Id, policy.forwarder(pipeline, store, dependency, node, forwarder))
+		}
+	}
+	return nil
+}
+
+// initJoins creates the counters of the joins of the dag starting at position
+func initJoins(position *sdk.Pipeline, dag *sdk.Dag, store sdk.StateStore) error {
+
+	for _, node := range dagNodes(dag) {
+		policy := joinOf(node)
+		if policy == nil {
+			continue
+		}
+		err := policy.init(store, position.GetNodeExecutionUniqueId(node), node.Indegree())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipMissingInputs leaves the inputs which didn't arrive out of the join executing at position,
+// the executor only aggregates the inputs with a forwarder
+func skipMissingInputs(position *sdk.Pipeline, node *sdk.Node, context *sdk.Context) {
+
+	if joinOf(node) == nil {
+		return
+	}
+	for _, dependency := range node.Dependency() {
+		key := fmt.Sprintf("%s--%s", position.GetNodeExecutionUniqueId(dependency), node.GetUniqueId())
+		if _, err := context.Get(key); err != nil {
+			fmt.Printf("Join(%s), input of %s didn't arrive\n", node.Id, dependency.Id)
+			dependency.AddForwarder(node.Id, nil)
+		}
+	}
+}
+
+// init creates the counter of the join at key for its inputs, a counter already
+// created is left as is. The counter starts encoded as
+//
+//	-joinRadix * (joinRadix * inputs + count)
+//
+// it keeps the inputs to arrive and the inputs the join waits for, the increments of
+// the executor add to it. Once the join waits for no more inputs it is the in-degree of
+// the join minus the pending increments
+func (policy *joinPolicy) init(store sdk.StateStore, key string, inputs int) error {
+
+	fmt.Println("lib/openfaas/join.go::joinPolicy::init start")
+	if inputs >= joinRadix {
+		return fmt.Errorf("Join(%s), error: %d inputs, at most %d", policy.vertex, inputs, joinRadix-1)
+	}
+	encoded, err := store.Get(key)
+	if err == nil && encoded != "" {
+		return nil
+	}
+	count := policy.count
+	if count > inputs {
+		count = inputs
+	}
+	err = store.Set(key, strconv.FormatInt(-joinRadix*(joinRadix*int64(inputs)+int64(count)), 10))
+	if err != nil {
+		return fmt.Errorf("Join(%s), error: failed to create the counter %s, %v", policy.vertex, key, err)
+	}
+	fmt.Println("lib/openfaas/join.go::joinPolicy::init end")
+	return nil
+}
+
+// arrive counts an input at the join counter at key before the executor increments it.
+// An input decrements the inputs to arrive and, unless skipped or failed, the inputs the
+// join waits for. Once the join waits for no more inputs, or every input arrived, the
+// last pending increment forwards the join. The later inputs are late: they cancel their
+// increment, or mark the counter as fired once the join was forwarded
+func (policy *joinPolicy) arrive(store sdk.StateStore, key string, inputs int, marker bool) (late bool, err error) {
+
+	fmt.Println("lib/openfaas/join.go::joinPolicy::arrive start")
+	for i := 0; i < stateUpdateRetries; i++ {
+		encoded, err := store.Get(key)
+		if err != nil {
+			return false, fmt.Errorf("no counter for %s, %v", key, err)
+		}
+		counter, err := strconv.ParseInt(encoded, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid counter %q of %s, %v", encoded, key, err)
+		}
+
+		var next int64
+		switch {
+		case counter < joinFired+joinRadix:
+			return true, nil
+		case counter >= int64(inputs):
+			next, late = joinFired, true
+		case counter >= 0:
+			next, late = counter-1, true
+		default:
+			state := (-counter + joinRadix - 1) / joinRadix
+			landed := counter + state*joinRadix
+			arriving, waiting := state/joinRadix-1, state%joinRadix
+			if !marker {
+				waiting--
+			}
+			next = -joinRadix*(joinRadix*arriving+waiting) + landed
+			if waiting == 0 || arriving == 0 {
+				next = arriving + landed
+			}
+		}
+		if store.Update(key, encoded, strconv.FormatInt(next, 10)) == nil {
+			fmt.Println("lib/openfaas/join.go::joinPolicy::arrive end")
+			return late, nil
+		}
+	}
+	return false, fmt.Errorf("failed to update counter %s after %d attempts", key, stateUpdateRetries)
+}
+
+// forwarder counts the inputs forwarded by the dependency to the join, the late
+// inputs are forwarded as skipped
+func (policy *joinPolicy) forwarder(pipeline *sdk.Pipeline, store sdk.StateStore, dependency *sdk.Node,
+	join *sdk.Node, forwarder sdk.Forwarder) sdk.Forwarder {
+
+	return func(data []byte) []byte {
+
+		fmt.Println("lib/openfaas/join.go::joinPolicy::forwarder start")
+		data = forwarder(data)
+		late, err := policy.arrive(store, pipeline.GetNodeExecutionUniqueId(join), join.Indegree(),
+			isFailure(data) || IsSkipped(data))
+		if err != nil {
+			err = fmt.Errorf("Join(%s), error: failed to count input of %s, %v", policy.vertex, dependency.Id, err)
+			fmt.Println(err)
+			return encodeFailure(dependency.Id, "join", data, err)
+		}
+		if late {
+			fmt.Printf("Join(%s), input of %s arrived late\n", policy.vertex, dependency.Id)
+			return skippedPayload
+		}
+		fmt.Println("lib/openfaas/join.go::joinPolicy::forwarder end")
+		return data
+	}
+}
+
+// joinNode sets the join policy and the aggregator of node, without aggregator
+// a join waiting for one input passes it on
+func joinNode(node *sdk.Node, policy *joinPolicy, aggregator sdk.Aggregator) {
+
+	fmt.Println("lib/openfaas/join.go::joinNode start")
+	switch {
+	case policy.count == 0 && aggregator != nil:
+		node.AddAggregator(skipAwareAggregator(aggregator))
+	case policy.count != 0:
+		checkJoinRuntime(policy)
+		if aggregator == nil && policy.count > 1 {
+			panic(fmt.Sprintf("Error at Node for %s, aggregator not specified for WaitN(%d)",
+				policy.vertex, policy.count))
+		}
+		if aggregator == nil {
+			aggregator = firstInput
+		}
+		node.AddAggregator(joinAggregator(aggregator))
+	}
+	for _, operation := range node.Operations() {
+		if gate, ok := operation.(*joinGate); ok {
+			gate.policy = policy
+			return
+		}
+	}
+	node.AddOperation(&joinGate{policy: policy})
+	fmt.Println("lib/openfaas/join.go::joinNode end")
+}
+
+// joinAggregator aggregates the inputs of a join which weren't skipped and didn't fail,
+// without such inputs a caught failure is passed on, otherwise the join is skipped
+func joinAggregator(aggregator sdk.Aggregator) sdk.Aggregator {
+
+	return func(inputs map[string][]byte) ([]byte, error) {
+		taken := make(map[string][]byte)
+		for key, data := range inputs {
+			if !isFailure(data) && !IsSkipped(data) {
+				taken[key] = data
+			}
+		}
+		if len(taken) == 0 {
+			return skipAwareAggregator(aggregator)(inputs)
+		}
+		return aggregator(taken)
+	}
+}
+
+// firstInput passes on the input of a join waiting for one input
+func firstInput(inputs map[string][]byte) ([]byte, error) {
+
+	for _, data := range inputs {
+		return data, nil
+	}
+	return []byte(""), nil
+}
+
+func (gate *joinGate) GetId() string {
+
+	fmt.Println("lib/openfaas/join.go::GetId start")
+	fmt.Println("lib/openfaas/join.go::GetId end")
+	return "join-" + gate.policy.vertex
+}
+
+func (gate *joinGate) Encode() []byte {
+
+	fmt.Println("lib/openfaas/join.go::Encode start")
+	fmt.Println("lib/openfaas/join.go::Encode end")
+	return []byte("")
+}
+
+func (gate *joinGate) GetProperties() map[string][]string {
+
+	fmt.Println("lib/openfaas/join.go::GetProperties start")
+	result := make(map[string][]string)
+	result["isMod"] = []string{"true"}
+	result["isFunction"] = []string{"false"}
+	result["isHttpRequest"] = []string{"false"}
+	result["isJoin"] = []string{"true"}
+	result["waitFor"] = []string{strconv.Itoa(gate.policy.count)}
+	fmt.Println("lib/openfaas/join.go::GetProperties end")
+	return result
+}
+
+func (gate *joinGate) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/join.go::Execute start")
+	fmt.Println("lib/openfaas/join.go::Execute end")
+	return data, nil
+}
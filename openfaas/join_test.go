@@ -0,0 +1,332 @@
+package openfaas
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+	"github.com/Abhishekghosh1998/faasflow-sdk/executor"
+)
+
+// definingExecutor an executor defining the flow with define, its StateStore is store
+type definingExecutor struct {
+	executor.Executor
+	store  *memoryStore
+	define func(flow *Workflow)
+}
+
+func (exec *definingExecutor) GetStateStore() (sdk.StateStore, error) {
+
+	return exec.store, nil
+}
+
+func (exec *definingExecutor) GetFlowDefinition(pipeline *sdk.Pipeline, context *sdk.Context) error {
+
+	exec.define(GetWorkflow(pipeline))
+	return nil
+}
+
+// joinTest returns an executor defining the flow with define wrapped with JoiningExecutor
+func joinTest(t *testing.T, store *memoryStore, define func(flow *Workflow)) executor.Executor {
+
+	exec := JoiningExecutor(&definingExecutor{store: store, define: define})
+	if _, err := exec.GetStateStore(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	t.Cleanup(func() {
+		joinLock.Lock()
+		joinRuntime = false
+		joinLock.Unlock()
+	})
+	return exec
+}
+
+// executorIncrement increments the in-degree counter at key as the executor does
+func executorIncrement(store *memoryStore, key string) int {
+
+	for {
+		encoded, err := store.Get(key)
+		if err != nil {
+			store.Set(key, "1")
+			return 1
+		}
+		current, _ := strconv.Atoi(encoded)
+		if store.Update(key, encoded, strconv.Itoa(current+1)) == nil {
+			return current + 1
+		}
+	}
+}
+
+// joinRun the inputs arriving at a join as the executor forwards them: the input is
+// counted, stored, then the in-degree counter is incremented
+type joinRun struct {
+	policy *joinPolicy
+	store  *memoryStore
+	inputs int
+
+	mu     sync.Mutex
+	stored map[string][]byte
+	fired  int               // the forwards of the join
+	joined map[string][]byte // the inputs stored once the join was forwarded
+}
+
+func newJoinRun(t *testing.T, count int, inputs int) *joinRun {
+
+	run := &joinRun{policy: &joinPolicy{vertex: "join", count: count}, store: newMemoryStore(),
+		inputs: inputs, stored: make(map[string][]byte)}
+	if err := run.policy.init(run.store, "join", inputs); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return run
+}
+
+func (run *joinRun) arrive(t *testing.T, dependency string, data []byte, yield bool) {
+
+	late, err := run.policy.arrive(run.store, "join", run.inputs, isFailure(data) || IsSkipped(data))
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+		return
+	}
+	if late {
+		data = skippedPayload
+	}
+	run.mu.Lock()
+	run.stored[dependency] = data
+	run.mu.Unlock()
+	if yield {
+		runtime.Gosched()
+	}
+	if executorIncrement(run.store, "join") >= run.inputs {
+		run.mu.Lock()
+		run.fired++
+		run.joined = make(map[string][]byte)
+		for key, value := range run.stored {
+			run.joined[key] = value
+		}
+		run.mu.Unlock()
+	}
+}
+
+// joinKeys aggregates the inputs of a join as the sorted list of their vertices
+func joinKeys(inputs map[string][]byte) ([]byte, error) {
+
+	keys := []string{}
+	for key, data := range inputs {
+		keys = append(keys, key+"="+string(data))
+	}
+	sort.Strings(keys)
+	return []byte(strings.Join(keys, ",")), nil
+}
+
+func TestJoinCounter(t *testing.T) {
+
+	failure := encodeFailure("a", "Modifier", nil, fmt.Errorf("unavailable"))
+	tests := []struct {
+		name     string
+		count    int
+		arrivals []string // the inputs in the order they arrive, `-` is skipped and `!` failed
+		firedAt  int      // the arrival forwarding the join
+		result   string
+	}{
+		{"first input wins", 1, []string{"a", "b", "c"}, 1, "a=a"},
+		{"first inputs win", 2, []string{"c", "a", "b"}, 2, "a=a,c=c"},
+		{"skipped input doesn't win", 1, []string{"-a", "b", "c"}, 2, "b=b"},
+		{"failure doesn't win", 1, []string{"!a", "b", "c"}, 2, "b=b"},
+		{"every input skipped", 1, []string{"-a", "-b", "-c"}, 3, string(skippedPayload)},
+		{"not enough inputs", 2, []string{"a", "-b", "-c"}, 3, "a=a"},
+		{"every input failed", 1, []string{"!a", "-b", "-c"}, 3, string(failure)},
+		{"count above the inputs", 5, []string{"b", "a", "c"}, 3, "a=a,b=b,c=c"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			run := newJoinRun(t, test.count, len(test.arrivals))
+			for i, arrival := range test.arrivals {
+				data := []byte(arrival)
+				switch arrival[0] {
+				case '-':
+					arrival, data = arrival[1:], skippedPayload
+				case '!':
+					arrival, data = arrival[1:], failure
+				}
+				run.arrive(t, arrival, data, false)
+				if fired := i+1 >= test.firedAt; (run.fired == 1) != fired {
+					t.Fatalf("expected the join forwarded %v after %d inputs, forwarded %d times", fired, i+1, run.fired)
+				}
+			}
+			result, err := joinAggregator(joinKeys)(run.joined)
+			if err != nil || string(result) != test.result {
+				t.Fatalf("expected %s, got %s, %v", test.result, result, err)
+			}
+		})
+	}
+}
+
+func TestJoinCounterConcurrentInputs(t *testing.T) {
+
+	for i := 0; i < 200; i++ {
+		run := newJoinRun(t, 3, 8)
+		var wg sync.WaitGroup
+		for input := 0; input < run.inputs; input++ {
+			wg.Add(1)
+			go func(input int) {
+				defer wg.Done()
+				run.arrive(t, strconv.Itoa(input), []byte("data"), input%2 == 0)
+			}(input)
+		}
+		wg.Wait()
+
+		joined := 0
+		for _, data := range run.joined {
+			if !IsSkipped(data) {
+				joined++
+			}
+		}
+		if run.fired != 1 || joined != 3 {
+			t.Fatalf("expected the join forwarded once with 3 inputs, forwarded %d times with %d inputs",
+				run.fired, joined)
+		}
+	}
+}
+
+// raceDag defines the vertex a racing the vertices b and c to the join j, waiting for any input
+func raceDag(dag *Dag, options ...BranchOption) {
+
+	dag.Node("a")
+	dag.Node("b")
+	dag.Node("c")
+	dag.Node("j", WaitAny())
+	dag.Edge("a", "b")
+	dag.Edge("a", "c")
+	dag.Edge("b", "j")
+	dag.Edge("c", "j", options...)
+}
+
+// define defines the flow of exec positioned at position for the
+// dynamic options, it returns the pipeline of the flow
+func define(t *testing.T, exec executor.Executor, context *sdk.Context, position []string,
+	options map[string]string) *sdk.Pipeline {
+
+	t.Helper()
+	pipeline := sdk.CreatePipeline()
+	for depth, vertex := range position {
+		pipeline.ExecutionPosition[strconv.Itoa(depth)] = vertex
+		pipeline.ExecutionDepth = depth
+	}
+	if options != nil {
+		pipeline.CurrentDynamicOption = options
+	}
+	if err := exec.GetFlowDefinition(pipeline, context); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return pipeline
+}
+
+func TestJoiningExecutor(t *testing.T) {
+
+	store := newMemoryStore()
+	exec := joinTest(t, store, func(flow *Workflow) { raceDag(flow.Dag()) })
+	context := sdk.CreateContext("r", "", "flow", memoryDataStore{})
+
+	// the counter of the join is created once the flow starts
+	pipeline := define(t, exec, context, nil, nil)
+	join := pipeline.Dag.GetNode("j")
+	if _, err := store.Get(join.GetUniqueId()); err != nil {
+		t.Fatalf("expected the counter of the join created, %v", err)
+	}
+
+	// the first input forwards the join, as the executor does
+	forward := func(vertex string, data string) (string, bool) {
+		pipeline := define(t, exec, context, []string{vertex}, nil)
+		node := pipeline.Dag.GetNode(vertex)
+		forwarded := node.GetForwarder("j")([]byte(data))
+		context.Set(fmt.Sprintf("%s--%s", pipeline.GetNodeExecutionUniqueId(node), join.GetUniqueId()), forwarded)
+		return string(forwarded), executorIncrement(store, join.GetUniqueId()) >= 2
+	}
+	if data, fired := forward("b", "B"); data != "B" || !fired {
+		t.Fatalf("expected the first input to forward the join, got %s, %v", data, fired)
+	}
+
+	// the input which didn't arrive is left out of the join
+	pipeline = define(t, exec, context, []string{"j"}, nil)
+	if pipeline.Dag.GetNode("c").GetForwarder("j") != nil || pipeline.Dag.GetNode("b").GetForwarder("j") == nil {
+		t.Fatalf("expected the input of c left out of the join")
+	}
+	result, err := pipeline.Dag.GetNode("j").GetAggregator()(map[string][]byte{"b": []byte("B")})
+	if err != nil || string(result) != "B" {
+		t.Fatalf("expected the first input passed on, got %s, %v", result, err)
+	}
+
+	// the late input is skipped and doesn't forward the join again
+	if data, fired := forward("c", "C"); !IsSkipped([]byte(data)) || fired {
+		t.Fatalf("expected the late input skipped, got %s, %v", data, fired)
+	}
+}
+
+func TestJoiningExecutorForEach(t *testing.T) {
+
+	store := newMemoryStore()
+	exec := joinTest(t, store, func(flow *Workflow) {
+		items := flow.Dag().ForEachBranch("items", func(data []byte) map[string][]byte { return nil },
+			Aggregator(func(map[string][]byte) ([]byte, error) { return nil, nil }))
+		raceDag(items)
+	})
+	context := sdk.CreateContext("r", "", "flow", memoryDataStore{})
+
+	// the counter of the join is created once the item starts
+	pipeline := define(t, exec, context, nil, nil)
+	items := pipeline.Dag.GetNode("items")
+	options := map[string]string{items.GetUniqueId(): "x"}
+	pipeline = define(t, exec, context, []string{"items", "a"}, options)
+	join := items.SubDag().GetNode("j")
+	key := pipeline.GetNodeExecutionUniqueId(pipeline.Dag.GetNode("items").SubDag().GetNode("j"))
+	if _, err := store.Get(key); err != nil || !strings.HasPrefix(key, "x--") {
+		t.Fatalf("expected the counter %s of the join of the item created, %v", key, err)
+	}
+	if _, err := store.Get(join.GetUniqueId()); err == nil {
+		t.Fatalf("expected no counter created outside of the items")
+	}
+}
+
+func TestJoiningExecutorUncountedInput(t *testing.T) {
+
+	exec := joinTest(t, newMemoryStore(), func(flow *Workflow) { raceDag(flow.Dag(), InvokeEdge()) })
+	pipeline := sdk.CreatePipeline()
+	err := exec.GetFlowDefinition(pipeline, sdk.CreateContext("r", "", "flow", memoryDataStore{}))
+	if err == nil || !strings.Contains(err.Error(), "the input of c isn't forwarded") {
+		t.Fatalf("expected the input without forwarder to fail, got %v", err)
+	}
+}
+
+func TestWaitDefinition(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		runtime  bool
+		define   func()
+		expected string
+	}{
+		{"invalid count", true, func() { WaitN(0) }, "Error at WaitN, invalid count 0"},
+		{"aggregator not specified", true, func() { NewDag().Node("j", WaitN(2)) },
+			"Error at Node for j, aggregator not specified for WaitN(2)"},
+		{"no runtime", false, func() { NewDag().Node("j", WaitAny()) },
+			"Error at Node for j, no runtime executes the join before every input arrived"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.runtime {
+				joinTest(t, newMemoryStore(), nil)
+			}
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), test.expected) {
+					t.Fatalf("expected panic %q, got %v", test.expected, r)
+				}
+			}()
+			test.define()
+		})
+	}
+}
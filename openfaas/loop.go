@@ -0,0 +1,253 @@
+package openfaas
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+const (
+	// loopResult the vertex joining the iterations of a LoopBranch
+	loopResult = "loop-result"
+
+	// MaxLoopIterations the maximum MaxIterations of a LoopBranch, as every
+	// iteration is a sub-dag of the definition
+	MaxLoopIterations = 100
+)
+
+var (
+	// exhaustedPayload marks the output of a loop whose iterations were all used
+	exhaustedPayload = []byte(`{"__faasflow__":"exhausted"}`)
+)
+
+// LoopBody builds the sub-dag of an iteration of a LoopBranch, iteration starts at 1
+type LoopBody func(dag *Dag, iteration int)
+
+// loopGate starts an iteration of a LoopBranch
+type loopGate struct {
+	vertex    string   // the loop vertex
+	iteration int      // the iteration, starting at 1
+	context   *Context // records the iteration, optional
+}
+
+// loopEnd checks the output of a LoopBranch
+type loopEnd struct {
+	vertex        string // the loop vertex
+	maxIterations int    // the maximum iterations
+
+	ErrorVertex string // The vertex routing the failures, if any
+}
+
+// IterationKey is the context key the current iteration of a loop is recorded at
+func IterationKey(vertex string) string {
+
+	return "iteration-" + vertex
+}
+
+// LoopBranch composites a sub-dag which executes repeatedly, each iteration with the
+// output of the previous one, until the predicate holds for the output of an
+// iteration. The flow continues with that output, or fails if the predicate doesn't
+// hold after MaxIterations, which is required. The predicate is either an Expression,
+// its source, or a Go func([]byte) bool.
+// As a dag is acyclic, the loop is unrolled: body builds the sub-dag of each iteration
+// and the iterations after the predicate holds are skipped. The definition, which is
+// built on every request and exported with the flow, grows with MaxIterations copies
+// of the body, so MaxIterations is capped at MaxLoopIterations.
+// The skipped iterations still run: as the loop result waits for every iteration, the
+// gate and the vertices of the body of each remaining iteration execute with a skip
+// marker. They don't call any function, yet each is a vertex execution of the flow, so
+// a loop whose predicate holds at iteration k costs (MaxIterations - k) * (vertices of
+// the body + 1) extra executions, about 99 * (body + 1) at the cap. Keep MaxIterations
+// close to the iterations the loop needs.
+// An until failing to evaluate fails the loop, as does a failure of the body caught
+// by a TrySubDag the loop belongs to
+func (this *Dag) LoopBranch(vertex string, body LoopBody, until interface{}, options ...BranchOption) {
+
+	fmt.Println("lib/openfaas/loop.go::LoopBranch start")
+	if body == nil {
+		panic(fmt.Sprintf("Error at LoopBranch for %s, body not specified", vertex))
+	}
+	done := newGuard(until, "")
+
+	maxIterations := 0
+	var context *Context
+	for _, option := range options {
+		o := &BranchOptions{}
+		o.reset()
+		option(o)
+		if o.maxIterations != 0 {
+			maxIterations = o.maxIterations
+		}
+		if o.iterationContext != nil {
+			context = o.iterationContext
+		}
+	}
+	if maxIterations == 0 {
+		panic(fmt.Sprintf("Error at LoopBranch for %s, MaxIterations not specified", vertex))
+	}
+
+	loop := NewDag()
+	results := []string{}
+	for iteration := 1; iteration <= maxIterations; iteration++ {
+		gate := "loop-" + strconv.Itoa(iteration)
+		step := "iteration-" + strconv.Itoa(iteration)
+		loop.Node(gate).AddOperation(&loopGate{vertex: vertex, iteration: iteration, context: context})
+
+		dag := NewDag()
+		body(dag, iteration)
+		loop.SubDag(step, dag)
+		loop.Edge(gate, step)
+
+		if iteration > 1 {
+			previous := "iteration-" + strconv.Itoa(iteration-1)
+			loop.Edge(previous, gate)
+			loop.udag.GetNode(previous).AddForwarder(gate, done.loopForwarder(vertex, false, false))
+		}
+		results = append(results, step)
+	}
+	for index, step := range results {
+		last := index == len(results)-1
+		loop.Edge(step, loopResult)
+		loop.udag.GetNode(step).AddForwarder(loopResult, done.loopForwarder(vertex, true, last))
+	}
+	result := loop.Node(loopResult, Aggregator(tryAggregator))
+	end := &loopEnd{vertex: vertex, maxIterations: maxIterations}
+	result.register(end)
+	result.unode.AddOperation(end)
+
+	this.SubDag(vertex, loop)
+	fmt.Println("lib/openfaas/loop.go::LoopBranch end")
+}
+
+// loopForwarder forwards the output of an iteration. The edge to the next
+// iteration is taken until the predicate holds, the edge to the loop result
+// once it holds. After the last iteration the loop result is exhausted.
+// A predicate failing to evaluate forwards a failure to the loop result
+func (g *guard) loopForwarder(vertex string, toResult bool, last bool) sdk.Forwarder {
+
+	return func(data []byte) []byte {
+
+		fmt.Println("lib/openfaas/loop.go::loopForwarder start")
+		if isMarker(data) {
+			if isFailure(data) && toResult {
+				return data
+			}
+			return skippedPayload
+		}
+		ok, err := g.eval(data)
+		if err != nil {
+			if !toResult {
+				return skippedPayload
+			}
+			err = fmt.Errorf("LoopBranch(%s), error: until `%s` failed, %v", vertex, g.source, err)
+			fmt.Println(err)
+			return encodeFailure(vertex, "until", data, err)
+		}
+		fmt.Println("lib/openfaas/loop.go::loopForwarder end")
+		switch {
+		case ok == toResult:
+			return data
+		case toResult && last:
+			return exhaustedPayload
+		}
+		return skippedPayload
+	}
+}
+
+func (end *loopEnd) bind(node *sdk.Node, scope *dagScope) {
+}
+
+func (end *loopEnd) routeErrors(vertex string) {
+
+	end.ErrorVertex = vertex
+}
+
+func (gate *loopGate) GetId() string {
+
+	fmt.Println("lib/openfaas/loop.go::loopGate::GetId start")
+	fmt.Println("lib/openfaas/loop.go::loopGate::GetId end")
+	return "loop-" + gate.vertex + "-" + strconv.Itoa(gate.iteration)
+}
+
+func (gate *loopGate) Encode() []byte {
+
+	fmt.Println("lib/openfaas/loop.go::loopGate::Encode start")
+	fmt.Println("lib/openfaas/loop.go::loopGate::Encode end")
+	return []byte("")
+}
+
+func (gate *loopGate) GetProperties() map[string][]string {
+
+	fmt.Println("lib/openfaas/loop.go::loopGate::GetProperties start")
+	result := make(map[string][]string)
+	result["isMod"] = []string{"true"}
+	result["isFunction"] = []string{"false"}
+	result["isHttpRequest"] = []string{"false"}
+	result["iteration"] = []string{strconv.Itoa(gate.iteration)}
+	fmt.Println("lib/openfaas/loop.go::loopGate::GetProperties end")
+	return result
+}
+
+func (gate *loopGate) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/loop.go::loopGate::Execute start")
+	if isMarker(data) {
+		return data, nil
+	}
+	fmt.Printf("[Request `%v`] LoopBranch `%s` iteration %d\n", option["request-id"], gate.vertex, gate.iteration)
+	if gate.context != nil {
+		err := (*sdk.Context)(gate.context).Set(IterationKey(gate.vertex), gate.iteration)
+		if err != nil {
+			return nil, fmt.Errorf("LoopBranch(%s), error: failed to record iteration %d, %v",
+				gate.vertex, gate.iteration, err)
+		}
+	}
+	fmt.Println("lib/openfaas/loop.go::loopGate::Execute end")
+	return data, nil
+}
+
+func (end *loopEnd) GetId() string {
+
+	fmt.Println("lib/openfaas/loop.go::loopEnd::GetId start")
+	fmt.Println("lib/openfaas/loop.go::loopEnd::GetId end")
+	return "loop-" + end.vertex + "-result"
+}
+
+func (end *loopEnd) Encode() []byte {
+
+	fmt.Println("lib/openfaas/loop.go::loopEnd::Encode start")
+	fmt.Println("lib/openfaas/loop.go::loopEnd::Encode end")
+	return []byte("")
+}
+
+func (end *loopEnd) GetProperties() map[string][]string {
+
+	fmt.Println("lib/openfaas/loop.go::loopEnd::GetProperties start")
+	result := make(map[string][]string)
+	result["isMod"] = []string{"true"}
+	result["isFunction"] = []string{"false"}
+	result["isHttpRequest"] = []string{"false"}
+	result["maxIterations"] = []string{strconv.Itoa(end.maxIterations)}
+	fmt.Println("lib/openfaas/loop.go::loopEnd::GetProperties end")
+	return result
+}
+
+func (end *loopEnd) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/loop.go::loopEnd::Execute start")
+	if bytes.Equal(data, exhaustedPayload) {
+		err := fmt.Errorf("LoopBranch(%s), error: until not satisfied after %d iterations",
+			end.vertex, end.maxIterations)
+		if end.ErrorVertex != "" {
+			return encodeFailure(end.vertex, end.GetId(), data, err), nil
+		}
+		return nil, err
+	}
+	if isMarker(data) {
+		return passMarker(data, end.ErrorVertex)
+	}
+	fmt.Println("lib/openfaas/loop.go::loopEnd::Execute end")
+	return data, nil
+}
@@ -0,0 +1,109 @@
+package openfaas
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// errTest the failure of the tests
+var errTest = fmt.Errorf("failed")
+
+func TestLoopForwarder(t *testing.T) {
+
+	done := newGuard(`$.done == true`, "")
+	failure := encodeFailure("body", "f", []byte("input"), errTest)
+	tests := []struct {
+		name     string
+		toResult bool
+		last     bool
+		data     []byte
+		result   []byte
+	}{
+		{"next iteration until done", false, false, []byte(`{"done":false}`), []byte(`{"done":false}`)},
+		{"no next iteration once done", false, false, []byte(`{"done":true}`), skippedPayload},
+		{"result once done", true, false, []byte(`{"done":true}`), []byte(`{"done":true}`)},
+		{"no result until done", true, false, []byte(`{"done":false}`), skippedPayload},
+		{"last result exhausted", true, true, []byte(`{"done":false}`), exhaustedPayload},
+		{"failure to the result", true, false, failure, failure},
+		{"no failure to the next iteration", false, false, failure, skippedPayload},
+		{"until failure skips the next iteration", false, false, []byte(`not json`), skippedPayload},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := done.loopForwarder("loop", test.toResult, test.last)(test.data)
+			if string(result) != string(test.result) {
+				t.Fatalf("expected %s, got %s", test.result, result)
+			}
+		})
+	}
+
+	result := done.loopForwarder("loop", true, false)([]byte(`not json`))
+	if !isFailure(result) || !strings.Contains(string(result), "until `$.done == true` failed") {
+		t.Fatalf("expected a failure of until, got %s", result)
+	}
+}
+
+func TestLoopEnd(t *testing.T) {
+
+	failure := encodeFailure("loop", "until", []byte("input"), errTest)
+	tests := []struct {
+		name    string
+		caught  bool
+		data    []byte
+		err     string
+		failure bool
+	}{
+		{"output", false, []byte("output"), "", false},
+		{"exhausted", false, exhaustedPayload, "until not satisfied after 3 iterations", false},
+		{"exhausted caught", true, exhaustedPayload, "", true},
+		{"uncaught failure", false, failure, "vertex loop failed", false},
+		{"caught failure", true, failure, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			end := &loopEnd{vertex: "loop", maxIterations: 3}
+			if test.caught {
+				end.routeErrors(loopResult)
+			}
+			result, err := end.Execute(test.data, map[string]interface{}{})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil || isFailure(result) != test.failure {
+				t.Fatalf("unexpected result %s, %v", result, err)
+			}
+		})
+	}
+}
+
+func TestLoopBranchCaughtByTry(t *testing.T) {
+
+	body := NewDag()
+	body.LoopBranch("loop", func(dag *Dag, iteration int) { dag.Node("step") }, `$.done == true`, MaxIterations(2))
+	NewDag().TrySubDag("try", body, NewDag())
+
+	loop := body.udag.GetNode("loop").SubDag()
+	end := loop.GetNode(loopResult).Operations()[0].(*loopEnd)
+	if end.ErrorVertex == "" {
+		t.Fatalf("expected the failures of the loop caught by the TrySubDag")
+	}
+}
+
+func TestMaxIterationsCapped(t *testing.T) {
+
+	for _, count := range []int{0, MaxLoopIterations + 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected MaxIterations(%d) to panic", count)
+				}
+			}()
+			MaxIterations(count)
+		}()
+	}
+	MaxIterations(MaxLoopIterations)
+}
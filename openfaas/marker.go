@@ -0,0 +1,259 @@
+package openfaas
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/codec"
+	"github.com/Abhishekghosh1998/faasflow-lib/jsonutil"
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+var (
+	// markerPrefix starts every marker payload
+	markerPrefix = []byte(`{"__faasflow__":"`)
+	// skippedPayload marks the output of a path that wasn't taken
+	skippedPayload = []byte(`{"__faasflow__":"skipped"}`)
+	// failurePrefix starts the payload of a failure routed by an error edge
+	failurePrefix = []byte(`{"__faasflow__":"failure","error":`)
+)
+
+// libOperation an operation of the lib, aware of the vertex it belongs to
+type libOperation interface {
+	// bind binds the operation to the vertex it is added to
+	bind(node *sdk.Node, scope *dagScope)
+	// routeErrors routes the failures of the operation as failures of the vertex
+	routeErrors(vertex string)
+}
+
+// ErrorEnvelope the description of a failure forwarded to an error handler vertex
+type ErrorEnvelope struct {
+	Type       string          `json:"type"`                  // The kind of failure
+	Message    string          `json:"message"`               // The error message
+	Status     int             `json:"status,omitempty"`      // The returned status, if any
+	Vertex     string          `json:"vertex"`                // The failing vertex
+	Operation  string          `json:"operation"`             // The failing operation
+	Input      json.RawMessage `json:"input,omitempty"`       // The input of the operation, if JSON
+	InputBytes []byte          `json:"input-bytes,omitempty"` // The input of the operation, if not JSON
+}
+
+// IsSkipped checks if a payload marks a path that wasn't taken
+func IsSkipped(data []byte) bool {
+
+	return bytes.Equal(data, skippedPayload)
+}
+
+// isMarker checks if a payload is a marker that operations pass through
+func isMarker(data []byte) bool {
+
+	return bytes.HasPrefix(data, markerPrefix)
+}
+
+// isFailure checks if a payload is a routed failure
+func isFailure(data []byte) bool {
+
+	return bytes.HasPrefix(data, failurePrefix)
+}
+
+// passMarker passes a marker through an operation. A failure reaching an operation
+// whose failures aren't routed isn't caught, such as the failure of the When of an
+// edge outside of a TrySubDag, the operation fails with it
+func passMarker(data []byte, errorVertex string) ([]byte, error) {
+
+	if !isFailure(data) || errorVertex != "" {
+		return data, nil
+	}
+	envelope := &ErrorEnvelope{}
+	err := json.Unmarshal(decodeFailure(data), envelope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid failure, %v", err)
+	}
+	return nil, fmt.Errorf("vertex %s failed, %s", envelope.Vertex, envelope.Message)
+}
+
+// errorType classifies an error for the ErrorEnvelope
+func errorType(err error) (string, int) {
+
+	var statusErr *StatusError
+	var fallbackErr *FallbackError
+	var netErr net.Error
+	var codecErr *codec.Error
+	var schemaErr *SchemaError
+	switch {
+	case errors.As(err, &fallbackErr):
+		return "fallback-error", 0
+	case errors.As(err, &statusErr):
+		return "status-error", statusErr.StatusCode
+	case errors.Is(err, ERR_RATE_LIMITED):
+		return "rate-limited", 0
+	case errors.Is(err, ERR_BULKHEAD_FULL):
+		return "bulkhead-full", 0
+	case errors.Is(err, ERR_PARALLEL_TIMEOUT):
+		return "parallel-timeout", 0
+	case errors.Is(err, ERR_EVENT_TIMEOUT):
+		return "event-timeout", 0
+	case errors.As(err, &codecErr):
+		return "codec-error", 0
+	case errors.As(err, &schemaErr):
+		return "schema-error", 0
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout", 0
+	case errors.As(err, &netErr):
+		return "network-error", 0
+	}
+	return "execution-error", 0
+}
+
+// encodeFailure builds the payload of a failure routed by an error edge
+func encodeFailure(vertex string, operation string, input []byte, err error) []byte {
+
+	fmt.Println("lib/openfaas/marker.go::encodeFailure start")
+	envelope := &ErrorEnvelope{Vertex: vertex, Operation: operation, Message: err.Error()}
+	envelope.Type, envelope.Status = errorType(err)
+	if json.Valid(input) {
+		envelope.Input = input
+	} else {
+		envelope.InputBytes = input
+	}
+	encoded, _ := json.Marshal(envelope)
+
+	payload := append([]byte{}, failurePrefix...)
+	payload = append(payload, encoded...)
+	payload = append(payload, '}')
+	fmt.Println("lib/openfaas/marker.go::encodeFailure end")
+	return payload
+}
+
+// decodeFailure returns the JSON ErrorEnvelope of a routed failure
+func decodeFailure(data []byte) []byte {
+
+	return data[len(failurePrefix) : len(data)-1]
+}
+
+// errorForwarder forwards the routed failures of a vertex as JSON, other outputs are skipped
+func errorForwarder(data []byte) []byte {
+
+	fmt.Println("lib/openfaas/marker.go::errorForwarder start")
+	// the output of a suspended vertex is resolved once resumed
+	if isSuspended(data) {
+		return data
+	}
+	if !isFailure(data) {
+		return skippedPayload
+	}
+	fmt.Println("lib/openfaas/marker.go::errorForwarder end")
+	return append([]byte{}, decodeFailure(data)...)
+}
+
+// successForwarder skips the routed failures and the skipped outputs,
+// other outputs are forwarded by forwarder
+func successForwarder(forwarder sdk.Forwarder) sdk.Forwarder {
+
+	return func(data []byte) []byte {
+		if isFailure(data) || IsSkipped(data) {
+			return skippedPayload
+		}
+		return forwarder(data)
+	}
+}
+
+// markerForwarder passes the markers through, other outputs are forwarded by forwarder
+func markerForwarder(forwarder sdk.Forwarder) sdk.Forwarder {
+
+	return func(data []byte) []byte {
+		if isMarker(data) {
+			return data
+		}
+		return forwarder(data)
+	}
+}
+
+// modifierForwarder forwards the data of the edge <from>-><to> through modifier,
+// a failure of the modifier is forwarded as a failure of <from>
+func modifierForwarder(from string, to string, modifier Modifier) sdk.Forwarder {
+
+	return jsonutil.Forward(modifier, func(data []byte, err error) []byte {
+		err = fmt.Errorf("Edge(%s-%s), error: forwarder failed, %v", from, to, err)
+		fmt.Println(err)
+		return encodeFailure(from, "forwarder", data, err)
+	})
+}
+
+// skipAwareAggregator aggregates the inputs that weren't skipped, if every
+// input was skipped the output is skipped too. A caught failure in any
+// input is passed on instead of being aggregated
+func skipAwareAggregator(aggregator sdk.Aggregator) sdk.Aggregator {
+
+	return func(inputs map[string][]byte) ([]byte, error) {
+		taken := make(map[string][]byte)
+		for key, data := range inputs {
+			if isFailure(data) {
+				return data, nil
+			}
+			if IsSkipped(data) {
+				continue
+			}
+			taken[key] = data
+		}
+		if len(inputs) != 0 && len(taken) == 0 {
+			return skippedPayload, nil
+		}
+		return aggregator(taken)
+	}
+}
+
+func (operation *FaasOperation) routeErrors(vertex string) {
+
+	operation.ErrorVertex = vertex
+}
+
+func (operation *RouteOperation) routeErrors(vertex string) {
+
+	operation.ErrorVertex = vertex
+}
+
+func (operation *FaasOperation) bind(node *sdk.Node, scope *dagScope) {
+
+	operation.node = node
+	operation.scope = scope
+}
+
+func (operation *RouteOperation) bind(node *sdk.Node, scope *dagScope) {
+
+	operation.node = node
+	operation.scope = scope
+}
+
+// routesErrors checks if the failures of the vertex are routed to
+// an error edge or caught by a TrySubDag
+func (node *Node) routesErrors() bool {
+
+	_, ok := node.scope.errorEdges[node.unode.Id]
+	return ok || node.scope.catching()
+}
+
+// register registers a lib operation about to be added to the vertex
+func (node *Node) register(operation libOperation) {
+
+	fmt.Println("lib/openfaas/marker.go::register start")
+	node.checkOutputSchema()
+	operation.bind(node.unode, node.scope)
+	node.scope.operations = append(node.scope.operations, &scopedOperation{vertex: node.unode.Id, operation: operation})
+	if node.routesErrors() {
+		operation.routeErrors(node.unode.Id)
+	}
+	fmt.Println("lib/openfaas/marker.go::register end")
+}
+
+// addOperation adds a lib operation to the vertex
+func (node *Node) addOperation(operation *FaasOperation) {
+
+	fmt.Println("lib/openfaas/marker.go::addOperation start")
+	node.addStep(operation)
+	node.register(operation)
+	node.unode.AddOperation(operation)
+	fmt.Println("lib/openfaas/marker.go::addOperation end")
+}
@@ -0,0 +1,125 @@
+package openfaas
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// errorEdgeDag returns the dag of a vertex order calling f, with the edges to next, defined
+// before the error edge, and to later, defined after it, and the error edge to handler
+func errorEdgeDag() (*Dag, *FaasOperation) {
+
+	dag := NewDag()
+	dag.Node("order").Apply("f")
+	dag.Node("next")
+	dag.Node("handler")
+	dag.Node("later")
+	dag.Edge("order", "next")
+	dag.ErrorEdge("order", "handler")
+	dag.Edge("order", "later")
+	return dag, dag.udag.GetNode("order").Operations()[0].(*FaasOperation)
+}
+
+func TestErrorEdge(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		status   int
+		input    []byte
+		failure  bool
+		envelope ErrorEnvelope
+	}{
+		{"success skips the error edge", http.StatusOK, []byte(`{"id":1}`), false, ErrorEnvelope{}},
+		{"failure follows the error edge", http.StatusServiceUnavailable, []byte(`{"id":1}`), true,
+			ErrorEnvelope{Type: "status-error", Status: 503, Vertex: "order", Operation: "Function(f)",
+				Input: json.RawMessage(`{"id":1}`)}},
+		{"failure of a binary input", http.StatusBadRequest, []byte{0xff, 0x01}, true,
+			ErrorEnvelope{Type: "status-error", Status: 400, Vertex: "order", Operation: "Function(f)",
+				InputBytes: []byte{0xff, 0x01}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				w.Write([]byte("ok"))
+			}))
+			defer server.Close()
+			dag, operation := errorEdgeDag()
+			node := dag.udag.GetNode("order")
+
+			result, err := operation.Execute(test.input, map[string]interface{}{"request-id": "r",
+				"gateway": strings.TrimPrefix(server.URL, "http://")})
+			if err != nil || isFailure(result) != test.failure {
+				t.Fatalf("unexpected result %s, %v", result, err)
+			}
+			handler := node.GetForwarder("handler")(result)
+			if !test.failure {
+				for _, child := range []string{"next", "later"} {
+					if forwarded := node.GetForwarder(child)(result); string(forwarded) != "ok" {
+						t.Fatalf("expected the output forwarded to %s, got %s", child, forwarded)
+					}
+				}
+				if !IsSkipped(handler) {
+					t.Fatalf("expected the error edge skipped, got %s", handler)
+				}
+				return
+			}
+			// the other edges are skipped, whether defined before or after the error edge
+			for _, child := range []string{"next", "later"} {
+				if forwarded := node.GetForwarder(child)(result); !IsSkipped(forwarded) {
+					t.Fatalf("expected the edge to %s skipped, got %s", child, forwarded)
+				}
+			}
+			envelope := ErrorEnvelope{}
+			if err := json.Unmarshal(handler, &envelope); err != nil {
+				t.Fatalf("expected a JSON ErrorEnvelope, got %s", handler)
+			}
+			if !strings.Contains(envelope.Message, "Function(f), error: function execution failed") {
+				t.Fatalf("unexpected message %s", envelope.Message)
+			}
+			envelope.Message = ""
+			expected, _ := json.Marshal(test.envelope)
+			if got, _ := json.Marshal(envelope); string(got) != string(expected) {
+				t.Fatalf("expected the envelope %s, got %s", expected, got)
+			}
+		})
+	}
+}
+
+func TestErrorEdgeSkipPropagates(t *testing.T) {
+
+	dag, _ := errorEdgeDag()
+	dag.Node("after").Apply("g")
+	dag.Edge("next", "after")
+	// a skipped vertex passes the skip on without calling its function
+	next := dag.udag.GetNode("after").Operations()[0].(*FaasOperation)
+	result, err := next.Execute(skippedPayload, map[string]interface{}{"request-id": "r"})
+	if err != nil || !IsSkipped(result) {
+		t.Fatalf("expected the skip passed on, got %s, %v", result, err)
+	}
+	// an aggregator only receives the inputs that weren't skipped
+	aggregate := skipAwareAggregator(func(inputs map[string][]byte) ([]byte, error) {
+		return []byte(fmt.Sprint(len(inputs))), nil
+	})
+	if result, _ := aggregate(map[string][]byte{"a": []byte("1"), "b": skippedPayload}); string(result) != "1" {
+		t.Fatalf("expected one input aggregated, got %s", result)
+	}
+	if result, _ := aggregate(map[string][]byte{"a": skippedPayload}); !IsSkipped(result) {
+		t.Fatalf("expected the aggregation of skipped inputs skipped, got %s", result)
+	}
+}
+
+func TestErrorEdgeUnknownVertex(t *testing.T) {
+
+	defer func() {
+		expected := "Error at ErrorEdge for missing-handler, vertex missing not found"
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), expected) {
+			t.Fatalf("expected panic %q, got %v", expected, r)
+		}
+	}()
+	NewDag().ErrorEdge("missing", "handler")
+}
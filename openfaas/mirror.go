@@ -0,0 +1,159 @@
+package openfaas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+const (
+	// DefaultMirrorTimeout the default bound of a shadow call and of its wait for the primary result
+	DefaultMirrorTimeout = 30 * time.Second
+)
+
+// MirrorSink receives the comparison of a primary response with its shadow response
+type MirrorSink interface {
+	// Record records the outcome of a mirrored call
+	Record(record *MirrorRecord)
+}
+
+// MirrorPolicy shadow traffic sent to a candidate function
+type MirrorPolicy struct {
+	Function   string        // The shadow function
+	SampleRate float64       // The fraction of calls mirrored, between 0 and 1
+	Sink       MirrorSink    // Records the diff of the responses, optional
+	Timeout    time.Duration // The bound of the shadow call and of its wait for the primary result
+}
+
+// MirrorRecord the outcome of a primary call and its shadow call
+type MirrorRecord struct {
+	RequestId     string // The request the call belongs to
+	Primary       string // The primary function
+	Shadow        string // The shadow function
+	PrimaryResult []byte // The primary response
+	PrimaryError  string // The primary error if any
+	ShadowResult  []byte // The shadow response
+	ShadowError   string // The shadow error if any
+	Equal         bool   // Both calls failed or both responses are equal (JSON aware)
+}
+
+// mirrorCall a shadow call in progress
+type mirrorCall struct {
+	primary chan *MirrorRecord
+}
+
+// startMirror fires the shadow calls of the operation asynchronously with the payload
+// of the flow, the returned calls wait for the primary result to record the diff
+func (operation *FaasOperation) startMirror(reqId string, gateway string, data []byte) []*mirrorCall {
+
+	fmt.Println("lib/openfaas/mirror.go::startMirror start")
+	var calls []*mirrorCall
+	for _, policy := range operation.Mirrors {
+		if policy.SampleRate < 1 && rand.Float64() >= policy.SampleRate {
+			continue
+		}
+		call := &mirrorCall{}
+		if policy.Sink != nil {
+			call.primary = make(chan *MirrorRecord, 1)
+		}
+		go operation.executeMirror(reqId, gateway, policy, copyBytes(data), call)
+		calls = append(calls, call)
+	}
+	fmt.Println("lib/openfaas/mirror.go::startMirror end")
+	return calls
+}
+
+// executeMirror executes a shadow call, its result never affects the flow
+func (operation *FaasOperation) executeMirror(reqId string, gateway string, policy *MirrorPolicy,
+	data []byte, call *mirrorCall) {
+
+	fmt.Println("lib/openfaas/mirror.go::executeMirror start")
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("[Request `%s`] Mirror call to `%s` panicked, %v\n", reqId, policy.Function, r)
+		}
+	}()
+
+	// the shadow call and its wait for the primary result are bounded, whatever the primary does
+	ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout)
+	defer cancel()
+	// the shadow receives the input of the primary, encoded with its Codec, and its
+	// response is converted to the payload format of the flow as the primary one
+	resolved, err := operation.resolve(data)
+	if err == nil {
+		data, err = operation.encodeInput(data)
+	}
+	var result []byte
+	if err == nil {
+		shadow := &FaasOperation{
+			Function:       policy.Function,
+			Header:         resolved.Header,
+			Param:          resolved.Param,
+			Requesthandler: operation.Requesthandler,
+			Codec:          operation.Codec,
+			FlowCodec:      operation.FlowCodec,
+		}
+		result, err = executeFunction(ctx, gateway, shadow, data)
+	}
+	if err != nil {
+		fmt.Printf("[Request `%s`] Mirror call to `%s` failed, %v\n", reqId, policy.Function, err)
+	}
+	if call.primary == nil {
+		return
+	}
+
+	var record *MirrorRecord
+	select {
+	case record = <-call.primary:
+	case <-ctx.Done():
+		fmt.Printf("[Request `%s`] Mirror call to `%s` gave up waiting for the primary result\n",
+			reqId, policy.Function)
+		return
+	}
+	record.Shadow = policy.Function
+	record.ShadowResult = result
+	if err != nil {
+		record.ShadowError = err.Error()
+	}
+	if record.PrimaryError != "" || record.ShadowError != "" {
+		record.Equal = record.PrimaryError != "" && record.ShadowError != ""
+	} else {
+		record.Equal = equalPayload(record.PrimaryResult, record.ShadowResult)
+	}
+	policy.Sink.Record(record)
+	fmt.Println("lib/openfaas/mirror.go::executeMirror end")
+}
+
+// completeMirror hands the primary result to the shadow calls
+func completeMirror(calls []*mirrorCall, reqId string, primary string, result []byte, err error) {
+
+	fmt.Println("lib/openfaas/mirror.go::completeMirror start")
+	for _, call := range calls {
+		if call.primary == nil {
+			continue
+		}
+		record := &MirrorRecord{RequestId: reqId, Primary: primary, PrimaryResult: copyBytes(result)}
+		if err != nil {
+			record.PrimaryError = err.Error()
+		}
+		call.primary <- record
+	}
+	fmt.Println("lib/openfaas/mirror.go::completeMirror end")
+}
+
+// equalPayload compares two payloads, JSON payloads are compared by value
+func equalPayload(a []byte, b []byte) bool {
+
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var ja, jb interface{}
+	if json.Unmarshal(a, &ja) != nil || json.Unmarshal(b, &jb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(ja, jb)
+}
@@ -0,0 +1,135 @@
+package openfaas
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/codec"
+)
+
+type recordingSink struct {
+	mu      sync.Mutex
+	records []*MirrorRecord
+}
+
+func (sink *recordingSink) Record(record *MirrorRecord) {
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.records = append(sink.records, record)
+}
+
+// runMirror runs the shadow call of operation and returns once it completed or after a second
+func runMirror(operation *FaasOperation, gateway string, call *mirrorCall) bool {
+
+	done := make(chan struct{})
+	go func() {
+		operation.executeMirror("request", gateway, operation.Mirrors[0], []byte("{}"), call)
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+func TestMirrorRecordsTheDiff(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"a": 1, "b": 2}`))
+	}))
+	defer server.Close()
+	sink := &recordingSink{}
+	operation := createFunction("primary")
+	operation.applyOptions([]Option{MirrorWithDiff("shadow", 1, sink)})
+
+	call := &mirrorCall{primary: make(chan *MirrorRecord, 1)}
+	completeMirror([]*mirrorCall{call}, "request", "primary", []byte(`{"b":2,"a":1}`), nil)
+	if !runMirror(operation, strings.TrimPrefix(server.URL, "http://"), call) {
+		t.Fatalf("expected the shadow call to complete")
+	}
+	if len(sink.records) != 1 || !sink.records[0].Equal || sink.records[0].Shadow != "shadow" {
+		t.Fatalf("expected an equal record, got %+v", sink.records)
+	}
+}
+
+func TestMirrorConvertsPayloads(t *testing.T) {
+
+	var contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/msgpack")
+		w.Write([]byte{0x81, 0xa5, 't', 'o', 't', 'a', 'l', 0x03})
+	}))
+	defer server.Close()
+	sink := &recordingSink{}
+	operation := createFunction("primary")
+	operation.applyOptions([]Option{MirrorWithDiff("shadow", 1, sink), Codec(codec.MsgPack), ConvertFrom(codec.JSON)})
+
+	call := &mirrorCall{primary: make(chan *MirrorRecord, 1)}
+	completeMirror([]*mirrorCall{call}, "request", "primary", []byte(`{"total":3}`), nil)
+	if !runMirror(operation, strings.TrimPrefix(server.URL, "http://"), call) {
+		t.Fatalf("expected the shadow call to complete")
+	}
+	// the shadow receives the input encoded with the Codec, {} as msgpack
+	if contentType != "application/msgpack" || !bytes.Equal(body, []byte{0x80}) {
+		t.Fatalf("expected the input encoded as msgpack, got %s %x", contentType, body)
+	}
+	if len(sink.records) != 1 || !sink.records[0].Equal || string(sink.records[0].ShadowResult) != `{"total":3}` {
+		t.Fatalf("expected the shadow response converted and equal, got %+v", sink.records)
+	}
+}
+
+func TestMirrorTimeoutBoundsTheShadowCall(t *testing.T) {
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	operation := createFunction("primary")
+	operation.applyOptions([]Option{MirrorTimeout(20 * time.Millisecond), Mirror("shadow", 1)})
+
+	if !runMirror(operation, strings.TrimPrefix(server.URL, "http://"), &mirrorCall{}) {
+		t.Fatalf("expected the hanging shadow call to time out")
+	}
+}
+
+func TestMirrorTimeoutBoundsTheWaitForThePrimary(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	sink := &recordingSink{}
+	operation := createFunction("primary")
+	operation.applyOptions([]Option{MirrorWithDiff("shadow", 1, sink), MirrorTimeout(20 * time.Millisecond)})
+
+	// the primary never completes, such as when it panicked
+	call := &mirrorCall{primary: make(chan *MirrorRecord, 1)}
+	if !runMirror(operation, strings.TrimPrefix(server.URL, "http://"), call) {
+		t.Fatalf("expected the wait for the primary result to time out")
+	}
+	if len(sink.records) != 0 {
+		t.Fatalf("expected no record without a primary result")
+	}
+}
+
+func TestMirrorIsRejectedOnRequest(t *testing.T) {
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected Mirror on a Request to panic")
+		}
+	}()
+	createHttpRequest("https://api.example.com/resource").applyOptions([]Option{Mirror("shadow", 1)})
+}
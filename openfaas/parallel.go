@@ -0,0 +1,114 @@
+package openfaas
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/internal/parallel"
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+const (
+	// parallelAcquire the vertex taking a slot before an item of a foreach branch
+	parallelAcquire = "parallel-acquire"
+	// parallelBody the vertex of the item dag of a foreach branch
+	parallelBody = "parallel-body"
+	// parallelRelease the vertex freeing the slot after an item of a foreach branch
+	parallelRelease = "parallel-release"
+
+	// DefaultParallelTimeout the default maximum wait of an item for a slot
+	DefaultParallelTimeout = parallel.DefaultTimeout
+)
+
+var (
+	// ERR_PARALLEL_TIMEOUT denotes that an item timed out waiting for a slot
+	ERR_PARALLEL_TIMEOUT = parallel.ErrTimeout
+)
+
+// BatchItem an item of a batch executed by a foreach branch with BatchSize
+type BatchItem = parallel.BatchItem
+
+// parallelGate takes or frees a slot for an item of a foreach branch, the failures
+// of the item reach the release vertex as failure markers so that it frees the slot
+type parallelGate struct {
+	*parallel.Gate
+	outer  *dagScope // the scope of the foreach vertex
+	quorum bool      // the failures of the items are aggregated
+}
+
+func (gate *parallelGate) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/parallel.go::Execute start")
+	if !gate.Release {
+		result, err := gate.Gate.Execute(data, option)
+		if err != nil {
+			// the item fails without a slot, the release vertex passes it on
+			return encodeFailure(parallelAcquire, parallelAcquire, data, err), nil
+		}
+		return result, nil
+	}
+	if !isFailure(data) {
+		return gate.Gate.Execute(data, option)
+	}
+
+	envelope := &ErrorEnvelope{}
+	err := json.Unmarshal(decodeFailure(data), envelope)
+	if err != nil {
+		return nil, fmt.Errorf("ForEachBranch(%s), error: invalid failure of item, %v", gate.Vertex, err)
+	}
+	if envelope.Vertex != parallelAcquire {
+		_, err = gate.Gate.Execute(data, option)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if gate.quorum || gate.outer.catching() {
+		return data, nil
+	}
+	fmt.Println("lib/openfaas/parallel.go::Execute end")
+	return nil, fmt.Errorf("ForEachBranch(%s), error: item failed at %s, %s",
+		gate.Vertex, envelope.Vertex, envelope.Message)
+}
+
+// parallelDag wraps the item dag of a foreach vertex so that at most limit
+// items execute at once, the slots are counted in store. The failures of the
+// item dag are caught so that the slot is freed, they fail the item after
+func parallelDag(node *sdk.Node, outer *dagScope, quorum bool, limit int, store StateStore,
+	timeout time.Duration, body *Dag) *Dag {
+
+	fmt.Println("lib/openfaas/parallel.go::parallelDag start")
+	gate := parallel.Gate{Vertex: node.Id, Key: parallel.Key(node), Limit: limit, Timeout: timeout,
+		Limiter: parallel.NewLimiter(store)}
+	release := gate
+	release.Release = true
+
+	dag := NewDag()
+	dag.Node(parallelAcquire).AddOperation(&parallelGate{Gate: &gate, outer: outer, quorum: quorum})
+	dag.SubDag(parallelBody, body)
+	dag.Node(parallelRelease).AddOperation(&parallelGate{Gate: &release, outer: outer, quorum: quorum})
+	dag.Edge(parallelAcquire, parallelBody)
+	dag.Edge(parallelBody, parallelRelease)
+	fmt.Println("lib/openfaas/parallel.go::parallelDag end")
+	return dag
+}
+
+// parallelForEach creates the slot count of the foreach vertex each time it
+// executes, before the items take a slot
+func parallelForEach(node *sdk.Node, store StateStore, foreach sdk.ForEach) sdk.ForEach {
+
+	return parallel.InitForEach(foreach, &parallel.Gate{Vertex: node.Id, Key: parallel.Key(node),
+		Limiter: parallel.NewLimiter(store)})
+}
+
+// DecodeBatch returns the items of a batch executed by a foreach branch with BatchSize
+func DecodeBatch(data []byte) ([]BatchItem, error) {
+
+	return parallel.DecodeBatch(data)
+}
+
+// batchForEach groups the items of foreach in batches of size
+func batchForEach(foreach sdk.ForEach, size int) sdk.ForEach {
+
+	return parallel.BatchForEach(foreach, size)
+}
@@ -0,0 +1,145 @@
+package openfaas
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/internal/parallel"
+)
+
+// parallelGates returns the gates of a foreach vertex limited to limit items, the
+// slot count is created as by the execution of the foreach vertex
+func parallelGates(store StateStore, outer *dagScope, quorum bool, limit int) (*parallelGate, *parallelGate) {
+
+	gate := parallel.Gate{Vertex: "items", Key: "parallel-items", Limit: limit, Limiter: parallel.NewLimiter(store)}
+	if _, err := store.Get("parallel-items"); err != nil {
+		store.Set("parallel-items", "0")
+	}
+	release := gate
+	release.Release = true
+	return &parallelGate{Gate: &gate, outer: outer, quorum: quorum},
+		&parallelGate{Gate: &release, outer: outer, quorum: quorum}
+}
+
+func TestParallelGateReleasesFailingItems(t *testing.T) {
+
+	failure := encodeFailure("body-vertex", "f", []byte("item"), fmt.Errorf("failed"))
+	tests := []struct {
+		name     string
+		quorum   bool
+		catching bool
+		fails    bool
+	}{
+		{"uncaught failure fails the item", false, false, true},
+		{"failure aggregated by the quorum", true, false, false},
+		{"failure caught by the outer dag", false, true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newMemoryStore()
+			acquire, release := parallelGates(store, &dagScope{catches: test.catching}, test.quorum, 1)
+			if _, err := acquire.Execute([]byte("item"), nil); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			result, err := release.Execute(failure, nil)
+			if test.fails != (err != nil) {
+				t.Fatalf("expected the item to fail %v, got %v", test.fails, err)
+			}
+			if !test.fails && string(result) != string(failure) {
+				t.Fatalf("expected the failure passed on, got %s", result)
+			}
+			if taken, _ := store.Get("parallel-items"); taken != "0" {
+				t.Fatalf("expected the slot freed, %s taken", taken)
+			}
+		})
+	}
+}
+
+func TestParallelGateAcquireTimeout(t *testing.T) {
+
+	store := newMemoryStore()
+	store.Set("parallel-items", "1")
+	acquire, release := parallelGates(store, &dagScope{}, true, 1)
+	result, err := acquire.Execute([]byte("item"), nil)
+	if err != nil || !isFailure(result) {
+		t.Fatalf("expected a failure marker, got %s, %v", result, err)
+	}
+	kind, _ := errorType(parallel.ErrTimeout)
+	if kind != "parallel-timeout" {
+		t.Fatalf("unexpected error type %s", kind)
+	}
+	// the item never held a slot, the slot of the other item is kept
+	if _, err := release.Execute(result, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if taken, _ := store.Get("parallel-items"); taken != "1" {
+		t.Fatalf("expected the slot of the other item kept, %s taken", taken)
+	}
+
+	_, release = parallelGates(store, &dagScope{}, false, 1)
+	_, err = release.Execute(result, nil)
+	if err == nil {
+		t.Fatalf("expected the timed out item to fail")
+	}
+}
+
+func TestParallelGatePassesOutputs(t *testing.T) {
+
+	store := newMemoryStore()
+	acquire, release := parallelGates(store, &dagScope{}, false, 2)
+	for _, data := range []string{"a", "b"} {
+		result, err := acquire.Execute([]byte(data), nil)
+		if err != nil || string(result) != data {
+			t.Fatalf("unexpected result %s, %v", result, err)
+		}
+	}
+	result, err := release.Execute([]byte("output"), nil)
+	if err != nil || string(result) != "output" {
+		t.Fatalf("unexpected result %s, %v", result, err)
+	}
+	if taken, _ := store.Get("parallel-items"); taken != "1" {
+		t.Fatalf("expected one slot taken, %s taken", taken)
+	}
+}
+
+func TestMaxParallelRequiresStore(t *testing.T) {
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected MaxParallel without StateStore to panic")
+		}
+	}()
+	MaxParallel(2, nil)
+}
+
+func TestForEachBranchCatchesItemFailures(t *testing.T) {
+
+	dag := NewDag()
+	items := dag.ForEachBranch("items", func(data []byte) map[string][]byte { return nil },
+		MaxParallel(2, newMemoryStore()))
+	operation := createFunction("f")
+	items.Node("f").addOperation(operation)
+	if operation.ErrorVertex != "f" {
+		t.Fatalf("expected the failures of the item routed to the release vertex")
+	}
+}
+
+func TestForEachBranchCreatesSlotCount(t *testing.T) {
+
+	store := newMemoryStore()
+	dag := NewDag()
+	dag.ForEachBranch("items", func(data []byte) map[string][]byte {
+		return map[string][]byte{"0": data}
+	}, MaxParallel(2, store), BatchSize(1))
+	node := dag.udag.GetNode("items")
+	if _, err := store.Get(parallel.Key(node)); err == nil {
+		t.Fatalf("expected the slot count created by the execution")
+	}
+	items := node.GetForEach()([]byte(`"a"`))
+	if len(items) != 1 {
+		t.Fatalf("expected the batch of the item, got %v", items)
+	}
+	if taken, err := store.Get(parallel.Key(node)); err != nil || taken != "0" {
+		t.Fatalf("expected the slot count created, got %q, %v", taken, err)
+	}
+}
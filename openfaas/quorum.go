@@ -0,0 +1,113 @@
+package openfaas
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+const (
+	// FailedItemsKey is the aggregator input key the failed items of a
+	// foreach branch are listed at, as a JSON list of ItemFailure
+	FailedItemsKey = "__failed_items__"
+)
+
+// ItemFailure a failed item of a foreach branch
+type ItemFailure struct {
+	Key   string         `json:"key"`   // The foreach key of the item
+	Error *ErrorEnvelope `json:"error"` // The failure of the item
+}
+
+// quorumPolicy the failures tolerated by a foreach branch
+type quorumPolicy struct {
+	enabled           bool
+	minSuccess        int
+	minSuccessPercent float64
+}
+
+// FailedItems returns the failed items listed in the aggregator
+// input of a foreach branch, nil if no item failed
+func FailedItems(results map[string][]byte) ([]ItemFailure, error) {
+
+	fmt.Println("lib/openfaas/quorum.go::FailedItems start")
+	data, ok := results[FailedItemsKey]
+	if !ok {
+		return nil, nil
+	}
+	var failures []ItemFailure
+	err := json.Unmarshal(data, &failures)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode failed items, %v", err)
+	}
+	fmt.Println("lib/openfaas/quorum.go::FailedItems end")
+	return failures, nil
+}
+
+// required returns the minimum successful items out of total
+func (policy *quorumPolicy) required(total int) int {
+
+	required := policy.minSuccess
+	if policy.minSuccessPercent != 0 {
+		percent := int(math.Ceil(float64(total) * policy.minSuccessPercent / 100))
+		if percent > required {
+			required = percent
+		}
+	}
+	return required
+}
+
+// aggregator separates the failed items from the results, checks the
+// quorum and aggregates the results with the list of failures
+func (policy *quorumPolicy) aggregator(vertex string, aggregator sdk.Aggregator) sdk.Aggregator {
+
+	return func(results map[string][]byte) ([]byte, error) {
+
+		fmt.Println("lib/openfaas/quorum.go::quorumPolicy::aggregator start")
+		succeeded := make(map[string][]byte)
+		failures := []ItemFailure{}
+		total := 0
+		for key, data := range results {
+			switch {
+			case IsSkipped(data):
+				succeeded[key] = data
+			case isFailure(data):
+				total++
+				envelope := &ErrorEnvelope{}
+				if err := json.Unmarshal(decodeFailure(data), envelope); err != nil {
+					envelope.Message = fmt.Sprintf("invalid failure, %v", err)
+				}
+				failures = append(failures, ItemFailure{Key: key, Error: envelope})
+			default:
+				total++
+				succeeded[key] = data
+			}
+		}
+		sort.Slice(failures, func(i, j int) bool { return failures[i].Key < failures[j].Key })
+
+		success := total - len(failures)
+		required := policy.required(total)
+		if success < required {
+			keys := []string{}
+			for _, failure := range failures {
+				keys = append(keys, failure.Key)
+			}
+			return nil, fmt.Errorf("ForEachBranch(%s), error: %d of %d items succeeded, %d required, failed items [%s]",
+				vertex, success, total, required, strings.Join(keys, ", "))
+		}
+
+		if len(failures) != 0 {
+			fmt.Printf("ForEachBranch(%s) continuing with %d failed items\n", vertex, len(failures))
+			encoded, err := json.Marshal(failures)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode failed items, %v", err)
+			}
+			succeeded[FailedItemsKey] = encoded
+		}
+		fmt.Println("lib/openfaas/quorum.go::quorumPolicy::aggregator end")
+		return aggregator(succeeded)
+	}
+}
@@ -0,0 +1,152 @@
+package openfaas
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// quorumAggregator returns the aggregator of a foreach branch defined with opts, the
+// aggregated results are returned as a JSON object
+func quorumAggregator(opts ...BranchOption) func(map[string][]byte) ([]byte, error) {
+
+	dag := NewDag()
+	opts = append(opts, Aggregator(func(results map[string][]byte) ([]byte, error) {
+		aggregated := make(map[string]string)
+		for key, data := range results {
+			aggregated[key] = string(data)
+		}
+		return json.Marshal(aggregated)
+	}))
+	dag.ForEachBranch("items", func(data []byte) map[string][]byte { return nil }, opts...)
+	return dag.udag.GetNode("items").GetSubAggregator()
+}
+
+// itemFailure returns the failure of an item at vertex
+func itemFailure(vertex string) []byte {
+
+	return encodeFailure(vertex, "f", []byte("item"), fmt.Errorf("failed at %s", vertex))
+}
+
+func TestQuorumRequired(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		policy   quorumPolicy
+		total    int
+		required int
+	}{
+		{"any success", quorumPolicy{enabled: true}, 10, 0},
+		{"count", quorumPolicy{enabled: true, minSuccess: 3}, 10, 3},
+		{"percent rounded up", quorumPolicy{enabled: true, minSuccessPercent: 50}, 5, 3},
+		{"exact percent", quorumPolicy{enabled: true, minSuccessPercent: 50}, 4, 2},
+		{"small percent of few items", quorumPolicy{enabled: true, minSuccessPercent: 1}, 3, 1},
+		{"every item", quorumPolicy{enabled: true, minSuccessPercent: 100}, 7, 7},
+		{"count above the percent", quorumPolicy{enabled: true, minSuccess: 4, minSuccessPercent: 10}, 10, 4},
+		{"percent above the count", quorumPolicy{enabled: true, minSuccess: 2, minSuccessPercent: 90}, 10, 9},
+		{"no item", quorumPolicy{enabled: true, minSuccessPercent: 50}, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if required := test.policy.required(test.total); required != test.required {
+				t.Fatalf("expected %d required, got %d", test.required, required)
+			}
+		})
+	}
+}
+
+func TestQuorumAggregator(t *testing.T) {
+
+	results := map[string][]byte{
+		"0": []byte("a"),
+		"1": itemFailure("f1"),
+		"2": []byte("c"),
+		"3": itemFailure("f3"),
+		"4": skippedPayload,
+	}
+	tests := []struct {
+		name string
+		opts []BranchOption
+		err  string
+	}{
+		{"continue on error", []BranchOption{ContinueOnError()}, ""},
+		{"count met", []BranchOption{MinSuccess(2)}, ""},
+		{"count missed", []BranchOption{MinSuccess(3)},
+			"ForEachBranch(items), error: 2 of 4 items succeeded, 3 required, failed items [1, 3]"},
+		{"percent met", []BranchOption{MinSuccessPercent(50)}, ""},
+		{"percent missed", []BranchOption{MinSuccessPercent(51)},
+			"ForEachBranch(items), error: 2 of 4 items succeeded, 3 required, failed items [1, 3]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := quorumAggregator(test.opts...)(results)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			aggregated := map[string]string{}
+			json.Unmarshal(result, &aggregated)
+			// the failed items are listed apart, the skipped ones neither count nor are aggregated
+			if len(aggregated) != 3 || aggregated["0"] != "a" || aggregated["2"] != "c" {
+				t.Fatalf("unexpected results %v", aggregated)
+			}
+			failures, err := FailedItems(map[string][]byte{FailedItemsKey: []byte(aggregated[FailedItemsKey])})
+			if err != nil || len(failures) != 2 {
+				t.Fatalf("expected 2 failed items, got %v, %v", failures, err)
+			}
+			for i, key := range []string{"1", "3"} {
+				failure := failures[i]
+				if failure.Key != key || failure.Error.Vertex != "f"+key ||
+					!strings.Contains(failure.Error.Message, "failed at f"+key) {
+					t.Fatalf("unexpected failed item %+v, %+v", failure, failure.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestQuorumWithoutFailures(t *testing.T) {
+
+	result, err := quorumAggregator(MinSuccessPercent(100))(map[string][]byte{"0": []byte("a")})
+	if err != nil || string(result) != `{"0":"a"}` {
+		t.Fatalf("expected the results without failed items, got %s, %v", result, err)
+	}
+	if failures, err := FailedItems(map[string][]byte{"0": []byte("a")}); failures != nil || err != nil {
+		t.Fatalf("expected no failed item, got %v, %v", failures, err)
+	}
+	if _, err := FailedItems(map[string][]byte{FailedItemsKey: []byte("{")}); err == nil {
+		t.Fatalf("expected invalid failed items to fail")
+	}
+}
+
+func TestQuorumDefinition(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		define func()
+		err    string
+	}{
+		{"zero count", func() { MinSuccess(0) }, "Error at MinSuccess, invalid count 0"},
+		{"zero percent", func() { MinSuccessPercent(0) }, "Error at MinSuccessPercent, invalid percent 0"},
+		{"percent above 100", func() { MinSuccessPercent(101) }, "Error at MinSuccessPercent, invalid percent 101"},
+		{"no aggregator", func() {
+			NewDag().ForEachBranch("items", func(data []byte) map[string][]byte { return nil }, ContinueOnError())
+		}, "Error at AddForEachBranch for items, aggregator not specified for ContinueOnError"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), test.err) {
+					t.Fatalf("expected panic %q, got %v", test.err, r)
+				}
+			}()
+			test.define()
+		})
+	}
+}
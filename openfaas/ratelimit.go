@@ -0,0 +1,309 @@
+package openfaas
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// ScopeFunction shares a rate limit between calls to the same function or url
+	ScopeFunction = "function"
+	// ScopeHost shares a rate limit between calls to the same host
+	ScopeHost = "host"
+)
+
+var (
+	// ERR_RATE_LIMITED denotes that a call was rejected by the rate limiter
+	ERR_RATE_LIMITED = fmt.Errorf("rate limit exceeded")
+
+	// rateLimiter is the process wide limiter shared by all operations
+	rateLimiter RateLimiter = newLocalRateLimiter()
+	// rateLimiterLock guards the rateLimiter
+	rateLimiterLock sync.RWMutex
+)
+
+// RateLimiter limits the rate of upstream calls sharing a key, it allows
+// plugging a distributed limiter (such as a redis backed one) in place
+// of the default in process token bucket
+type RateLimiter interface {
+	// Reserve takes a token for key from a bucket refilled at rps with
+	// capacity burst, if no token is available it returns the time to wait
+	// before retrying without taking a token
+	Reserve(key string, rps float64, burst int) (time.Duration, error)
+}
+
+// RateLimitPolicy rate limit applied to an operation
+type RateLimitPolicy struct {
+	Rps     float64       // Allowed calls per second
+	Burst   int           // Maximum calls allowed at once
+	Scope   string        // ScopeFunction or ScopeHost
+	MaxWait time.Duration // Maximum wait for a token, negative waits forever
+}
+
+// tokenBucket in process token bucket
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// localRateLimiter in process RateLimiter
+type localRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+// SetRateLimiter overrides the process wide RateLimiter
+func SetRateLimiter(limiter RateLimiter) {
+
+	fmt.Println("lib/openfaas/ratelimit.go::SetRateLimiter start")
+	rateLimiterLock.Lock()
+	defer rateLimiterLock.Unlock()
+	if limiter == nil {
+		limiter = newLocalRateLimiter()
+	}
+	rateLimiter = limiter
+	fmt.Println("lib/openfaas/ratelimit.go::SetRateLimiter end")
+}
+
+// getRateLimiter returns the process wide RateLimiter
+func getRateLimiter() RateLimiter {
+
+	rateLimiterLock.RLock()
+	defer rateLimiterLock.RUnlock()
+	return rateLimiter
+}
+
+// newLocalRateLimiter creates an in process RateLimiter
+func newLocalRateLimiter() *localRateLimiter {
+
+	fmt.Println("lib/openfaas/ratelimit.go::newLocalRateLimiter start")
+	limiter := &localRateLimiter{}
+	limiter.buckets = make(map[string]*tokenBucket)
+	limiter.now = time.Now
+	fmt.Println("lib/openfaas/ratelimit.go::newLocalRateLimiter end")
+	return limiter
+}
+
+// Reserve takes a token from the bucket of the key
+func (limiter *localRateLimiter) Reserve(key string, rps float64, burst int) (time.Duration, error) {
+
+	fmt.Println("lib/openfaas/ratelimit.go::localRateLimiter::Reserve start")
+	if rps <= 0 {
+		return 0, fmt.Errorf("invalid rate %v for %s", rps, key)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := limiter.now()
+	bucket, ok := limiter.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(burst), last: now}
+		limiter.buckets[key] = bucket
+	}
+
+	// refill the tokens for the elapsed time
+	bucket.tokens += now.Sub(bucket.last).Seconds() * rps
+	if bucket.tokens > float64(burst) {
+		bucket.tokens = float64(burst)
+	}
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		fmt.Println("lib/openfaas/ratelimit.go::localRateLimiter::Reserve end")
+		return 0, nil
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / rps * float64(time.Second))
+	fmt.Println("lib/openfaas/ratelimit.go::localRateLimiter::Reserve end")
+	return wait, nil
+}
+
+// RateLimitStore the shared state of a distributed RateLimiter, such as redis where
+// CompareAndSwap is a lua script comparing the value before setting it
+type RateLimitStore interface {
+	// Get returns the value of key, "" if key is not set
+	Get(key string) (string, error)
+	// CompareAndSwap sets key to new if its value is old, "" for a key not set,
+	// it returns false without setting key if the value changed
+	CompareAndSwap(key string, old string, new string) (bool, error)
+}
+
+// storeRateLimiter RateLimiter sharing its buckets through a RateLimitStore
+type storeRateLimiter struct {
+	store RateLimitStore
+	now   func() time.Time
+}
+
+// localRateLimitStore in process RateLimitStore
+type localRateLimitStore struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// NewStoreRateLimiter creates a RateLimiter whose buckets are kept in store, so that
+// the replicas sharing the store share the limits. A bucket is the theoretical
+// arrival time of the next call (GCRA), updated with CompareAndSwap
+func NewStoreRateLimiter(store RateLimitStore) RateLimiter {
+
+	fmt.Println("lib/openfaas/ratelimit.go::NewStoreRateLimiter start")
+	if store == nil {
+		panic("Error at NewStoreRateLimiter, store not specified")
+	}
+	fmt.Println("lib/openfaas/ratelimit.go::NewStoreRateLimiter end")
+	return &storeRateLimiter{store: store, now: time.Now}
+}
+
+// NewLocalRateLimitStore creates an in process RateLimitStore, the
+// stand-in of a distributed store for tests and single replica flows
+func NewLocalRateLimitStore() RateLimitStore {
+
+	fmt.Println("lib/openfaas/ratelimit.go::NewLocalRateLimitStore start")
+	fmt.Println("lib/openfaas/ratelimit.go::NewLocalRateLimitStore end")
+	return &localRateLimitStore{values: make(map[string]string)}
+}
+
+func (store *localRateLimitStore) Get(key string) (string, error) {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.values[key], nil
+}
+
+func (store *localRateLimitStore) CompareAndSwap(key string, old string, new string) (bool, error) {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.values[key] != old {
+		return false, nil
+	}
+	store.values[key] = new
+	return true, nil
+}
+
+// storeRateLimitRetries the attempts to update a bucket updated concurrently
+const storeRateLimitRetries = 16
+
+// Reserve takes a token from the bucket of the key in the store
+func (limiter *storeRateLimiter) Reserve(key string, rps float64, burst int) (time.Duration, error) {
+
+	fmt.Println("lib/openfaas/ratelimit.go::storeRateLimiter::Reserve start")
+	if rps <= 0 {
+		return 0, fmt.Errorf("invalid rate %v for %s", rps, key)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	interval := time.Duration(float64(time.Second) / rps)
+	key = "ratelimit-" + key
+
+	for attempt := 0; attempt < storeRateLimitRetries; attempt++ {
+		old, err := limiter.store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		now := limiter.now()
+		arrival := now
+		if old != "" {
+			stored, err := strconv.ParseInt(old, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid bucket %s, %v", key, err)
+			}
+			if next := time.Unix(0, stored); next.After(now) {
+				arrival = next
+			}
+		}
+		// the call is allowed once the next arrival is within the burst
+		next := arrival.Add(interval)
+		allowed := next.Add(-time.Duration(burst) * interval)
+		if allowed.After(now) {
+			fmt.Println("lib/openfaas/ratelimit.go::storeRateLimiter::Reserve end")
+			return allowed.Sub(now), nil
+		}
+		swapped, err := limiter.store.CompareAndSwap(key, old, strconv.FormatInt(next.UnixNano(), 10))
+		if err != nil {
+			return 0, err
+		}
+		if swapped {
+			fmt.Println("lib/openfaas/ratelimit.go::storeRateLimiter::Reserve end")
+			return 0, nil
+		}
+	}
+	return 0, fmt.Errorf("bucket %s is updated concurrently", key)
+}
+
+// rateLimitKey returns the key the operation shares its rate limit by
+func (operation *FaasOperation) rateLimitKey(gateway string) string {
+
+	fmt.Println("lib/openfaas/ratelimit.go::rateLimitKey start")
+	target := operation.HttpRequestUrl
+	if operation.Function != "" {
+		target = "http://" + gateway
+	}
+
+	// the operations share a bucket only if they have the same rate
+	config := fmt.Sprintf("%g/s,%d", operation.RateLimit.Rps, operation.RateLimit.Burst)
+	key := ""
+	switch operation.RateLimit.Scope {
+	case ScopeHost:
+		host := target
+		if u, err := url.Parse(target); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		key = "host:" + config + ":" + host
+	default:
+		if operation.Function != "" {
+			key = "function:" + config + ":" + operation.Function
+		} else {
+			key = "url:" + config + ":" + operation.HttpRequestUrl
+		}
+	}
+	fmt.Println("lib/openfaas/ratelimit.go::rateLimitKey end")
+	return key
+}
+
+// waitRateLimit blocks until the rate limit of the operation allows a call,
+// or fails with ERR_RATE_LIMITED once the wait exceeds MaxWait or ctx is done
+func (operation *FaasOperation) waitRateLimit(ctx context.Context, gateway string) error {
+
+	fmt.Println("lib/openfaas/ratelimit.go::waitRateLimit start")
+	policy := operation.RateLimit
+	if policy == nil || policy.Rps <= 0 {
+		return nil
+	}
+
+	key := operation.rateLimitKey(gateway)
+	limiter := getRateLimiter()
+	var waited time.Duration
+	for {
+		wait, err := limiter.Reserve(key, policy.Rps, policy.Burst)
+		if err != nil {
+			return fmt.Errorf("failed to reserve rate limit for %s, %v", key, err)
+		}
+		if wait <= 0 {
+			break
+		}
+		if policy.MaxWait >= 0 && waited+wait > policy.MaxWait {
+			return fmt.Errorf("%w for %s, %.2f calls/s", ERR_RATE_LIMITED, key, policy.Rps)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		waited += wait
+	}
+	fmt.Println("lib/openfaas/ratelimit.go::waitRateLimit end")
+	return nil
+}
@@ -0,0 +1,262 @@
+package openfaas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNow a clock advanced by the tests
+type fakeNow struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (clock *fakeNow) Now() time.Time {
+
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+func (clock *fakeNow) Advance(d time.Duration) {
+
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	clock.now = clock.now.Add(d)
+}
+
+// reserveAll reserves n tokens and returns the waits
+func reserveAll(t *testing.T, limiter RateLimiter, key string, rps float64, burst int, n int) []time.Duration {
+
+	waits := make([]time.Duration, n)
+	for i := range waits {
+		wait, err := limiter.Reserve(key, rps, burst)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		waits[i] = wait
+	}
+	return waits
+}
+
+func TestRateLimiters(t *testing.T) {
+
+	limiters := map[string]func(now func() time.Time) RateLimiter{
+		"local": func(now func() time.Time) RateLimiter {
+			limiter := newLocalRateLimiter()
+			limiter.now = now
+			return limiter
+		},
+		"store": func(now func() time.Time) RateLimiter {
+			limiter := NewStoreRateLimiter(NewLocalRateLimitStore()).(*storeRateLimiter)
+			limiter.now = now
+			return limiter
+		},
+	}
+	tests := []struct {
+		name  string
+		rps   float64
+		burst int
+		after time.Duration // the time elapsed before the last reservation
+		calls int
+		waits []time.Duration
+	}{
+		{"burst allowed at once", 10, 3, 0, 3, []time.Duration{0, 0, 0}},
+		{"call beyond the burst waits", 10, 2, 0, 3, []time.Duration{0, 0, 100 * time.Millisecond}},
+		{"burst below one allows one call", 4, 0, 0, 2, []time.Duration{0, 250 * time.Millisecond}},
+		{"token refilled after the interval", 10, 1, 100 * time.Millisecond, 2, []time.Duration{0, 0}},
+		{"token partially refilled", 10, 1, 40 * time.Millisecond, 2, []time.Duration{0, 60 * time.Millisecond}},
+	}
+	for name, create := range limiters {
+		for _, test := range tests {
+			t.Run(name+"/"+test.name, func(t *testing.T) {
+				clock := &fakeNow{now: time.Unix(1000, 0)}
+				limiter := create(clock.Now)
+				waits := reserveAll(t, limiter, "key", test.rps, test.burst, test.calls-1)
+				clock.Advance(test.after)
+				waits = append(waits, reserveAll(t, limiter, "key", test.rps, test.burst, 1)...)
+				for i, wait := range waits {
+					if wait.Round(time.Millisecond) != test.waits[i] {
+						t.Fatalf("call %d waits %v, expected %v", i, wait, test.waits[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestRateLimitersRejectInvalidRate(t *testing.T) {
+
+	for _, limiter := range []RateLimiter{newLocalRateLimiter(), NewStoreRateLimiter(NewLocalRateLimitStore())} {
+		_, err := limiter.Reserve("key", 0, 1)
+		if err == nil {
+			t.Fatalf("%T, expected an error for a zero rate", limiter)
+		}
+	}
+}
+
+func TestRateLimitDefinition(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		rps   float64
+		burst int
+		err   string
+	}{
+		{"zero rps", 0, 1, "Error at RateLimit, invalid rps 0"},
+		{"negative rps", -2, 1, "Error at RateLimit, invalid rps -2"},
+		{"infinite rps", math.Inf(1), 1, "Error at RateLimit, invalid rps +Inf"},
+		{"negative burst", 5, -1, "Error at RateLimit, invalid burst -1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), test.err) {
+					t.Fatalf("expected panic %q, got %v", test.err, r)
+				}
+			}()
+			NewDag().Node("order").Apply("f", RateLimit(test.rps, test.burst))
+		})
+	}
+
+	// a burst of zero allows one call at once
+	NewDag().Node("order").Apply("f", RateLimit(5, 0))
+}
+
+func TestStoreRateLimiterSharesBucketsBetweenReplicas(t *testing.T) {
+
+	store := NewLocalRateLimitStore()
+	clock := &fakeNow{now: time.Unix(1000, 0)}
+	replicas := make([]*storeRateLimiter, 3)
+	for i := range replicas {
+		replicas[i] = NewStoreRateLimiter(store).(*storeRateLimiter)
+		replicas[i].now = clock.Now
+	}
+
+	allowed := 0
+	for i := 0; i < 9; i++ {
+		wait, err := replicas[i%3].Reserve("key", 1, 4)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if wait == 0 {
+			allowed++
+		}
+	}
+	if allowed != 4 {
+		t.Fatalf("expected the replicas to share a burst of 4, %d calls allowed", allowed)
+	}
+	clock.Advance(time.Second)
+	wait, _ := replicas[0].Reserve("key", 1, 4)
+	if wait != 0 {
+		t.Fatalf("expected a token refilled after a second, waits %v", wait)
+	}
+}
+
+func TestStoreRateLimiterConcurrentReservations(t *testing.T) {
+
+	limiter := NewStoreRateLimiter(NewLocalRateLimitStore()).(*storeRateLimiter)
+	clock := &fakeNow{now: time.Unix(1000, 0)}
+	limiter.now = clock.Now
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	allowed := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := limiter.Reserve("key", 1, 5)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			if wait == 0 {
+				allowed++
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if allowed > 5 {
+		t.Fatalf("expected at most 5 calls allowed, %d allowed", allowed)
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+
+	operation := func(function string, url string, opts ...Option) *FaasOperation {
+		operation := createFunction(function)
+		if url != "" {
+			operation = createHttpRequest(url)
+		}
+		operation.applyOptions(opts)
+		return operation
+	}
+	tests := []struct {
+		name  string
+		a, b  *FaasOperation
+		equal bool
+	}{
+		{"same function and rate",
+			operation("f", "", RateLimit(5, 1)), operation("f", "", RateLimit(5, 1)), true},
+		{"other function",
+			operation("f", "", RateLimit(5, 1)), operation("g", "", RateLimit(5, 1)), false},
+		{"other rps",
+			operation("f", "", RateLimit(5, 1)), operation("f", "", RateLimit(10, 1)), false},
+		{"other burst",
+			operation("f", "", RateLimit(5, 1)), operation("f", "", RateLimit(5, 2)), false},
+		{"functions of the gateway host",
+			operation("f", "", RateLimit(5, 1), RateLimitScope(ScopeHost)),
+			operation("g", "", RateLimit(5, 1), RateLimitScope(ScopeHost)), true},
+		{"urls of the same host",
+			operation("", "https://api.example.com/a", RateLimit(5, 1), RateLimitScope(ScopeHost)),
+			operation("", "https://api.example.com/b", RateLimit(5, 1), RateLimitScope(ScopeHost)), true},
+		{"urls of the same host with other rates",
+			operation("", "https://api.example.com/a", RateLimit(5, 1), RateLimitScope(ScopeHost)),
+			operation("", "https://api.example.com/b", RateLimit(1, 1), RateLimitScope(ScopeHost)), false},
+		{"other urls",
+			operation("", "https://api.example.com/a", RateLimit(5, 1)),
+			operation("", "https://api.example.com/b", RateLimit(5, 1)), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := test.a.rateLimitKey("gateway:8080"), test.b.rateLimitKey("gateway:8080")
+			if (a == b) != test.equal {
+				t.Fatalf("keys %q and %q, expected equal %v", a, b, test.equal)
+			}
+		})
+	}
+}
+
+func TestWaitRateLimitMaxWait(t *testing.T) {
+
+	SetRateLimiter(NewStoreRateLimiter(NewLocalRateLimitStore()))
+	defer SetRateLimiter(nil)
+
+	operation := createFunction("limited")
+	operation.applyOptions([]Option{RateLimit(1, 1), RateLimitMaxWait(0)})
+	err := operation.waitRateLimit(context.Background(), "gateway:8080")
+	if err != nil {
+		t.Fatalf("expected the first call allowed, got %v", err)
+	}
+	err = operation.waitRateLimit(context.Background(), "gateway:8080")
+	if !errors.Is(err, ERR_RATE_LIMITED) {
+		t.Fatalf("expected ERR_RATE_LIMITED, got %v", err)
+	}
+
+	waiting := createFunction("limited")
+	waiting.applyOptions([]Option{RateLimit(1, 1)})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = waiting.waitRateLimit(ctx, "gateway:8080")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to end with the context, got %v", err)
+	}
+}
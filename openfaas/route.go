@@ -0,0 +1,268 @@
+package openfaas
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+var (
+	// routes is the process wide registry of routing metrics by vertex
+	routes = &routeRegistry{stats: make(map[string]map[string]int64)}
+)
+
+// StickyKey extracts the key a routing decision sticks to from the payload
+type StickyKey func([]byte) string
+
+// RouteTarget a function and its share of the traffic
+type RouteTarget struct {
+	Function string // The function
+	Weight   int    // The relative weight of the function
+}
+
+// RouteStats routing metrics of a vertex
+type RouteStats struct {
+	Vertex  string           // The vertex the routing belongs to
+	Targets map[string]int64 // Executions routed to each function
+}
+
+// RouteOperation executes one of several functions picked by weight
+type RouteOperation struct {
+	Vertex          string           // The vertex the operation belongs to
+	Targets         []RouteTarget    // The functions and their weight
+	Functions       []*FaasOperation // The function operation of each target
+	StickyKey       StickyKey        // Extracts the key routing sticks to, optional
+	StickyOnRequest bool             // Routing sticks to the request id
+	Context         *Context         // Records the chosen function, optional
+	ErrorVertex     string           // The vertex whose failures are routed to an error edge, if any
+
+	node  *sdk.Node // the vertex the operation belongs to
+	scope *dagScope // the scope of the dag the operation belongs to
+}
+
+// routeRegistry process wide routing metrics
+type routeRegistry struct {
+	mu    sync.Mutex
+	stats map[string]map[string]int64
+}
+
+// Weighted creates a RouteTarget
+func Weighted(function string, weight int) RouteTarget {
+
+	fmt.Println("lib/openfaas/route.go::Weighted start")
+	fmt.Println("lib/openfaas/route.go::Weighted end")
+	return RouteTarget{Function: function, Weight: weight}
+}
+
+// RouteKey is the context key the function chosen at a vertex is recorded at
+func RouteKey(vertex string) string {
+
+	return "route-" + vertex
+}
+
+// record records the function an execution of a vertex is routed to
+func (registry *routeRegistry) record(vertex string, function string) {
+
+	fmt.Println("lib/openfaas/route.go::routeRegistry::record start")
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	targets, ok := registry.stats[vertex]
+	if !ok {
+		targets = make(map[string]int64)
+		registry.stats[vertex] = targets
+	}
+	targets[function]++
+	fmt.Println("lib/openfaas/route.go::routeRegistry::record end")
+}
+
+// GetRouteStats returns the routing metrics of all the routed vertices of the process
+func GetRouteStats() []RouteStats {
+
+	fmt.Println("lib/openfaas/route.go::GetRouteStats start")
+	routes.mu.Lock()
+	result := make([]RouteStats, 0, len(routes.stats))
+	for vertex, targets := range routes.stats {
+		stats := RouteStats{Vertex: vertex, Targets: make(map[string]int64)}
+		for function, count := range targets {
+			stats.Targets[function] = count
+		}
+		result = append(result, stats)
+	}
+	routes.mu.Unlock()
+	sort.Slice(result, func(i, j int) bool { return result[i].Vertex < result[j].Vertex })
+	fmt.Println("lib/openfaas/route.go::GetRouteStats end")
+	return result
+}
+
+// pick picks the index of the target for an execution, executions sharing
+// a sticky key always pick the same target
+func (operation *RouteOperation) pick(data []byte, reqId string) int {
+
+	fmt.Println("lib/openfaas/route.go::pick start")
+	total := 0
+	for _, target := range operation.Targets {
+		total += target.Weight
+	}
+
+	key := ""
+	switch {
+	case operation.StickyKey != nil:
+		key = operation.StickyKey(data)
+	case operation.StickyOnRequest:
+		key = reqId
+	}
+
+	var point int
+	if key != "" {
+		hash := fnv.New32a()
+		hash.Write([]byte(key))
+		point = int(hash.Sum32() % uint32(total))
+	} else {
+		point = rand.Intn(total)
+	}
+
+	for index, target := range operation.Targets {
+		if point < target.Weight {
+			fmt.Println("lib/openfaas/route.go::pick end")
+			return index
+		}
+		point -= target.Weight
+	}
+	fmt.Println("lib/openfaas/route.go::pick end")
+	return len(operation.Targets) - 1
+}
+
+func (operation *RouteOperation) GetId() string {
+
+	fmt.Println("lib/openfaas/route.go::GetId start")
+	fmt.Println("lib/openfaas/route.go::GetId end")
+	return "route-" + operation.Vertex
+}
+
+func (operation *RouteOperation) Encode() []byte {
+
+	fmt.Println("lib/openfaas/route.go::Encode start")
+	fmt.Println("lib/openfaas/route.go::Encode end")
+	return []byte("")
+}
+
+func (operation *RouteOperation) GetProperties() map[string][]string {
+
+	fmt.Println("lib/openfaas/route.go::GetProperties start")
+	result := make(map[string][]string)
+
+	targets := []string{}
+	for _, target := range operation.Targets {
+		targets = append(targets, target.Function+"="+strconv.Itoa(target.Weight))
+	}
+	isSticky := "false"
+	if operation.StickyKey != nil || operation.StickyOnRequest {
+		isSticky = "true"
+	}
+
+	result["isMod"] = []string{"false"}
+	result["isFunction"] = []string{"true"}
+	result["isHttpRequest"] = []string{"false"}
+	result["isRoute"] = []string{"true"}
+	result["isSticky"] = []string{isSticky}
+	result["routeTargets"] = targets
+
+	fmt.Println("lib/openfaas/route.go::GetProperties end")
+	return result
+}
+
+func (operation *RouteOperation) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/route.go::Execute start")
+	// a skipped path or a routed failure passes through the vertex
+	if isMarker(data) {
+		return passMarker(data, operation.ErrorVertex)
+	}
+	reqId := fmt.Sprintf("%v", option["request-id"])
+	result, err := operation.route(data, option)
+	if err != nil && operation.ErrorVertex != "" {
+		fmt.Printf("[Request `%s`] Routing failure of vertex `%s` to its error edge, %v\n",
+			reqId, operation.ErrorVertex, err)
+		return encodeFailure(operation.ErrorVertex, operation.GetId(), data, err), nil
+	}
+	fmt.Println("lib/openfaas/route.go::Execute end")
+	return result, err
+}
+
+// route executes the function picked for the execution
+func (operation *RouteOperation) route(data []byte, option map[string]interface{}) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/route.go::route start")
+	reqId := fmt.Sprintf("%v", option["request-id"])
+
+	index := operation.pick(data, reqId)
+	function := operation.Targets[index].Function
+	fmt.Printf("[Request `%s`] Routing vertex `%s` to function `%s`\n",
+		reqId, operation.Vertex, function)
+
+	routes.record(operation.Vertex, function)
+	if operation.Context != nil {
+		err := (*sdk.Context)(operation.Context).Set(RouteKey(operation.Vertex), function)
+		if err != nil {
+			return nil, fmt.Errorf("Route(%s), error: failed to record chosen function %s, %v",
+				operation.Vertex, function, err)
+		}
+	}
+
+	fmt.Println("lib/openfaas/route.go::route end")
+	return operation.Functions[index].Execute(data, option)
+}
+
+// Route adds an operation to the given vertex which executes one of the targets
+// picked by weight, the call options apply to every target
+func (node *Node) Route(targets []RouteTarget, opts ...Option) *Node {
+
+	fmt.Println("lib/openfaas/route.go::Route start")
+	vertex := node.unode.Id
+	if len(targets) == 0 {
+		panic(fmt.Sprintf("Error at Route for %s, no target specified", vertex))
+	}
+
+	operation := &RouteOperation{Vertex: vertex}
+	for _, target := range targets {
+		if target.Function == "" || target.Weight < 0 {
+			panic(fmt.Sprintf("Error at Route for %s, invalid target %s with weight %d",
+				vertex, target.Function, target.Weight))
+		}
+		if target.Weight == 0 {
+			continue
+		}
+		function := createFunction(target.Function)
+		function.applyOptions(opts)
+		operation.Targets = append(operation.Targets, target)
+		operation.Functions = append(operation.Functions, function)
+	}
+	if len(operation.Targets) == 0 {
+		panic(fmt.Sprintf("Error at Route for %s, all targets have zero weight", vertex))
+	}
+
+	o := &Options{}
+	for _, opt := range opts {
+		o.reset()
+		opt(o)
+		if o.stickyKey != nil {
+			operation.StickyKey = o.stickyKey
+		}
+		if o.stickyOnRequest {
+			operation.StickyOnRequest = true
+		}
+		if o.routeContext != nil {
+			operation.Context = o.routeContext
+		}
+	}
+
+	node.register(operation)
+	node.unode.AddOperation(operation)
+	fmt.Println("lib/openfaas/route.go::Route end")
+	return node
+}
@@ -0,0 +1,148 @@
+package openfaas
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+// routeOperation returns the route of the vertex order
+func routeOperation(dag *Dag, targets []RouteTarget, opts ...Option) *RouteOperation {
+
+	dag.Node("order").Route(targets, opts...)
+	return dag.udag.GetNode("order").Operations()[0].(*RouteOperation)
+}
+
+func TestRouteWeights(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		targets []RouteTarget
+		shares  map[string]float64 // the expected share of each function
+	}{
+		{"single target", []RouteTarget{Weighted("a", 5)}, map[string]float64{"a": 1}},
+		{"weighted", []RouteTarget{Weighted("a", 1), Weighted("b", 3)}, map[string]float64{"a": 0.25, "b": 0.75}},
+		{"zero weight never picked", []RouteTarget{Weighted("a", 0), Weighted("b", 1), Weighted("c", 1)},
+			map[string]float64{"a": 0, "b": 0.5, "c": 0.5}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			operation := routeOperation(NewDag(), test.targets)
+			const picks = 4000
+			counts := map[string]int{}
+			for i := 0; i < picks; i++ {
+				counts[operation.Targets[operation.pick([]byte(`{}`), "r")].Function]++
+			}
+			for function, share := range test.shares {
+				got := float64(counts[function]) / picks
+				if got < share-0.05 || got > share+0.05 {
+					t.Fatalf("expected a share of %v for %s, got %v", share, function, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRouteSticky(t *testing.T) {
+
+	tests := []struct {
+		name string
+		opts []Option
+		data func(i int) string
+		req  func(i int) string
+	}{
+		{"sticky key", []Option{StickyOn(func(data []byte) string { return string(data) })},
+			func(i int) string { return fmt.Sprintf("user-%d", i) }, func(i int) string { return "r" }},
+		{"sticky request", []Option{StickyOnRequest()},
+			func(i int) string { return "{}" }, func(i int) string { return fmt.Sprintf("r-%d", i) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			operation := routeOperation(NewDag(), []RouteTarget{Weighted("a", 1), Weighted("b", 1)}, test.opts...)
+			picked := map[int]bool{}
+			for i := 0; i < 100; i++ {
+				first := operation.pick([]byte(test.data(i)), test.req(i))
+				for repeat := 0; repeat < 5; repeat++ {
+					if index := operation.pick([]byte(test.data(i)), test.req(i)); index != first {
+						t.Fatalf("expected key %d to stick to %d, got %d", i, first, index)
+					}
+				}
+				picked[first] = true
+			}
+			// the keys still spread over the targets
+			if len(picked) != 2 {
+				t.Fatalf("expected both targets picked, got %v", picked)
+			}
+		})
+	}
+}
+
+func TestRouteRecordsChoice(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/function/")))
+	}))
+	defer server.Close()
+
+	context := templateContext(nil)
+	operation := routeOperation(NewDag(), []RouteTarget{Weighted("a", 0), Weighted("b", 2)}, RecordRoute(context))
+	before := routeCount("order", "b")
+	result, err := operation.Execute([]byte(`{}`), map[string]interface{}{"request-id": "r",
+		"gateway": strings.TrimPrefix(server.URL, "http://")})
+	if err != nil || string(result) != "b" {
+		t.Fatalf("expected the call of b, got %s, %v", result, err)
+	}
+	if function, err := (*sdk.Context)(context).Get(RouteKey("order")); err != nil || function != "b" {
+		t.Fatalf("expected b recorded at %s, got %v, %v", RouteKey("order"), function, err)
+	}
+	if count := routeCount("order", "b"); count != before+1 {
+		t.Fatalf("expected the execution counted, got %d", count-before)
+	}
+
+	// a skipped path passes through without a call
+	result, err = operation.Execute(skippedPayload, map[string]interface{}{"request-id": "r"})
+	if err != nil || string(result) != string(skippedPayload) {
+		t.Fatalf("expected the marker passed on, got %s, %v", result, err)
+	}
+}
+
+// routeCount returns the executions of vertex routed to function
+func routeCount(vertex string, function string) int64 {
+
+	for _, stats := range GetRouteStats() {
+		if stats.Vertex == vertex {
+			return stats.Targets[function]
+		}
+	}
+	return 0
+}
+
+func TestRouteDefinition(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		targets []RouteTarget
+		err     string
+	}{
+		{"no target", nil, "Error at Route for order, no target specified"},
+		{"negative weight", []RouteTarget{Weighted("a", 1), Weighted("b", -1)},
+			"Error at Route for order, invalid target b with weight -1"},
+		{"no function", []RouteTarget{Weighted("", 1)}, "Error at Route for order, invalid target  with weight 1"},
+		{"zero weights", []RouteTarget{Weighted("a", 0), Weighted("b", 0)},
+			"Error at Route for order, all targets have zero weight"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), test.err) {
+					t.Fatalf("expected panic %q, got %v", test.err, r)
+				}
+			}()
+			NewDag().Node("order").Route(test.targets)
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package openfaas
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+const (
+	// sagaStepCompleted denotes a step completed and not yet compensated
+	sagaStepCompleted = "completed"
+	// sagaStepCompensated denotes a step compensated
+	sagaStepCompensated = "compensated"
+)
+
+// saga saga mode state of a workflow
+type saga struct {
+	store StateStore // persists the progress of the steps
+}
+
+// sagaStep a compensable step of the workflow
+type sagaStep struct {
+	node         *sdk.Node      // the vertex the step belongs to
+	index        int            // the index of the operation in the vertex
+	compensation *FaasOperation // the undo of the step
+}
+
+// sagaRecord the persisted progress of a step
+type sagaRecord struct {
+	Seq       int    `json:"seq"`
+	Step      string `json:"step"`
+	State     string `json:"state"`
+	Output    []byte `json:"output"`
+	RequestId string `json:"request-id"`
+	Gateway   string `json:"gateway"`
+}
+
+const (
+	// sagaSeqKey the counter of the completed steps, it orders the compensations
+	sagaSeqKey = "saga-seq"
+)
+
+// Saga enables the saga mode, when the workflow fails the compensation of every
+// completed step is run in the reverse completion order. The progress is
+// persisted in the store, which must be the StateStore of the request, so that
+// a compensation interrupted by a restart resumes where it stopped
+func (flow *Workflow) Saga(store StateStore) {
+
+	fmt.Println("lib/openfaas/saga.go::Saga start")
+	if store == nil {
+		panic("Error at Saga, state store not specified")
+	}
+	flow.saga = &saga{store: store}
+	flow.pipeline.FailureHandler = flow.compensate
+	fmt.Println("lib/openfaas/saga.go::Saga end")
+}
+
+// Compensate adds a step to the given vertex that passes its input through and,
+// in saga mode, undoes the operations before it when the workflow fails
+func (node *Node) Compensate(target interface{}) *Node {
+
+	fmt.Println("lib/openfaas/saga.go::Compensate start")
+	step := createModifier(BLANK_MODIFIER)
+	step.addCompensation(parseTarget("Compensate", target))
+	node.addOperation(step)
+	fmt.Println("lib/openfaas/saga.go::Compensate end")
+	return node
+}
+
+// addStep registers the compensable operation about to be added to the vertex
+func (node *Node) addStep(operation *FaasOperation) {
+
+	fmt.Println("lib/openfaas/saga.go::addStep start")
+	if operation.Compensation == nil {
+		return
+	}
+	step := &sagaStep{
+		node:         node.unode,
+		index:        len(node.unode.Operations()),
+		compensation: operation.Compensation,
+	}
+	operation.step = step
+	operation.scope = node.scope
+	node.scope.steps = append(node.scope.steps, step)
+	fmt.Println("lib/openfaas/saga.go::addStep end")
+}
+
+// key returns the key of the step in the definition, built from
+// the path of the vertex so that it is stable across the requests
+func (step *sagaStep) key() string {
+
+	return fmt.Sprintf("saga-%s-%d", vertexPath(step.node), step.index)
+}
+
+// executionKey returns the state store key of the record of the step in the
+// current execution, every item of a ForEachBranch records its own step
+func (operation *FaasOperation) executionKey() string {
+
+	return fmt.Sprintf("saga-%s-%d", executionPath(operation.step.node, operation.scope), operation.step.index)
+}
+
+// sagaSeqEntry the state store key of the step completed at seq
+func sagaSeqEntry(seq int) string {
+
+	return fmt.Sprintf("%s-%d", sagaSeqKey, seq)
+}
+
+// vertexPath returns the path of a vertex through the vertices of the sub-dags it belongs to
+func vertexPath(node *sdk.Node) string {
+
+	path := []string{node.Id}
+	for parent := node.ParentDag().GetParentNode(); parent != nil; parent = parent.ParentDag().GetParentNode() {
+		path = append([]string{parent.Id}, path...)
+	}
+	return strings.Join(path, ".")
+}
+
+// recordStep persists the completion of a compensable operation
+func (operation *FaasOperation) recordStep(option map[string]interface{}, result []byte) error {
+
+	fmt.Println("lib/openfaas/saga.go::recordStep start")
+	if operation.step == nil || operation.scope == nil {
+		return nil
+	}
+	flow := operation.scope.workflow()
+	if flow == nil || flow.saga == nil {
+		return nil
+	}
+
+	// the counter of the store orders the completions across the replicas
+	store := flow.saga.store
+	seq, err := incrementCounter(store, sagaSeqKey, 1)
+	if err != nil {
+		return fmt.Errorf("failed to order saga step, %v", err)
+	}
+	record := &sagaRecord{
+		Seq:       seq,
+		Step:      operation.step.key(),
+		State:     sagaStepCompleted,
+		Output:    result,
+		RequestId: fmt.Sprintf("%v", option["request-id"]),
+		Gateway:   fmt.Sprintf("%v", option["gateway"]),
+	}
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode saga step, %v", err)
+	}
+	key := operation.executionKey()
+	// the entry is written first, an entry without record is skipped
+	err = store.Set(sagaSeqEntry(seq), key)
+	if err != nil {
+		return fmt.Errorf("failed to record saga step %s, %v", key, err)
+	}
+	err = store.Set(key, string(encoded))
+	if err != nil {
+		return fmt.Errorf("failed to record saga step %s, %v", key, err)
+	}
+	fmt.Println("lib/openfaas/saga.go::recordStep end")
+	return nil
+}
+
+// collectSteps returns the compensable steps of the scope and its children
+func (scope *dagScope) collectSteps() []*sagaStep {
+
+	steps := append([]*sagaStep{}, scope.steps...)
+	for _, child := range scope.children {
+		steps = append(steps, child.collectSteps()...)
+	}
+	return steps
+}
+
+// compensate runs the compensation of the completed steps in the reverse
+// completion order, then calls the failure handler set by OnFailure
+func (flow *Workflow) compensate(err error) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/saga.go::compensate start")
+	type completedStep struct {
+		step   *sagaStep
+		key    string
+		state  string
+		record *sagaRecord
+	}
+
+	steps := make(map[string]*sagaStep)
+	for _, step := range flow.scope.collectSteps() {
+		steps[step.key()] = step
+	}
+
+	// the entries of the counter list the completed steps, the last completion first
+	store := flow.saga.store
+	completed := []*completedStep{}
+	last := 0
+	if encoded, gerr := store.Get(sagaSeqKey); gerr == nil && encoded != "" {
+		last, _ = strconv.Atoi(encoded)
+	}
+	seen := make(map[string]bool)
+	for seq := last; seq > 0; seq-- {
+		key, gerr := store.Get(sagaSeqEntry(seq))
+		if gerr != nil || key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		state, gerr := store.Get(key)
+		if gerr != nil || state == "" {
+			continue
+		}
+		record := &sagaRecord{}
+		if jerr := json.Unmarshal([]byte(state), record); jerr != nil {
+			fmt.Printf("Saga step %s has an invalid record, %v\n", key, jerr)
+			continue
+		}
+		step, ok := steps[record.Step]
+		if !ok || record.State != sagaStepCompleted {
+			continue
+		}
+		completed = append(completed, &completedStep{step: step, key: key, state: state, record: record})
+	}
+
+	failures := []string{}
+	for _, c := range completed {
+		fmt.Printf("[Request `%s`] Compensating saga step %s\n", c.record.RequestId, c.key)
+		option := map[string]interface{}{"request-id": c.record.RequestId, "gateway": c.record.Gateway}
+		_, cerr := c.step.compensation.Execute(c.record.Output, option)
+		if cerr != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", c.key, cerr))
+			continue
+		}
+		c.record.State = sagaStepCompensated
+		encoded, _ := json.Marshal(c.record)
+		// compare and update so a step is never marked over a newer record
+		uerr := store.Update(c.key, c.state, string(encoded))
+		if uerr != nil {
+			failures = append(failures, fmt.Sprintf("%s: failed to record compensation, %v", c.key, uerr))
+		}
+	}
+
+	if len(failures) != 0 {
+		err = fmt.Errorf("%v, compensation failed for [%s]", err, strings.Join(failures, "; "))
+	}
+
+	fmt.Println("lib/openfaas/saga.go::compensate end")
+	if flow.failureHandler != nil {
+		return flow.failureHandler(err)
+	}
+	return nil, err
+}
@@ -0,0 +1,78 @@
+package openfaas
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+func TestSagaCompensatesEveryForEachItem(t *testing.T) {
+
+	pipeline := sdk.CreatePipeline()
+	flow := GetWorkflow(pipeline)
+	store := newMemoryStore()
+	flow.Saga(store)
+
+	compensated := []string{}
+	items := flow.Dag().ForEachBranch("items", func(data []byte) map[string][]byte { return nil },
+		Aggregator(func(map[string][]byte) ([]byte, error) { return nil, nil }))
+	items.Node("step").Compensate(ModifierFallback(func(data []byte) ([]byte, error) {
+		compensated = append(compensated, string(data))
+		return nil, nil
+	}))
+	step := items.udag.GetNode("step").Operations()[0]
+
+	for _, item := range []string{"a", "b", "c"} {
+		enterForEach(pipeline, "items", item, "step")
+		_, err := step.Execute([]byte("output-"+item), map[string]interface{}{"request-id": "request"})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	// a re-executed step is compensated once
+	enterForEach(pipeline, "items", "b", "step")
+	step.Execute([]byte("output-b"), map[string]interface{}{"request-id": "request"})
+
+	_, err := flow.compensate(errors.New("failure"))
+	if err == nil || err.Error() != "failure" {
+		t.Fatalf("expected the failure, got %v", err)
+	}
+	if strings.Join(compensated, ",") != "output-b,output-c,output-a" {
+		t.Fatalf("expected every item compensated in the reverse completion order, got %v", compensated)
+	}
+
+	// the compensated steps are not compensated again
+	compensated = nil
+	flow.compensate(errors.New("failure"))
+	if len(compensated) != 0 {
+		t.Fatalf("expected no compensation of compensated steps, got %v", compensated)
+	}
+}
+
+func TestSagaSkipsSwallowedFailures(t *testing.T) {
+
+	pipeline := sdk.CreatePipeline()
+	flow := GetWorkflow(pipeline)
+	store := newMemoryStore()
+	flow.Saga(store)
+
+	compensated := 0
+	flow.Dag().Node("step").Apply("unreachable",
+		OnFailure(func(err error) error { return nil }),
+		Compensate(ModifierFallback(func(data []byte) ([]byte, error) {
+			compensated++
+			return nil, nil
+		})))
+	step := pipeline.Dag.GetNode("step").Operations()[0]
+
+	_, err := step.Execute([]byte("input"), map[string]interface{}{"request-id": "request", "gateway": "127.0.0.1:1"})
+	if err != nil {
+		t.Fatalf("expected the failure swallowed, got %v", err)
+	}
+	flow.compensate(errors.New("failure"))
+	if compensated != 0 {
+		t.Fatalf("expected no compensation of a failed call, got %d", compensated)
+	}
+}
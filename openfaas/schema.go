@@ -0,0 +1,228 @@
+package openfaas
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const (
+	// schemaInput validates the data entering a vertex
+	schemaInput = "input"
+	// schemaOutput validates the data leaving a vertex
+	schemaOutput = "output"
+)
+
+// SchemaViolation a violation of a JSON Schema
+type SchemaViolation struct {
+	Pointer     string `json:"pointer"`     // The JSON pointer of the invalid value, "" for the whole payload
+	Expectation string `json:"expectation"` // The expectation of the schema the value fails
+}
+
+// SchemaError the failure of the validation of the data entering or leaving a vertex
+type SchemaError struct {
+	Vertex     string             // The validated vertex
+	Direction  string             // "input" or "output"
+	Violations []*SchemaViolation // The violations of the schema
+}
+
+func (err *SchemaError) Error() string {
+
+	violations := make([]string, len(err.Violations))
+	for i, violation := range err.Violations {
+		at := "at the root"
+		if violation.Pointer != "" {
+			at = fmt.Sprintf("at `%s`", violation.Pointer)
+		}
+		violations[i] = fmt.Sprintf("%s: %s", at, violation.Expectation)
+	}
+	return fmt.Sprintf("Schema(%s), error: invalid %s, %s", err.Vertex, err.Direction, strings.Join(violations, "; "))
+}
+
+// SchemaOperation validates the data entering or leaving a vertex against a JSON Schema
+type SchemaOperation struct {
+	Vertex         string           // The vertex the operation belongs to
+	Direction      string           // "input" or "output"
+	Schema         string           // The JSON Schema
+	FailureHandler FuncErrorHandler // The Failure handler of the validation
+	ErrorVertex    string           // The vertex routing the failures, if any
+
+	schema *jsonschema.Schema // the compiled Schema
+	node   *sdk.Node          // the vertex the operation belongs to
+	scope  *dagScope          // the dag defining the vertex
+}
+
+// InputSchema validates the data entering the vertex against a JSON Schema, it must be
+// declared before the operations of the vertex. Invalid data fails the vertex with a
+// *SchemaError listing the violations, the OnFailure option handles the failure
+func (node *Node) InputSchema(schema string, opts ...Option) *Node {
+
+	fmt.Println("lib/openfaas/schema.go::InputSchema start")
+	if len(node.unode.Operations()) != 0 {
+		panic(fmt.Sprintf("Error at InputSchema for %s, the input schema must be declared before the operations",
+			node.unode.Id))
+	}
+	node.addSchema(schemaInput, schema, opts)
+	fmt.Println("lib/openfaas/schema.go::InputSchema end")
+	return node
+}
+
+// OutputSchema validates the data leaving the vertex against a JSON Schema, it must be
+// declared after the operations of the vertex. Invalid data fails the vertex with a
+// *SchemaError listing the violations, the OnFailure option handles the failure
+func (node *Node) OutputSchema(schema string, opts ...Option) *Node {
+
+	fmt.Println("lib/openfaas/schema.go::OutputSchema start")
+	node.addSchema(schemaOutput, schema, opts)
+	fmt.Println("lib/openfaas/schema.go::OutputSchema end")
+	return node
+}
+
+// addSchema adds a schema validation to the vertex
+func (node *Node) addSchema(direction string, source string, opts []Option) {
+
+	compiler := jsonschema.NewCompiler()
+	url := fmt.Sprintf("faasflow://%s/%s.json", node.unode.Id, direction)
+	err := compiler.AddResource(url, strings.NewReader(source))
+	var schema *jsonschema.Schema
+	if err == nil {
+		schema, err = compiler.Compile(url)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("Error at Schema for %s, invalid %s schema, %v", node.unode.Id, direction, err))
+	}
+	operation := &SchemaOperation{Vertex: node.unode.Id, Direction: direction, Schema: source, schema: schema}
+
+	o := &Options{}
+	for _, opt := range opts {
+		o.reset()
+		opt(o)
+		if o.failureHandler != nil {
+			operation.FailureHandler = o.failureHandler
+		}
+	}
+	node.register(operation)
+	node.unode.AddOperation(operation)
+}
+
+// checkOutputSchema checks no operation follows the output schema of the vertex
+func (node *Node) checkOutputSchema() {
+
+	operations := node.unode.Operations()
+	if len(operations) == 0 {
+		return
+	}
+	if last, ok := operations[len(operations)-1].(*SchemaOperation); ok && last.Direction == schemaOutput {
+		panic(fmt.Sprintf("Error at %s, the output schema must be declared after the operations", node.unode.Id))
+	}
+}
+
+func (operation *SchemaOperation) bind(node *sdk.Node, scope *dagScope) {
+
+	operation.node = node
+	operation.scope = scope
+}
+
+func (operation *SchemaOperation) routeErrors(vertex string) {
+
+	operation.ErrorVertex = vertex
+}
+
+func (operation *SchemaOperation) GetId() string {
+
+	fmt.Println("lib/openfaas/schema.go::GetId start")
+	fmt.Println("lib/openfaas/schema.go::GetId end")
+	return operation.Direction + "-schema-" + operation.Vertex
+}
+
+func (operation *SchemaOperation) Encode() []byte {
+
+	fmt.Println("lib/openfaas/schema.go::Encode start")
+	fmt.Println("lib/openfaas/schema.go::Encode end")
+	return []byte(operation.Schema)
+}
+
+func (operation *SchemaOperation) GetProperties() map[string][]string {
+
+	fmt.Println("lib/openfaas/schema.go::GetProperties start")
+	result := make(map[string][]string)
+	hasFailureHandler := "false"
+	if operation.FailureHandler != nil {
+		hasFailureHandler = "true"
+	}
+	result["isMod"] = []string{"false"}
+	result["isFunction"] = []string{"false"}
+	result["isHttpRequest"] = []string{"false"}
+	result["isSchema"] = []string{"true"}
+	result["hasFailureHandler"] = []string{hasFailureHandler}
+	result[operation.Direction+"Schema"] = []string{operation.Schema}
+	fmt.Println("lib/openfaas/schema.go::GetProperties end")
+	return result
+}
+
+func (operation *SchemaOperation) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/schema.go::Execute start")
+	// a skipped path or a routed failure passes through the vertex
+	if isMarker(data) {
+		return passMarker(data, operation.ErrorVertex)
+	}
+	reqId := fmt.Sprintf("%v", option["request-id"])
+	err := operation.validate(data)
+	if err != nil && operation.FailureHandler != nil {
+		err = operation.FailureHandler(err)
+	}
+	if err != nil && operation.ErrorVertex != "" {
+		fmt.Printf("[Request `%s`] Routing failure of vertex `%s` to its error edge, %v\n",
+			reqId, operation.ErrorVertex, err)
+		return encodeFailure(operation.ErrorVertex, operation.GetId(), data, err), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("lib/openfaas/schema.go::Execute end")
+	return data, nil
+}
+
+// validate validates data against the schema
+func (operation *SchemaOperation) validate(data []byte) error {
+
+	fmt.Println("lib/openfaas/schema.go::validate start")
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&doc)
+	if err != nil {
+		return &SchemaError{Vertex: operation.Vertex, Direction: operation.Direction,
+			Violations: []*SchemaViolation{{Expectation: fmt.Sprintf("valid JSON, %v", err)}}}
+	}
+	err = operation.schema.Validate(doc)
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		schemaErr := &SchemaError{Vertex: operation.Vertex, Direction: operation.Direction}
+		schemaErr.Violations = violations(validationErr, nil)
+		return schemaErr
+	}
+	if err != nil {
+		return fmt.Errorf("Schema(%s), error: failed to validate %s, %v", operation.Vertex, operation.Direction, err)
+	}
+	fmt.Println("lib/openfaas/schema.go::validate end")
+	return nil
+}
+
+// violations returns the most specific violations of a validation error
+func violations(err *jsonschema.ValidationError, result []*SchemaViolation) []*SchemaViolation {
+
+	if len(err.Causes) == 0 {
+		return append(result, &SchemaViolation{Pointer: err.InstanceLocation, Expectation: err.Message})
+	}
+	for _, cause := range err.Causes {
+		result = violations(cause, result)
+	}
+	return result
+}
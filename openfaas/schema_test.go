@@ -0,0 +1,188 @@
+package openfaas
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["id", "items"],
+	"properties": {
+		"id": {"type": "string"},
+		"items": {"type": "array", "items": {"type": "object", "required": ["qty"],
+			"properties": {"qty": {"type": "integer", "minimum": 1}}}}
+	}
+}`
+
+// schemaOperation returns the schema validation added by add to the vertex order
+func schemaOperation(dag *Dag, add func(node *Node)) *SchemaOperation {
+
+	add(dag.Node("order"))
+	for _, operation := range dag.udag.GetNode("order").Operations() {
+		if schema, ok := operation.(*SchemaOperation); ok {
+			return schema
+		}
+	}
+	return nil
+}
+
+func TestSchemaValidation(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		data       string
+		violations []*SchemaViolation
+	}{
+		{"valid", `{"id":"a","items":[{"qty":2}]}`, nil},
+		{"large integer", `{"id":"a","items":[{"qty":12345678901234567890}]}`, nil},
+		{"wrong type", `{"id":1,"items":[]}`, []*SchemaViolation{
+			{Pointer: "/id", Expectation: "expected string, but got number"}}},
+		{"missing field", `{"items":[]}`, []*SchemaViolation{
+			{Pointer: "", Expectation: "missing properties: 'id'"}}},
+		{"nested violations", `{"id":"a","items":[{"qty":0},{"qty":1.5}]}`, []*SchemaViolation{
+			{Pointer: "/items/0/qty", Expectation: "must be >= 1 but found 0"},
+			{Pointer: "/items/1/qty", Expectation: "expected integer, but got number"}}},
+		{"invalid JSON", `{"id":`, []*SchemaViolation{
+			{Pointer: "", Expectation: "valid JSON, unexpected EOF"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			operation := schemaOperation(NewDag(), func(node *Node) { node.InputSchema(orderSchema) })
+			err := operation.validate([]byte(test.data))
+			if test.violations == nil {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+			var schemaErr *SchemaError
+			if !errors.As(err, &schemaErr) {
+				t.Fatalf("expected a SchemaError, got %v", err)
+			}
+			if schemaErr.Vertex != "order" || schemaErr.Direction != schemaInput ||
+				!reflect.DeepEqual(schemaErr.Violations, test.violations) {
+				encoded, _ := json.Marshal(schemaErr.Violations)
+				t.Fatalf("unexpected violations %s", encoded)
+			}
+		})
+	}
+}
+
+func TestSchemaErrorMessage(t *testing.T) {
+
+	err := &SchemaError{Vertex: "order", Direction: schemaOutput, Violations: []*SchemaViolation{
+		{Expectation: "missing properties: 'id'"}, {Pointer: "/total", Expectation: "expected number"}}}
+	expected := "Schema(order), error: invalid output, at the root: missing properties: 'id'; at `/total`: expected number"
+	if err.Error() != expected {
+		t.Fatalf("expected %s, got %s", expected, err.Error())
+	}
+}
+
+func TestSchemaExecute(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		add     func(node *Node)
+		route   bool
+		data    []byte
+		result  []byte
+		err     string
+		failure bool
+	}{
+		{"valid data passed on", func(node *Node) { node.InputSchema(orderSchema) }, false,
+			[]byte(`{"id":"a","items":[]}`), []byte(`{"id":"a","items":[]}`), "", false},
+		{"invalid data fails the vertex", func(node *Node) { node.InputSchema(orderSchema) }, false,
+			[]byte(`{"items":[]}`), nil, "Schema(order), error: invalid input, at the root: missing properties: 'id'", false},
+		{"failure handled", func(node *Node) {
+			node.InputSchema(orderSchema, OnFailure(func(err error) error { return fmt.Errorf("rejected, %v", err) }))
+		}, false, []byte(`{"items":[]}`), nil, "rejected, Schema(order)", false},
+		{"failure recovered", func(node *Node) {
+			node.InputSchema(orderSchema, OnFailure(func(err error) error { return nil }))
+		}, false, []byte(`{"items":[]}`), []byte(`{"items":[]}`), "", false},
+		{"failure routed", func(node *Node) { node.OutputSchema(orderSchema) }, true,
+			[]byte(`{"items":[]}`), nil, "", true},
+		{"skip passed through", func(node *Node) { node.InputSchema(orderSchema) }, false,
+			skippedPayload, skippedPayload, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dag := NewDag()
+			operation := schemaOperation(dag, test.add)
+			if test.route {
+				dag.Node("failed")
+				dag.ErrorEdge("order", "failed")
+			}
+			result, err := operation.Execute(test.data, map[string]interface{}{"request-id": "r"})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if test.failure {
+				envelope := &ErrorEnvelope{}
+				if !isFailure(result) || json.Unmarshal(decodeFailure(result), envelope) != nil {
+					t.Fatalf("expected a failure, got %s", result)
+				}
+				if envelope.Type != "schema-error" || envelope.Vertex != "order" || envelope.Operation != "output-schema-order" {
+					t.Fatalf("unexpected envelope %+v", envelope)
+				}
+				return
+			}
+			if string(result) != string(test.result) {
+				t.Fatalf("expected %s, got %s", test.result, result)
+			}
+		})
+	}
+}
+
+func TestSchemaDefinition(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		define func(node *Node)
+		err    string
+	}{
+		{"invalid schema", func(node *Node) { node.InputSchema(`{"type": 1}`) },
+			"Error at Schema for order, invalid input schema"},
+		{"invalid JSON", func(node *Node) { node.OutputSchema(`{`) },
+			"Error at Schema for order, invalid output schema"},
+		{"input schema after an operation", func(node *Node) { node.Apply("f").InputSchema(orderSchema) },
+			"Error at InputSchema for order, the input schema must be declared before the operations"},
+		{"operation after the output schema", func(node *Node) { node.OutputSchema(orderSchema).Apply("f") },
+			"Error at order, the output schema must be declared after the operations"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), test.err) {
+					t.Fatalf("expected panic %q, got %v", test.err, r)
+				}
+			}()
+			test.define(NewDag().Node("order"))
+		})
+	}
+}
+
+func TestSchemaExported(t *testing.T) {
+
+	dag := NewDag()
+	dag.Node("order").InputSchema(orderSchema).Apply("f").OutputSchema(`{"type":"object"}`)
+	operations := dag.udag.GetNode("order").Operations()
+	input := operations[0].GetProperties()
+	output := operations[2].GetProperties()
+	if input["isSchema"][0] != "true" || input["inputSchema"][0] != orderSchema {
+		t.Fatalf("expected the input schema exported, got %v", input)
+	}
+	if output["outputSchema"][0] != `{"type":"object"}` || string(operations[2].Encode()) != `{"type":"object"}` {
+		t.Fatalf("expected the output schema exported, got %v", output)
+	}
+}
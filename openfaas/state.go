@@ -0,0 +1,57 @@
+package openfaas
+
+import (
+	"fmt"
+	"strconv"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+// stateUpdateRetries the attempts to update a value of the StateStore updated concurrently
+const stateUpdateRetries = 10
+
+// incrementCounter adds incrementBy to the counter at key, creating the counter if missing,
+// and returns its new value. The updates are compare and updates of the StateStore, so
+// that the replicas sharing the store don't lose increments, as the counters of the executor
+func incrementCounter(store StateStore, key string, incrementBy int) (int, error) {
+
+	fmt.Println("lib/openfaas/state.go::incrementCounter start")
+	var serr error
+	for i := 0; i < stateUpdateRetries; i++ {
+		encoded, err := store.Get(key)
+		if err != nil || encoded == "" {
+			// if doesn't exist try to create
+			err = store.Set(key, strconv.Itoa(incrementBy))
+			if err != nil {
+				serr = err
+				continue
+			}
+			return incrementBy, nil
+		}
+		current, err := strconv.Atoi(encoded)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update counter %s, %v", key, err)
+		}
+		count := current + incrementBy
+		err = store.Update(key, encoded, strconv.Itoa(count))
+		if err == nil {
+			fmt.Println("lib/openfaas/state.go::incrementCounter end")
+			return count, nil
+		}
+		serr = err
+	}
+	return 0, fmt.Errorf("failed to update counter %s after %d attempts, %v", key, stateUpdateRetries, serr)
+}
+
+// executionPath returns the path of a vertex in the current execution of the workflow, it
+// includes the foreach keys of the sub-dags the vertex belongs to, so that the items of a
+// ForEachBranch have their own path. It is the vertex path outside of an execution
+func executionPath(node *sdk.Node, scope *dagScope) string {
+
+	if scope != nil {
+		if flow := scope.workflow(); flow != nil && flow.pipeline != nil && flow.pipeline.ExecutionDepth > 0 {
+			return flow.pipeline.GetNodeExecutionUniqueId(node)
+		}
+	}
+	return vertexPath(node)
+}
@@ -0,0 +1,110 @@
+package openfaas
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+// memoryStore in memory StateStore, a missing key fails as in the stores of the executor
+type memoryStore struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func newMemoryStore() *memoryStore {
+
+	return &memoryStore{values: make(map[string]string)}
+}
+
+func (store *memoryStore) Configure(flowName string, requestId string) {}
+
+func (store *memoryStore) Init() error { return nil }
+
+func (store *memoryStore) Cleanup() error { return nil }
+
+func (store *memoryStore) Set(key string, value string) error {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.values[key] = value
+	return nil
+}
+
+func (store *memoryStore) Get(key string) (string, error) {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	value, ok := store.values[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found", key)
+	}
+	return value, nil
+}
+
+func (store *memoryStore) Update(key string, oldValue string, newValue string) error {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.values[key] != oldValue {
+		return fmt.Errorf("key %s was updated", key)
+	}
+	store.values[key] = newValue
+	return nil
+}
+
+func TestIncrementCounter(t *testing.T) {
+
+	store := newMemoryStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := incrementCounter(store, "counter", 2); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	count, err := incrementCounter(store, "counter", 1)
+	// the creation of the counter may race with another creation, as in the executor
+	if err != nil || count < 3 || count > 11 || count%2 != 1 {
+		t.Fatalf("unexpected count %d, %v", count, err)
+	}
+
+	store.Set("invalid", "not a number")
+	if _, err := incrementCounter(store, "invalid", 1); err == nil {
+		t.Fatalf("expected an invalid counter to fail")
+	}
+}
+
+// enterForEach positions the execution of pipeline in the item of a foreach vertex
+func enterForEach(pipeline *sdk.Pipeline, foreach string, item string, vertex string) {
+
+	pipeline.ExecutionDepth = 1
+	pipeline.ExecutionPosition = map[string]string{"0": foreach, "1": vertex}
+	pipeline.CurrentDynamicOption = map[string]string{pipeline.Dag.GetNode(foreach).GetUniqueId(): item}
+}
+
+func TestExecutionPath(t *testing.T) {
+
+	pipeline := sdk.CreatePipeline()
+	flow := GetWorkflow(pipeline)
+	items := flow.Dag().ForEachBranch("items", func(data []byte) map[string][]byte { return nil },
+		Aggregator(func(map[string][]byte) ([]byte, error) { return nil, nil }))
+	node := items.Node("step")
+
+	if path := executionPath(node.unode, node.scope); path != "items.step" {
+		t.Fatalf("expected the vertex path outside of an execution, got %s", path)
+	}
+	enterForEach(pipeline, "items", "a", "step")
+	a := executionPath(node.unode, node.scope)
+	enterForEach(pipeline, "items", "b", "step")
+	b := executionPath(node.unode, node.scope)
+	if a == b {
+		t.Fatalf("expected a path per item, got %s for both", a)
+	}
+}
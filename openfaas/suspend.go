@@ -0,0 +1,479 @@
+package openfaas
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+	"github.com/Abhishekghosh1998/faasflow-sdk/executor"
+)
+
+const (
+	// suspendTimer the kind of a branch suspended by a Sleep
+	suspendTimer = "timer"
+	// suspendEvent the kind of a branch suspended by a WaitForEvent
+	suspendEvent = "event"
+
+	// suspendPending the status of a suspended branch waiting to resume
+	suspendPending = "pending"
+	// suspendWoken the status of a suspended branch woken by the Scheduler
+	suspendWoken = "woken"
+	// suspendDelivered the status of a suspended branch resumed by an event
+	suspendDelivered = "delivered"
+)
+
+var (
+	// suspender is the process wide Suspender of the suspended branches
+	suspender = NewSuspender(nil, nil)
+	// resumeRuntime forwards the state of the resumed branches, set by SuspendingExecutor
+	resumeRuntime func(state *executor.PartialState) error
+	// suspenderLock guards the suspender and the resumeRuntime
+	suspenderLock sync.RWMutex
+)
+
+// SuspendStore persists the suspended branches, it must be shared by the replicas
+// of the flow so that any replica resumes a branch, such as a StateStore
+type SuspendStore interface {
+	// Set sets the value of key
+	Set(key string, value string) error
+	// Get returns the value of key, it fails if key is missing
+	Get(key string) (string, error)
+	// Update replaces the value of key if it is still oldValue
+	Update(key string, oldValue string, newValue string) error
+}
+
+// Scheduler wakes the suspended branches, it calls Wake with the token of the
+// branch once the time has come. It allows plugging a durable scheduler (such as a
+// delayed queue) in place of the default in process one, whose wake-ups are lost
+// when the replica stops
+type Scheduler interface {
+	// Schedule wakes the branch suspended as token at the given time
+	Schedule(at time.Time, token string) error
+}
+
+// Suspender keeps the state of the branches suspended by Sleep, SleepUntil and WaitForEvent in its
+// SuspendStore. A suspended vertex ends the invocation, the executor wrapped by
+// SuspendingExecutor hands the state of its next vertices to the Suspender, which
+// forwards them once the branch resumes
+type Suspender struct {
+	store     SuspendStore
+	scheduler Scheduler
+	shared    bool // the store is shared by the replicas
+
+	mu      sync.Mutex
+	pending map[string]string // the tokens of the vertices suspended by the invocation, by next vertex
+}
+
+// suspension the persisted state of a suspended branch
+type suspension struct {
+	Kind   string            `json:"kind"`             // The operation suspending the branch
+	Status string            `json:"status"`           // The status of the branch
+	Vertex string            `json:"vertex"`           // The suspended vertex
+	At     time.Time         `json:"at"`               // The time the Scheduler wakes the branch at
+	Input  []byte            `json:"input,omitempty"`  // The input of the suspended vertex
+	Event  *Event            `json:"event,omitempty"`  // The event resuming the branch
+	States map[string][]byte `json:"states,omitempty"` // The encoded states of the next vertices, by resumeKey
+}
+
+// suspendingExecutor an executor handing the states of the suspended branches to the Suspender
+type suspendingExecutor struct {
+	executor.Executor
+}
+
+// localScheduler in process Scheduler waiting on the process wide Clock
+type localScheduler struct {
+	suspender *Suspender
+}
+
+// memorySuspendStore in process SuspendStore
+type memorySuspendStore struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// NewSuspender creates a Suspender keeping the suspended branches in store and waking
+// them with scheduler. A nil store keeps them in memory, a nil scheduler wakes them
+// from the process, both only resume the branches suspended by the replica. Sleep and
+// SleepUntil require a store, such as the StateStore of the flow
+func NewSuspender(store SuspendStore, scheduler Scheduler) *Suspender {
+
+	fmt.Println("lib/openfaas/suspend.go::NewSuspender start")
+	s := &Suspender{store: store, scheduler: scheduler, shared: store != nil, pending: make(map[string]string)}
+	if s.store == nil {
+		s.store = &memorySuspendStore{values: make(map[string]string)}
+	}
+	if s.scheduler == nil {
+		s.scheduler = &localScheduler{suspender: s}
+	}
+	fmt.Println("lib/openfaas/suspend.go::NewSuspender end")
+	return s
+}
+
+// SetSuspender overrides the process wide Suspender
+func SetSuspender(s *Suspender) {
+
+	fmt.Println("lib/openfaas/suspend.go::SetSuspender start")
+	suspenderLock.Lock()
+	defer suspenderLock.Unlock()
+	if s == nil {
+		s = NewSuspender(nil, nil)
+	}
+	suspender = s
+	fmt.Println("lib/openfaas/suspend.go::SetSuspender end")
+}
+
+// checkShared checks that the process wide Suspender keeps the branches suspended by
+// op at vertex in a shared SuspendStore, the branches kept in memory are lost when
+// the replica stops
+func checkShared(op string, vertex string) {
+
+	if !getSuspender().shared {
+		panic(fmt.Sprintf("Error at %s for %s, the suspended branches would be kept in memory, "+
+			"set a Suspender with a shared SuspendStore such as the StateStore of the flow with SetSuspender "+
+			"before defining the flow", op, vertex))
+	}
+}
+
+// getSuspender returns the process wide Suspender
+func getSuspender() *Suspender {
+
+	suspenderLock.RLock()
+	defer suspenderLock.RUnlock()
+	return suspender
+}
+
+// SuspendingExecutor wraps the executor of the flow so that the suspended branches end
+// the invocation, the states of their next vertices are kept by the process wide
+// Suspender and forwarded with the HandleNextNode of exec once the branch resumes
+func SuspendingExecutor(exec executor.Executor) executor.Executor {
+
+	fmt.Println("lib/openfaas/suspend.go::SuspendingExecutor start")
+	suspenderLock.Lock()
+	defer suspenderLock.Unlock()
+	resumeRuntime = exec.HandleNextNode
+	fmt.Println("lib/openfaas/suspend.go::SuspendingExecutor end")
+	return &suspendingExecutor{Executor: exec}
+}
+
+// getResumeRuntime returns the runtime forwarding the resumed branches, nil without SuspendingExecutor
+func getResumeRuntime() func(state *executor.PartialState) error {
+
+	suspenderLock.RLock()
+	defer suspenderLock.RUnlock()
+	return resumeRuntime
+}
+
+func (exec *suspendingExecutor) HandleNextNode(state *executor.PartialState) error {
+
+	return getSuspender().handleNextNode(state, exec.Executor.HandleNextNode)
+}
+
+// Wake wakes the branch suspended as token, it is called by the Scheduler.
+// A branch that isn't suspended anymore is left as is
+func Wake(token string) error {
+
+	return getSuspender().Wake(token)
+}
+
+// Wake wakes the branch suspended as token, it is called by the Scheduler.
+// A branch that isn't suspended anymore is left as is
+func (s *Suspender) Wake(token string) error {
+
+	fmt.Println("lib/openfaas/suspend.go::Wake start")
+	woken := false
+	record, err := s.update(token, func(record *suspension) error {
+		woken = record.Status == suspendPending
+		if woken {
+			record.Status = suspendWoken
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !woken {
+		return nil
+	}
+	fmt.Println("lib/openfaas/suspend.go::Wake end")
+	return s.release(token, record)
+}
+
+// deliver resumes the branch waiting on token with event
+func (s *Suspender) deliver(token string, event *Event) error {
+
+	fmt.Println("lib/openfaas/suspend.go::deliver start")
+	record, _, err := s.load(token)
+	if err != nil {
+		return err
+	}
+	if record == nil || record.Kind != suspendEvent {
+		return fmt.Errorf("%w %s", ERR_EVENT_UNKNOWN, token)
+	}
+	record, err = s.update(token, func(record *suspension) error {
+		if record.Status != suspendPending {
+			return ERR_EVENT_DELIVERED
+		}
+		record.Status = suspendDelivered
+		record.Event = event
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("lib/openfaas/suspend.go::deliver end")
+	return s.release(token, record)
+}
+
+// resumeKey identifies the forward of an execution to a next vertex, the forwards
+// of the items of a foreach vertex to the vertex have their own key
+func resumeKey(reqId string, depth int, options map[string]string, vertex string) string {
+
+	keys := make([]string, 0, len(options))
+	for key, option := range options {
+		keys = append(keys, key+"="+option)
+	}
+	sort.Strings(keys)
+	return fmt.Sprintf("%s|%d|%s|%s", reqId, depth, strings.Join(keys, ","), vertex)
+}
+
+// checkSuspend checks that the vertex can be suspended by the operation at index:
+// the operations after it would run before the branch resumes, and a join after it
+// may be triggered by another branch, which doesn't go through the Suspender
+func checkSuspend(node *sdk.Node, index int) error {
+
+	if getResumeRuntime() == nil {
+		return fmt.Errorf("no runtime resumes the suspended branches, wrap the executor with SuspendingExecutor")
+	}
+	if index != len(node.Operations())-1 {
+		return fmt.Errorf("it must be the last operation of the vertex")
+	}
+	if len(node.Children()) == 0 {
+		return fmt.Errorf("the vertex has no next vertex to resume")
+	}
+	for _, child := range node.Children() {
+		if child.Indegree() > 1 {
+			return fmt.Errorf("the next vertex %s is a join, add a vertex in between", child.Id)
+		}
+	}
+	return nil
+}
+
+// load returns the suspended branch of token, nil if it is unknown
+func (s *Suspender) load(token string) (*suspension, string, error) {
+
+	encoded, err := s.store.Get("suspend-" + token)
+	if err != nil || encoded == "" {
+		// a missing key fails in the stores of the executor
+		return nil, "", nil
+	}
+	record := &suspension{}
+	err = json.Unmarshal([]byte(encoded), record)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid suspended branch %s, %v", token, err)
+	}
+	return record, encoded, nil
+}
+
+// persist stores the suspended branch of token
+func (s *Suspender) persist(token string, record *suspension) error {
+
+	encoded, _ := json.Marshal(record)
+	err := s.store.Set("suspend-"+token, string(encoded))
+	if err != nil {
+		return fmt.Errorf("failed to persist suspended branch %s, %v", token, err)
+	}
+	return nil
+}
+
+// update applies apply to the suspended branch of token, the updates are compare
+// and updates so that the replicas resuming the branch at once don't both resume it
+func (s *Suspender) update(token string, apply func(record *suspension) error) (*suspension, error) {
+
+	var serr error
+	for i := 0; i < stateUpdateRetries; i++ {
+		record, old, err := s.load(token)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			return nil, fmt.Errorf("no branch suspended as %s", token)
+		}
+		err = apply(record)
+		if err != nil {
+			return nil, err
+		}
+		encoded, _ := json.Marshal(record)
+		err = s.store.Update("suspend-"+token, old, string(encoded))
+		if err == nil {
+			return record, nil
+		}
+		serr = err
+	}
+	return nil, fmt.Errorf("failed to update suspended branch %s after %d attempts, %v", token, stateUpdateRetries, serr)
+}
+
+// suspend records that the forwards of the execution of node to its next vertices
+// resume the branch suspended as token
+func (s *Suspender) suspend(reqId string, token string, node *sdk.Node, pipeline *sdk.Pipeline) {
+
+	fmt.Println("lib/openfaas/suspend.go::suspend start")
+	depth := 0
+	var options map[string]string
+	if pipeline != nil {
+		depth = pipeline.ExecutionDepth
+		options = pipeline.CurrentDynamicOption
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, child := range node.Children() {
+		s.pending[resumeKey(reqId, depth, options, child.Id)] = token
+	}
+	fmt.Println("lib/openfaas/suspend.go::suspend end")
+}
+
+// handleNextNode keeps the state of a next vertex of a suspended vertex until the
+// branch resumes, other states are forwarded by forward
+func (s *Suspender) handleNextNode(state *executor.PartialState, forward func(*executor.PartialState) error) error {
+
+	fmt.Println("lib/openfaas/suspend.go::handleNextNode start")
+	encoded, err := state.Encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode state, %v", err)
+	}
+	key, err := stateResumeKey(encoded)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	token, ok := s.pending[key]
+	delete(s.pending, key)
+	s.mu.Unlock()
+	if !ok {
+		return forward(state)
+	}
+
+	record, err := s.update(token, func(record *suspension) error {
+		if record.States == nil {
+			record.States = make(map[string][]byte)
+		}
+		// a vertex executed again replaces the state of its previous execution
+		record.States[key] = encoded
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if record.Status != suspendPending {
+		// the branch resumed before its state was kept
+		return forward(state)
+	}
+	// a branch woken twice only resumes once, the wake-up of a vertex executed
+	// again is scheduled again in case the replica which scheduled it stopped
+	if !record.At.IsZero() {
+		err = s.scheduler.Schedule(record.At, token)
+		if err != nil {
+			return fmt.Errorf("failed to schedule branch %s, %v", token, err)
+		}
+	}
+	fmt.Printf("[Request `%s`] Vertex `%s` suspended as `%s`\n", strings.SplitN(key, "|", 2)[0], record.Vertex, token)
+	fmt.Println("lib/openfaas/suspend.go::handleNextNode end")
+	return nil
+}
+
+// release forwards the kept states of the resumed branch of token
+func (s *Suspender) release(token string, record *suspension) error {
+
+	fmt.Println("lib/openfaas/suspend.go::release start")
+	forward := getResumeRuntime()
+	if forward == nil {
+		return fmt.Errorf("no runtime resumes branch %s, wrap the executor with SuspendingExecutor", token)
+	}
+	keys := make([]string, 0, len(record.States))
+	for key := range record.States {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		state, err := executor.DecodePartialReq(record.States[key])
+		if err != nil {
+			return fmt.Errorf("invalid state of branch %s, %v", token, err)
+		}
+		err = forward(state)
+		if err != nil {
+			return fmt.Errorf("failed to resume branch %s, %v", token, err)
+		}
+	}
+	fmt.Println("lib/openfaas/suspend.go::release end")
+	return nil
+}
+
+// stateResumeKey returns the resumeKey of the forward of an encoded state
+func stateResumeKey(encoded []byte) (string, error) {
+
+	request := struct {
+		ID             string
+		ExecutionState string
+	}{}
+	err := json.Unmarshal(encoded, &request)
+	if err != nil {
+		return "", fmt.Errorf("invalid state, %v", err)
+	}
+	pipeline := &sdk.Pipeline{}
+	err = json.Unmarshal([]byte(request.ExecutionState), pipeline)
+	if err != nil {
+		return "", fmt.Errorf("invalid execution state, %v", err)
+	}
+	vertex := pipeline.ExecutionPosition[strconv.Itoa(pipeline.ExecutionDepth)]
+	return resumeKey(request.ID, pipeline.ExecutionDepth, pipeline.CurrentDynamicOption, vertex), nil
+}
+
+func (scheduler *localScheduler) Schedule(at time.Time, token string) error {
+
+	fmt.Println("lib/openfaas/suspend.go::localScheduler::Schedule start")
+	c := getClock()
+	wake := c.After(at.Sub(c.Now()))
+	go func() {
+		<-wake
+		err := scheduler.suspender.Wake(token)
+		if err != nil {
+			fmt.Printf("Failed to wake branch `%s`, %v\n", token, err)
+		}
+	}()
+	fmt.Println("lib/openfaas/suspend.go::localScheduler::Schedule end")
+	return nil
+}
+
+func (store *memorySuspendStore) Set(key string, value string) error {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.values[key] = value
+	return nil
+}
+
+func (store *memorySuspendStore) Get(key string) (string, error) {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	value, ok := store.values[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found", key)
+	}
+	return value, nil
+}
+
+func (store *memorySuspendStore) Update(key string, oldValue string, newValue string) error {
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.values[key] != oldValue {
+		return fmt.Errorf("key %s was updated", key)
+	}
+	store.values[key] = newValue
+	return nil
+}
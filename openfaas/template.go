@@ -0,0 +1,357 @@
+package openfaas
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+const (
+	// templateUrl a template of the url of a http call
+	templateUrl = "url"
+	// templateHeader a template of a header value
+	templateHeader = "header"
+	// templateQuery a template of a query parameter value
+	templateQuery = "query"
+)
+
+// templateFuncs the escaping functions appended to the actions of the templates,
+// they can also be called explicitly
+var templateFuncs = template.FuncMap{
+	"pathEscape":  func(value interface{}) string { return url.PathEscape(fmt.Sprint(value)) },
+	"queryEscape": func(value interface{}) string { return url.QueryEscape(fmt.Sprint(value)) },
+	"headerValue": headerValue,
+}
+
+// templateEscapers the functions escaping the output of an action for the url path or the
+// query, including urlquery of text/template. An action ending with one of them isn't escaped
+// again, such as {{.payload.q | urlquery}}. The html and js built-ins leave '/', '?' and '#'
+// as they are, the output of an action ending with them is still escaped
+var templateEscapers = map[string]bool{
+	"pathEscape":  true,
+	"queryEscape": true,
+	"urlquery":    true,
+}
+
+// headerValue rejects the values that would split a header
+func headerValue(value interface{}) (string, error) {
+
+	text := fmt.Sprint(value)
+	if strings.ContainsAny(text, "\r\n") {
+		return "", fmt.Errorf("header value contains a line break")
+	}
+	return text, nil
+}
+
+// requestTemplate a template of the url, a header or a query value of a call, such as
+// `https://api/x/{{.payload.id}}`. It is resolved per request from the JSON payload
+// under .payload and the values of the template context under .ctx
+type requestTemplate struct {
+	kind    string
+	source  string
+	tmpl    *template.Template
+	ctxKeys []string // the context values the template reads
+}
+
+// isTemplate checks if a value is a template
+func isTemplate(value string) bool {
+
+	return strings.Contains(value, "{{")
+}
+
+// compileRequestTemplate compiles a template and makes every action escape its output for kind
+func compileRequestTemplate(kind string, source string) (*requestTemplate, error) {
+
+	fmt.Println("lib/openfaas/template.go::compileRequestTemplate start")
+	tmpl, err := template.New(kind).Funcs(templateFuncs).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template `%s`, %v", kind, source, err)
+	}
+	if len(tmpl.Templates()) > 1 {
+		return nil, fmt.Errorf("invalid %s template `%s`, nested templates are not supported", kind, source)
+	}
+	compiled := &requestTemplate{kind: kind, source: source, tmpl: tmpl}
+	escaper := "queryEscape"
+	switch kind {
+	case templateUrl:
+		escaper = "pathEscape"
+	case templateHeader:
+		escaper = "headerValue"
+	}
+	keys := make(map[string]bool)
+	err = compiled.walk(tmpl.Tree, tmpl.Tree.Root, &escaper, true, keys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template `%s`, %v", kind, source, err)
+	}
+	for key := range keys {
+		compiled.ctxKeys = append(compiled.ctxKeys, key)
+	}
+	sort.Strings(compiled.ctxKeys)
+	fmt.Println("lib/openfaas/template.go::compileRequestTemplate end")
+	return compiled, nil
+}
+
+// walk checks the fields of node and appends the escaper to its actions. The url
+// escaper switches from the path to the query once a `?` was written. Outside of
+// range and with, the dot is the root and fields start with .payload or .ctx
+func (t *requestTemplate) walk(tree *parse.Tree, node parse.Node, escaper *string, root bool, keys map[string]bool) error {
+
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return nil
+		}
+		for _, child := range node.Nodes {
+			err := t.walk(tree, child, escaper, root, keys)
+			if err != nil {
+				return err
+			}
+		}
+	case *parse.TextNode:
+		if t.kind == templateUrl && bytes.IndexByte(node.Text, '?') >= 0 {
+			*escaper = "queryEscape"
+		}
+	case *parse.ActionNode:
+		err := checkPipe(node.Pipe, root, keys)
+		if err != nil {
+			return err
+		}
+		if len(node.Pipe.Decl) == 0 {
+			appendEscaper(tree, node, *escaper)
+		}
+	case *parse.IfNode:
+		return t.walkBranch(tree, &node.BranchNode, escaper, root, root, keys)
+	case *parse.RangeNode:
+		return t.walkBranch(tree, &node.BranchNode, escaper, root, false, keys)
+	case *parse.WithNode:
+		return t.walkBranch(tree, &node.BranchNode, escaper, root, false, keys)
+	case *parse.TemplateNode:
+		return fmt.Errorf("nested templates are not supported")
+	}
+	return nil
+}
+
+// walkBranch walks an if, range or with, the branch body sees the dot as bodyRoot
+func (t *requestTemplate) walkBranch(tree *parse.Tree, node *parse.BranchNode, escaper *string, root bool,
+	bodyRoot bool, keys map[string]bool) error {
+
+	err := checkPipe(node.Pipe, root, keys)
+	if err != nil {
+		return err
+	}
+	err = t.walk(tree, node.List, escaper, bodyRoot, keys)
+	if err != nil {
+		return err
+	}
+	return t.walk(tree, node.ElseList, escaper, root, keys)
+}
+
+// checkPipe checks the fields of a pipeline and records the context keys it reads
+func checkPipe(pipe *parse.PipeNode, root bool, keys map[string]bool) error {
+
+	if pipe == nil {
+		return nil
+	}
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			err := checkArg(arg, root, keys)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkArg checks a field, a variable or a nested pipeline of a command
+func checkArg(arg parse.Node, root bool, keys map[string]bool) error {
+
+	switch arg := arg.(type) {
+	case *parse.FieldNode:
+		if root {
+			return checkField(arg.Ident, keys)
+		}
+	case *parse.VariableNode:
+		if arg.Ident[0] == "$" && len(arg.Ident) > 1 {
+			return checkField(arg.Ident[1:], keys)
+		}
+	case *parse.ChainNode:
+		return checkArg(arg.Node, root, keys)
+	case *parse.PipeNode:
+		return checkPipe(arg, root, keys)
+	}
+	return nil
+}
+
+// checkField checks a field of the root starts with .payload or .ctx.<key>
+func checkField(ident []string, keys map[string]bool) error {
+
+	switch ident[0] {
+	case "payload":
+		return nil
+	case "ctx":
+		if len(ident) < 2 {
+			return fmt.Errorf("expected a context value such as .ctx.<key>, found .ctx")
+		}
+		keys[ident[1]] = true
+		return nil
+	}
+	return fmt.Errorf("unknown field .%s, expected .payload or .ctx", strings.Join(ident, "."))
+}
+
+// appendEscaper pipes the output of an action to escaper, unless it already ends with it or,
+// for the url and the query, with another escaper. The header values are always checked, not
+// every escaper removes the line breaks
+func appendEscaper(tree *parse.Tree, action *parse.ActionNode, escaper string) {
+
+	cmds := action.Pipe.Cmds
+	if len(cmds) != 0 {
+		last := cmds[len(cmds)-1]
+		if ident, ok := last.Args[0].(*parse.IdentifierNode); ok &&
+			(ident.Ident == escaper || escaper != "headerValue" && templateEscapers[ident.Ident]) {
+			return
+		}
+	}
+	ident := parse.NewIdentifier(escaper).SetTree(tree).SetPos(action.Pos)
+	action.Pipe.Cmds = append(cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: action.Pos,
+		Args: []parse.Node{ident}})
+}
+
+// usesContext checks if the template reads the context
+func (t *requestTemplate) usesContext() bool {
+
+	return len(t.ctxKeys) != 0
+}
+
+// render resolves the template with the decoded payload and the context values
+func (t *requestTemplate) render(values map[string]interface{}) (string, error) {
+
+	var b strings.Builder
+	err := t.tmpl.Execute(&b, values)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s template `%s`, %v", t.kind, t.source, err)
+	}
+	return b.String(), nil
+}
+
+// templateKey the key of the compiled template of source
+func templateKey(kind string, source string) string {
+
+	return kind + ":" + source
+}
+
+// compileTemplates compiles the templates of the url, the headers and the query of the
+// call, it panics if a template is invalid or reads the context without TemplateContext
+func (operation *FaasOperation) compileTemplates() {
+
+	fmt.Printf("lib/openfaas/template.go::compileTemplates start")
+	compile := func(kind string, source string) {
+		if !isTemplate(source) {
+			return
+		}
+		tmpl, err := compileRequestTemplate(kind, source)
+		if err != nil {
+			panic(fmt.Sprintf("Error at %s, %v", operation.targetKey(), err))
+		}
+		if tmpl.usesContext() && operation.TemplateContext == nil {
+			panic(fmt.Sprintf("Error at %s, %s template `%s` reads the context, TemplateContext not specified",
+				operation.targetKey(), kind, source))
+		}
+		if operation.templates == nil {
+			operation.templates = make(map[string]*requestTemplate)
+		}
+		operation.templates[templateKey(kind, source)] = tmpl
+	}
+	compile(templateUrl, operation.HttpRequestUrl)
+	for _, value := range operation.Header {
+		compile(templateHeader, value)
+	}
+	for _, values := range operation.Param {
+		for _, value := range values {
+			compile(templateQuery, value)
+		}
+	}
+	fmt.Printf("lib/openfaas/template.go::compileTemplates end")
+}
+
+// templateValues returns the data of the templates, the payload decoded
+// as JSON under payload and the context values read under ctx
+func (operation *FaasOperation) templateValues(data []byte) (map[string]interface{}, error) {
+
+	var payload interface{}
+	if len(data) != 0 {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err := decoder.Decode(&payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the templates, payload is not valid JSON, %v", err)
+		}
+	}
+	ctx := make(map[string]interface{})
+	for _, tmpl := range operation.templates {
+		for _, key := range tmpl.ctxKeys {
+			if _, ok := ctx[key]; ok {
+				continue
+			}
+			value, err := (*sdk.Context)(operation.TemplateContext).Get(key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve the templates, context value `%s`, %v", key, err)
+			}
+			ctx[key] = value
+		}
+	}
+	return map[string]interface{}{"payload": payload, "ctx": ctx}, nil
+}
+
+// resolve returns the call with its templates resolved for data, the
+// operation itself if it has no template
+func (operation *FaasOperation) resolve(data []byte) (*FaasOperation, error) {
+
+	fmt.Printf("lib/openfaas/template.go::resolve start")
+	if len(operation.templates) == 0 {
+		return operation, nil
+	}
+	values, err := operation.templateValues(data)
+	if err != nil {
+		return nil, err
+	}
+	render := func(kind string, source string) (string, error) {
+		tmpl, ok := operation.templates[templateKey(kind, source)]
+		if !ok {
+			return source, nil
+		}
+		return tmpl.render(values)
+	}
+
+	resolved := *operation
+	resolved.HttpRequestUrl, err = render(templateUrl, operation.HttpRequestUrl)
+	if err != nil {
+		return nil, err
+	}
+	resolved.Header = make(map[string]string, len(operation.Header))
+	for key, value := range operation.Header {
+		resolved.Header[key], err = render(templateHeader, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	resolved.Param = make(map[string][]string, len(operation.Param))
+	for key, values := range operation.Param {
+		resolved.Param[key] = make([]string, len(values))
+		for i, value := range values {
+			resolved.Param[key][i], err = render(templateQuery, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	fmt.Printf("lib/openfaas/template.go::resolve end")
+	return &resolved, nil
+}
@@ -0,0 +1,194 @@
+package openfaas
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+// memoryDataStore an in memory DataStore of a Context
+type memoryDataStore map[string][]byte
+
+func (store memoryDataStore) Configure(flowName string, requestId string) {}
+
+func (store memoryDataStore) Init() error { return nil }
+
+func (store memoryDataStore) Set(key string, value []byte) error {
+
+	store[key] = value
+	return nil
+}
+
+func (store memoryDataStore) Get(key string) ([]byte, error) {
+
+	value, ok := store[key]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", key)
+	}
+	return value, nil
+}
+
+func (store memoryDataStore) Del(key string) error {
+
+	delete(store, key)
+	return nil
+}
+
+func (store memoryDataStore) Cleanup() error { return nil }
+
+// templateContext returns a Context holding values
+func templateContext(values map[string]interface{}) *Context {
+
+	context := sdk.CreateContext("r", "order", "flow", memoryDataStore{})
+	for key, value := range values {
+		context.Set(key, value)
+	}
+	return (*Context)(context)
+}
+
+func TestRequestTemplates(t *testing.T) {
+
+	payload := `{"id":"a/b c","q":"x&y=z","n":12345678901234567890,"tags":["t 1","t/2"],"name":"é","path":"../admin/delete?all=1&x=#"}`
+	tests := []struct {
+		name   string
+		url    string
+		opts   []Option
+		result string // the resolved url
+		header map[string]string
+		query  map[string]string
+	}{
+		{"path escaped", "https://api/x/{{.payload.id}}", nil, "https://api/x/a%2Fb%20c", nil, nil},
+		{"query in the url escaped", "https://api/x?q={{.payload.q}}&id={{.payload.id}}", nil,
+			"https://api/x?q=x%26y%3Dz&id=a%2Fb+c", nil, nil},
+		{"numbers kept", "https://api/x/{{.payload.n}}", nil, "https://api/x/12345678901234567890", nil, nil},
+		{"range", "https://api/x/{{range .payload.tags}}{{.}};{{end}}", nil, "https://api/x/t%201;t%2F2;", nil, nil},
+		{"explicit escaper", "https://api/x?q={{.payload.q | pathEscape}}", nil, "https://api/x?q=x&y=z", nil, nil},
+		{"urlquery not escaped again", "https://api/x?q={{.payload.q | urlquery}}", nil,
+			"https://api/x?q=x%26y%3Dz", nil, nil},
+		{"urlquery call not escaped again", "https://api/x?q={{urlquery .payload.id}}", nil,
+			"https://api/x?q=a%2Fb+c", nil, nil},
+		{"html escaped again", "https://api/x/{{.payload.name | html}}", nil, "https://api/x/%C3%A9", nil, nil},
+		{"js escaped again", "https://api/x/{{js .payload.id}}", nil, "https://api/x/a%2Fb%20c", nil, nil},
+		{"path injection after html", "https://api/x/{{.payload.path | html}}", nil,
+			"https://api/x/..%2Fadmin%2Fdelete%3Fall=1&amp%3Bx=%23", nil, nil},
+		{"query injection after js", "https://api/x?q={{.payload.path | js}}", nil,
+			"https://api/x?q=..%2Fadmin%2Fdelete%3Fall%5Cu003D1%5Cu0026x%5Cu003D%23", nil, nil},
+		{"header", "https://api/x", []Option{Header("X-Id", "id {{.payload.id}}"), Header("X-Tenant", "{{.ctx.tenant}}"),
+			TemplateContext(templateContext(map[string]interface{}{"tenant": "acme"}))},
+			"https://api/x", map[string]string{"x-id": "id a/b c", "x-tenant": "acme"}, nil},
+		{"header escaped by an escaper", "https://api/x", []Option{Header("X-Q", "{{.payload.q | urlquery}}")},
+			"https://api/x", map[string]string{"x-q": "x%26y%3Dz"}, nil},
+		{"query", "https://api/x", []Option{Query("q", "{{.payload.q}}"), Query("id", "{{.payload.id}}")},
+			"https://api/x", nil, map[string]string{"q": "x%26y%3Dz", "id": "a%2Fb+c"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			operation := createHttpRequest(test.url)
+			operation.applyOptions(test.opts)
+			resolved, err := operation.resolve([]byte(payload))
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if resolved.HttpRequestUrl != test.result {
+				t.Fatalf("expected %s, got %s", test.result, resolved.HttpRequestUrl)
+			}
+			for key, value := range test.header {
+				if resolved.Header[key] != value {
+					t.Fatalf("expected header %s %q, got %q", key, value, resolved.Header[key])
+				}
+			}
+			for key, value := range test.query {
+				if resolved.Param[key][0] != value {
+					t.Fatalf("expected query %s %q, got %q", key, value, resolved.Param[key][0])
+				}
+			}
+			// the templates of the operation are kept for the next request
+			if operation.HttpRequestUrl != test.url {
+				t.Fatalf("expected the template kept, got %s", operation.HttpRequestUrl)
+			}
+		})
+	}
+}
+
+func TestRequestTemplateErrors(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		payload string
+		err     string
+	}{
+		{"line break in a header", []Option{Header("X-Id", "{{.payload.id}}")}, `{"id":"a\r\nX-Admin: 1"}`,
+			"header value contains a line break"},
+		{"line break escaped by html in a header", []Option{Header("X-Id", "{{.payload.id | html}}")},
+			`{"id":"a\nb"}`, "header value contains a line break"},
+		{"missing field", []Option{Header("X-Id", "{{.payload.id}}")}, `{}`, "failed to resolve header template"},
+		{"invalid payload", []Option{Header("X-Id", "{{.payload.id}}")}, `{"id":`, "payload is not valid JSON"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			operation := createHttpRequest("https://api/x")
+			operation.applyOptions(test.opts)
+			_, err := operation.resolve([]byte(test.payload))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestRequestTemplateCompilation(t *testing.T) {
+
+	tests := []struct {
+		name string
+		url  string
+		opts []Option
+		err  string
+	}{
+		{"syntax error", "https://api/x/{{.payload.id", nil, "invalid url template"},
+		{"unknown field", "https://api/x/{{.id}}", nil, "unknown field .id, expected .payload or .ctx"},
+		{"unknown variable field", "https://api/x/{{$.body}}", nil, "unknown field .body"},
+		{"context without key", "https://api/x/{{.ctx}}", []Option{TemplateContext(templateContext(nil))},
+			"expected a context value such as .ctx.<key>"},
+		{"context without TemplateContext", "https://api/x", []Option{Header("X-Tenant", "{{.ctx.tenant}}")},
+			"header template `{{.ctx.tenant}}` reads the context, TemplateContext not specified"},
+		{"nested template", `https://api/x/{{define "t"}}x{{end}}`, nil, "nested templates are not supported"},
+		{"unknown function", "https://api/x", []Option{Query("q", "{{nope .payload.q}}")},
+			"invalid query template"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), test.err) {
+					t.Fatalf("expected panic %q, got %v", test.err, r)
+				}
+			}()
+			NewDag().Node("order").Request(test.url, test.opts...)
+		})
+	}
+}
+
+func TestRequestTemplateCall(t *testing.T) {
+
+	var path, query, tenant string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query, tenant = r.URL.EscapedPath(), r.URL.RawQuery, r.Header.Get("X-Tenant")
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	operation := createHttpRequest(server.URL + "/orders/{{.payload.id}}")
+	operation.applyOptions([]Option{Query("q", "{{.payload.q}}"), Header("X-Tenant", "{{.ctx.tenant}}"),
+		TemplateContext(templateContext(map[string]interface{}{"tenant": "acme"}))})
+	result, err := operation.invoke("r", "", []byte(`{"id":"a/b","q":"x&y"}`))
+	if err != nil || string(result) != "ok" {
+		t.Fatalf("unexpected result %s, %v", result, err)
+	}
+	if path != "/orders/a%2Fb" || query != "q=x%26y" || tenant != "acme" {
+		t.Fatalf("unexpected call of %s?%s for %s", path, query, tenant)
+	}
+}
@@ -0,0 +1,327 @@
+package openfaas
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/jsonutil"
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+)
+
+var (
+	// clock is the process wide clock the timers wait on
+	clock Clock = realClock{}
+	// clockLock guards the clock
+	clockLock sync.RWMutex
+)
+
+// Clock the time source of the timers, it allows plugging an
+// in memory clock such as ManualClock so that tests run instantly
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// After returns a channel receiving the time once d has elapsed
+	After(d time.Duration) <-chan time.Time
+}
+
+// ManualClock in memory Clock which only moves when advanced
+type ManualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*clockWaiter
+}
+
+// clockWaiter a wait on a ManualClock
+type clockWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// realClock the system clock
+type realClock struct{}
+
+// SleepOperation suspends a branch for a duration, or until a time read from the payload
+type SleepOperation struct {
+	Vertex      string        // The vertex the operation belongs to
+	Duration    time.Duration // The duration of the pause
+	Until       string        // The JSONPath of the wake-up time in the payload, if any
+	ErrorVertex string        // The vertex routing the failures, if any
+
+	until *jsonutil.Path // the compiled Until
+	node  *sdk.Node      // the vertex the operation belongs to
+	scope *dagScope      // the dag defining the vertex
+	index int            // the index of the operation in the vertex
+}
+
+// SetClock overrides the process wide Clock
+func SetClock(c Clock) {
+
+	fmt.Println("lib/openfaas/timer.go::SetClock start")
+	clockLock.Lock()
+	defer clockLock.Unlock()
+	if c == nil {
+		c = realClock{}
+	}
+	clock = c
+	fmt.Println("lib/openfaas/timer.go::SetClock end")
+}
+
+// getClock returns the process wide Clock
+func getClock() Clock {
+
+	clockLock.RLock()
+	defer clockLock.RUnlock()
+	return clock
+}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// NewManualClock creates a ManualClock set at now
+func NewManualClock(now time.Time) *ManualClock {
+
+	fmt.Println("lib/openfaas/timer.go::NewManualClock start")
+	fmt.Println("lib/openfaas/timer.go::NewManualClock end")
+	return &ManualClock{now: now}
+}
+
+func (c *ManualClock) Now() time.Time {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, &clockWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d, firing the waits due
+func (c *ManualClock) Advance(d time.Duration) {
+
+	fmt.Println("lib/openfaas/timer.go::ManualClock::Advance start")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	sort.Slice(c.waiters, func(i, j int) bool { return c.waiters[i].at.Before(c.waiters[j].at) })
+	pending := c.waiters[:0]
+	for _, waiter := range c.waiters {
+		if waiter.at.After(c.now) {
+			pending = append(pending, waiter)
+			continue
+		}
+		waiter.ch <- c.now
+	}
+	c.waiters = pending
+	fmt.Println("lib/openfaas/timer.go::ManualClock::Advance end")
+}
+
+// Waiters returns the waits not yet fired
+func (c *ManualClock) Waiters() int {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// Sleep adds an operation to the given vertex that suspends the branch for the duration,
+// then passes its input on. The invocation ends, the wake-up is kept by the Suspender
+// which forwards the branch to the next vertices once it is woken, the executor must
+// be wrapped with SuspendingExecutor. The timer must be the last operation of the
+// vertex and the next vertices can't be joins. The process wide Suspender must keep
+// the wake-ups in a shared SuspendStore, see SetSuspender, and the default Scheduler
+// only wakes the branches while the replica suspending them runs
+func (node *Node) Sleep(duration time.Duration) *Node {
+
+	fmt.Println("lib/openfaas/timer.go::Sleep start")
+	if duration < 0 {
+		panic(fmt.Sprintf("Error at Sleep for %s, invalid duration %v", node.unode.Id, duration))
+	}
+	checkShared("Sleep", node.unode.Id)
+	node.addTimer(&SleepOperation{Vertex: node.unode.Id, Duration: duration})
+	fmt.Println("lib/openfaas/timer.go::Sleep end")
+	return node
+}
+
+// SleepUntil adds an operation to the given vertex that suspends the branch until the time
+// at the JSONPath in its input, either an RFC 3339 string or a unix time in seconds,
+// then passes its input on as Sleep. A time in the past doesn't suspend the branch
+func (node *Node) SleepUntil(path string) *Node {
+
+	fmt.Println("lib/openfaas/timer.go::SleepUntil start")
+	until, err := jsonutil.CompilePath(path)
+	if err != nil {
+		panic(fmt.Sprintf("Error at SleepUntil for %s, %v", node.unode.Id, err))
+	}
+	checkShared("SleepUntil", node.unode.Id)
+	node.addTimer(&SleepOperation{Vertex: node.unode.Id, Until: path, until: until})
+	fmt.Println("lib/openfaas/timer.go::SleepUntil end")
+	return node
+}
+
+// addTimer adds a timer to the vertex
+func (node *Node) addTimer(operation *SleepOperation) {
+
+	operation.index = len(node.unode.Operations())
+	node.register(operation)
+	node.unode.AddOperation(operation)
+}
+
+func (operation *SleepOperation) bind(node *sdk.Node, scope *dagScope) {
+
+	operation.node = node
+	operation.scope = scope
+}
+
+func (operation *SleepOperation) routeErrors(vertex string) {
+
+	operation.ErrorVertex = vertex
+}
+
+// token returns the token the branch of a request is suspended as, the items
+// of a foreach vertex are suspended separately
+func (operation *SleepOperation) token(reqId string) string {
+
+	return fmt.Sprintf("%s.%s.%d", reqId, executionPath(operation.node, operation.scope), operation.index)
+}
+
+// wakeUp returns the time the branch wakes up at
+func (operation *SleepOperation) wakeUp(data []byte, now time.Time) (time.Time, error) {
+
+	fmt.Println("lib/openfaas/timer.go::wakeUp start")
+	if operation.until == nil {
+		return now.Add(operation.Duration), nil
+	}
+	var doc interface{}
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("payload is not valid JSON, %v", err)
+	}
+	value, ok := operation.until.Lookup(doc)
+	if !ok {
+		return time.Time{}, fmt.Errorf("no wake-up time at %s", operation.Until)
+	}
+	switch v := value.(type) {
+	case string:
+		wake, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid wake-up time at %s, %v", operation.Until, err)
+		}
+		return wake, nil
+	case float64:
+		fmt.Println("lib/openfaas/timer.go::wakeUp end")
+		return time.Unix(0, int64(v*float64(time.Second))), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid wake-up time at %s, %v", operation.Until, value)
+}
+
+func (operation *SleepOperation) GetId() string {
+
+	fmt.Println("lib/openfaas/timer.go::GetId start")
+	fmt.Println("lib/openfaas/timer.go::GetId end")
+	return "sleep-" + operation.Vertex
+}
+
+func (operation *SleepOperation) Encode() []byte {
+
+	fmt.Println("lib/openfaas/timer.go::Encode start")
+	fmt.Println("lib/openfaas/timer.go::Encode end")
+	return []byte("")
+}
+
+func (operation *SleepOperation) GetProperties() map[string][]string {
+
+	fmt.Println("lib/openfaas/timer.go::GetProperties start")
+	result := make(map[string][]string)
+	result["isMod"] = []string{"true"}
+	result["isFunction"] = []string{"false"}
+	result["isHttpRequest"] = []string{"false"}
+	result["isTimer"] = []string{"true"}
+	if operation.until != nil {
+		result["sleepUntil"] = []string{operation.Until}
+	} else {
+		result["sleepFor"] = []string{strconv.FormatInt(int64(operation.Duration/time.Millisecond), 10) + "ms"}
+	}
+	fmt.Println("lib/openfaas/timer.go::GetProperties end")
+	return result
+}
+
+func (operation *SleepOperation) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/timer.go::Execute start")
+	// a skipped path or a routed failure passes through the vertex
+	if isMarker(data) {
+		return passMarker(data, operation.ErrorVertex)
+	}
+	reqId := fmt.Sprintf("%v", option["request-id"])
+	err := operation.sleep(reqId, data)
+	if err != nil {
+		err = fmt.Errorf("Sleep(%s), error: %v", operation.Vertex, err)
+		if operation.ErrorVertex != "" {
+			fmt.Printf("[Request `%s`] Routing failure of vertex `%s` to its error edge, %v\n",
+				reqId, operation.ErrorVertex, err)
+			return encodeFailure(operation.ErrorVertex, operation.GetId(), data, err), nil
+		}
+		return nil, err
+	}
+	fmt.Println("lib/openfaas/timer.go::Execute end")
+	return data, nil
+}
+
+// sleep suspends the branch of the request until its wake-up, a timer executed
+// again keeps the wake-up it was suspended with
+func (operation *SleepOperation) sleep(reqId string, data []byte) error {
+
+	fmt.Println("lib/openfaas/timer.go::sleep start")
+	s := getSuspender()
+	token := operation.token(reqId)
+	record, _, err := s.load(token)
+	if err != nil {
+		return err
+	}
+	now := getClock().Now()
+	var wake time.Time
+	if record != nil {
+		wake = record.At
+	} else {
+		wake, err = operation.wakeUp(data, now)
+		if err != nil {
+			return err
+		}
+	}
+	if !wake.After(now) {
+		return nil
+	}
+	err = checkSuspend(operation.node, operation.index)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		err = s.persist(token, &suspension{Kind: suspendTimer, Status: suspendPending, Vertex: operation.Vertex, At: wake})
+		if err != nil {
+			return err
+		}
+	}
+	var pipeline *sdk.Pipeline
+	if flow := operation.scope.workflow(); flow != nil {
+		pipeline = flow.pipeline
+	}
+	s.suspend(reqId, token, operation.node, pipeline)
+	fmt.Printf("[Request `%s`] Vertex `%s` sleeping until %s\n", reqId, operation.Vertex, wake.Format(time.RFC3339))
+	fmt.Println("lib/openfaas/timer.go::sleep end")
+	return nil
+}
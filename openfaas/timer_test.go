@@ -0,0 +1,272 @@
+package openfaas
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+	"github.com/Abhishekghosh1998/faasflow-sdk/executor"
+)
+
+// forwardingExecutor an executor recording the states it forwards
+type forwardingExecutor struct {
+	executor.Executor
+	states chan *executor.PartialState
+}
+
+func (exec *forwardingExecutor) HandleNextNode(state *executor.PartialState) error {
+
+	exec.states <- state
+	return nil
+}
+
+// suspendTest sets a ManualClock and a Suspender in memory for the test, the
+// returned executor is wrapped with SuspendingExecutor
+func suspendTest(t *testing.T) (*ManualClock, executor.Executor, chan *executor.PartialState) {
+
+	clock := NewManualClock(time.Unix(1000, 0))
+	SetClock(clock)
+	SetSuspender(NewSuspender(newMemoryStore(), nil))
+	states := make(chan *executor.PartialState, 8)
+	exec := SuspendingExecutor(&forwardingExecutor{states: states})
+	t.Cleanup(func() {
+		SetClock(nil)
+		SetSuspender(nil)
+		suspenderLock.Lock()
+		resumeRuntime = nil
+		suspenderLock.Unlock()
+	})
+	return clock, exec, states
+}
+
+// nextState returns the state forwarding an execution of request to vertex
+func nextState(t *testing.T, reqId string, vertex string, options map[string]string) *executor.PartialState {
+
+	pipeline := &sdk.Pipeline{ExecutionPosition: map[string]string{"0": vertex}, CurrentDynamicOption: options}
+	if len(options) != 0 {
+		pipeline.ExecutionDepth = 1
+		pipeline.ExecutionPosition["1"] = vertex
+	}
+	execution, _ := json.Marshal(pipeline)
+	encoded, _ := json.Marshal(map[string]string{"ID": reqId, "ExecutionState": string(execution)})
+	state, err := executor.DecodePartialReq(encoded)
+	if err != nil {
+		t.Fatalf("invalid state, %v", err)
+	}
+	return state
+}
+
+// expectForward checks whether a state was forwarded
+func expectForward(t *testing.T, states chan *executor.PartialState, forwarded bool) {
+
+	t.Helper()
+	if !forwarded {
+		select {
+		case <-states:
+			t.Fatalf("expected the branch suspended")
+		default:
+		}
+		return
+	}
+	select {
+	case <-states:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the branch forwarded")
+	}
+}
+
+// sleepOperation returns the timer of the vertex wait, followed by the vertex next
+func sleepOperation(dag *Dag, add func(node *Node)) *SleepOperation {
+
+	add(dag.Node("wait"))
+	dag.Node("next")
+	dag.Edge("wait", "next")
+	for _, operation := range dag.udag.GetNode("wait").Operations() {
+		if timer, ok := operation.(*SleepOperation); ok {
+			return timer
+		}
+	}
+	return nil
+}
+
+func TestSleep(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		add   func(node *Node)
+		data  string
+		sleep time.Duration
+	}{
+		{"duration", func(node *Node) { node.Sleep(time.Minute) }, `{}`, time.Minute},
+		{"until a time", func(node *Node) { node.SleepUntil("$.at") },
+			`{"at":"` + time.Unix(1030, 0).UTC().Format(time.RFC3339) + `"}`, 30 * time.Second},
+		{"until a unix time", func(node *Node) { node.SleepUntil("$.at") }, `{"at":1010}`, 10 * time.Second},
+		{"until a past time", func(node *Node) { node.SleepUntil("$.at") }, `{"at":900}`, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock, exec, states := suspendTest(t)
+			operation := sleepOperation(NewDag(), test.add)
+
+			result, err := operation.Execute([]byte(test.data), map[string]interface{}{"request-id": "r"})
+			if err != nil || string(result) != test.data {
+				t.Fatalf("expected the input passed on, got %s, %v", result, err)
+			}
+			if err := exec.HandleNextNode(nextState(t, "r", "next", nil)); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if test.sleep == 0 {
+				expectForward(t, states, true)
+				return
+			}
+			expectForward(t, states, false)
+			clock.Advance(test.sleep - time.Second)
+			expectForward(t, states, false)
+			clock.Advance(time.Second)
+			expectForward(t, states, true)
+		})
+	}
+}
+
+func TestSleepForwardsOtherStates(t *testing.T) {
+
+	_, exec, states := suspendTest(t)
+	sleepOperation(NewDag(), func(node *Node) { node.Sleep(time.Minute) })
+	if err := exec.HandleNextNode(nextState(t, "r", "next", nil)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expectForward(t, states, true)
+}
+
+func TestSleepResumesDurableTimer(t *testing.T) {
+
+	clock, exec, states := suspendTest(t)
+	operation := sleepOperation(NewDag(), func(node *Node) { node.Sleep(time.Minute) })
+	operation.Execute([]byte(`{}`), map[string]interface{}{"request-id": "r"})
+	exec.HandleNextNode(nextState(t, "r", "next", nil))
+
+	// the vertex is executed again, by another replica, before the wake-up
+	clock.Advance(40 * time.Second)
+	operation = sleepOperation(NewDag(), func(node *Node) { node.Sleep(time.Minute) })
+	if _, err := operation.Execute([]byte(`{}`), map[string]interface{}{"request-id": "r"}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	exec.HandleNextNode(nextState(t, "r", "next", nil))
+	expectForward(t, states, false)
+
+	clock.Advance(20 * time.Second)
+	expectForward(t, states, true)
+	// both wake-ups were scheduled, the branch only resumes once
+	if err := Wake("r.wait.0"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	expectForward(t, states, false)
+}
+
+func TestSleepSuspendsItemsSeparately(t *testing.T) {
+
+	clock, exec, states := suspendTest(t)
+	pipeline := sdk.CreatePipeline()
+	flow := GetWorkflow(pipeline)
+	items := flow.Dag().ForEachBranch("items", func(data []byte) map[string][]byte { return nil },
+		Aggregator(func(map[string][]byte) ([]byte, error) { return nil, nil }))
+	operation := sleepOperation(items, func(node *Node) { node.Sleep(time.Minute) })
+
+	tokens := map[string]bool{}
+	for i, item := range []string{"a", "b"} {
+		enterForEach(pipeline, "items", item, "wait")
+		tokens[operation.token("r")] = true
+		// the items are executed 30 seconds apart
+		clock.Advance(time.Duration(i) * 30 * time.Second)
+		if _, err := operation.Execute([]byte(`{}`), map[string]interface{}{"request-id": "r"}); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		options := map[string]string{pipeline.Dag.GetNode("items").GetUniqueId(): item}
+		exec.HandleNextNode(nextState(t, "r", "next", options))
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("expected a token per item, got %v", tokens)
+	}
+	clock.Advance(30 * time.Second)
+	expectForward(t, states, true)
+	expectForward(t, states, false)
+	clock.Advance(30 * time.Second)
+	expectForward(t, states, true)
+}
+
+func TestSleepChecksVertex(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		define  func(dag *Dag) *SleepOperation
+		runtime bool
+		err     string
+	}{
+		{"no runtime", func(dag *Dag) *SleepOperation {
+			return sleepOperation(dag, func(node *Node) { node.Sleep(time.Minute) })
+		}, false, "wrap the executor with SuspendingExecutor"},
+		{"operation after the timer", func(dag *Dag) *SleepOperation {
+			return sleepOperation(dag, func(node *Node) { node.Sleep(time.Minute).Apply("f") })
+		}, true, "last operation of the vertex"},
+		{"no next vertex", func(dag *Dag) *SleepOperation {
+			dag.Node("wait").Sleep(time.Minute)
+			return dag.udag.GetNode("wait").Operations()[0].(*SleepOperation)
+		}, true, "no next vertex"},
+		{"join after the timer", func(dag *Dag) *SleepOperation {
+			operation := sleepOperation(dag, func(node *Node) { node.Sleep(time.Minute) })
+			dag.Node("other")
+			dag.Edge("other", "next")
+			return operation
+		}, true, "the next vertex next is a join"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			suspendTest(t)
+			if !test.runtime {
+				suspenderLock.Lock()
+				resumeRuntime = nil
+				suspenderLock.Unlock()
+			}
+			operation := test.define(NewDag())
+			_, err := operation.Execute([]byte(`{}`), map[string]interface{}{"request-id": "r"})
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestWakeUnknownBranch(t *testing.T) {
+
+	suspendTest(t)
+	if err := Wake("unknown"); err == nil {
+		t.Fatalf("expected an unknown branch to fail")
+	}
+}
+
+func TestSleepRequiresSharedStore(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		define func(node *Node)
+		err    string
+	}{
+		{"sleep", func(node *Node) { node.Sleep(time.Minute) }, "Error at Sleep for wait, the suspended branches would be kept in memory"},
+		{"sleep until", func(node *Node) { node.SleepUntil("$.at") }, "Error at SleepUntil for wait, the suspended branches would be kept in memory"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			SetSuspender(NewSuspender(nil, nil))
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), test.err) {
+					t.Fatalf("expected panic %q, got %v", test.err, r)
+				}
+			}()
+			test.define(NewDag().Node("wait"))
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package openfaas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
+	"github.com/itchyny/gojq"
+)
+
+const (
+	// defaultTransformTimeout the maximum time a Transform runs its expression by default
+	defaultTransformTimeout = 5 * time.Second
+)
+
+// TransformOperation transforms the payload with a jq expression
+type TransformOperation struct {
+	Vertex         string           // The vertex the operation belongs to
+	Expression     string           // The jq expression
+	Timeout        time.Duration    // The maximum time the expression runs
+	FailureHandler FuncErrorHandler // The Failure handler of the transformation
+	ErrorVertex    string           // The vertex routing the failures, if any
+
+	code  *gojq.Code // the compiled Expression
+	node  *sdk.Node  // the vertex the operation belongs to
+	scope *dagScope  // the dag defining the vertex
+}
+
+// CompileTransform compiles a jq expression, such as `{id: .order.id, total: (.items | map(.price) | add)}`
+func CompileTransform(expression string) (*TransformOperation, error) {
+
+	fmt.Println("lib/openfaas/transform.go::CompileTransform start")
+	query, err := gojq.Parse(expression)
+	if err != nil {
+		if parseErr, ok := err.(interface{ Token() (string, int) }); ok {
+			_, offset := parseErr.Token()
+			return nil, fmt.Errorf("invalid transform `%s` at %d, %v", expression, offset, err)
+		}
+		return nil, fmt.Errorf("invalid transform `%s`, %v", expression, err)
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform `%s`, %v", expression, err)
+	}
+	fmt.Println("lib/openfaas/transform.go::CompileTransform end")
+	return &TransformOperation{Expression: expression, Timeout: defaultTransformTimeout, code: code}, nil
+}
+
+// Transform adds an operation to the given vertex that transforms its JSON payload with a
+// jq expression, compiled when the flow is defined. The expression must produce exactly one
+// output, which becomes the payload, outputs are collected with `[...]`, such as `[.items[].id]`.
+// The expression runs for TransformTimeout at most. Failures are handled by the OnFailure option
+func (node *Node) Transform(expression string, opts ...Option) *Node {
+
+	fmt.Println("lib/openfaas/transform.go::Transform start")
+	operation, err := CompileTransform(expression)
+	if err != nil {
+		panic(fmt.Sprintf("Error at Transform for %s, %v", node.unode.Id, err))
+	}
+	operation.Vertex = node.unode.Id
+
+	o := &Options{}
+	for _, opt := range opts {
+		o.reset()
+		opt(o)
+		if o.failureHandler != nil {
+			operation.FailureHandler = o.failureHandler
+		}
+		if o.transformTimeout != 0 {
+			operation.Timeout = o.transformTimeout
+		}
+	}
+	node.register(operation)
+	node.unode.AddOperation(operation)
+	fmt.Println("lib/openfaas/transform.go::Transform end")
+	return node
+}
+
+func (operation *TransformOperation) bind(node *sdk.Node, scope *dagScope) {
+
+	operation.node = node
+	operation.scope = scope
+}
+
+func (operation *TransformOperation) routeErrors(vertex string) {
+
+	operation.ErrorVertex = vertex
+}
+
+func (operation *TransformOperation) GetId() string {
+
+	fmt.Println("lib/openfaas/transform.go::GetId start")
+	fmt.Println("lib/openfaas/transform.go::GetId end")
+	return "transform-" + operation.Vertex
+}
+
+// Encode returns the jq expression, CompileTransform compiles it back
+func (operation *TransformOperation) Encode() []byte {
+
+	fmt.Println("lib/openfaas/transform.go::Encode start")
+	fmt.Println("lib/openfaas/transform.go::Encode end")
+	return []byte(operation.Expression)
+}
+
+func (operation *TransformOperation) GetProperties() map[string][]string {
+
+	fmt.Println("lib/openfaas/transform.go::GetProperties start")
+	result := make(map[string][]string)
+	hasFailureHandler := "false"
+	if operation.FailureHandler != nil {
+		hasFailureHandler = "true"
+	}
+	result["isMod"] = []string{"true"}
+	result["isFunction"] = []string{"false"}
+	result["isHttpRequest"] = []string{"false"}
+	result["isTransform"] = []string{"true"}
+	result["hasFailureHandler"] = []string{hasFailureHandler}
+	result["transform"] = []string{operation.Expression}
+	result["transformTimeout"] = []string{operation.Timeout.String()}
+	fmt.Println("lib/openfaas/transform.go::GetProperties end")
+	return result
+}
+
+func (operation *TransformOperation) Execute(data []byte, option map[string]interface{}) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/transform.go::Execute start")
+	// a skipped path or a routed failure passes through the vertex
+	if isMarker(data) {
+		return passMarker(data, operation.ErrorVertex)
+	}
+	reqId := fmt.Sprintf("%v", option["request-id"])
+	result, err := operation.transform(data)
+	if err != nil {
+		err = fmt.Errorf("Transform(%s), error: %v", operation.Vertex, err)
+		if operation.FailureHandler != nil {
+			err = operation.FailureHandler(err)
+		}
+		// a recovered failure passes the payload on untransformed
+		if err == nil {
+			result = data
+		}
+	}
+	if err != nil && operation.ErrorVertex != "" {
+		fmt.Printf("[Request `%s`] Routing failure of vertex `%s` to its error edge, %v\n",
+			reqId, operation.ErrorVertex, err)
+		return encodeFailure(operation.ErrorVertex, operation.GetId(), data, err), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("lib/openfaas/transform.go::Execute end")
+	return result, nil
+}
+
+// transform runs the expression on the payload, an empty payload is null. The numbers are
+// decoded as json.Number so that the integers beyond 2^53 are kept exact
+func (operation *TransformOperation) transform(data []byte) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/transform.go::transform start")
+	var input interface{}
+	if len(data) != 0 {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err := decoder.Decode(&input)
+		if err == nil && decoder.More() {
+			err = fmt.Errorf("invalid data after the value at offset %d", decoder.InputOffset())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("payload is not valid JSON, %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), operation.Timeout)
+	defer cancel()
+	iter := operation.code.RunWithContext(ctx, input)
+	output, ok := iter.Next()
+	if !ok {
+		return nil, fmt.Errorf("`%s` produced no output, expected one", operation.Expression)
+	}
+	if err, ok := output.(error); ok {
+		return nil, operation.runError(err)
+	}
+	if next, ok := iter.Next(); ok {
+		if err, ok := next.(error); ok {
+			return nil, operation.runError(err)
+		}
+		return nil, fmt.Errorf("`%s` produced several outputs, expected one, collect them with `[...]`",
+			operation.Expression)
+	}
+	encoded, err := json.Marshal(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the output, %v", err)
+	}
+	fmt.Println("lib/openfaas/transform.go::transform end")
+	return encoded, nil
+}
+
+// runError returns the error of a run of the expression
+func (operation *TransformOperation) runError(err error) error {
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("`%s` timed out after %v", operation.Expression, operation.Timeout)
+	}
+	return err
+}
@@ -0,0 +1,157 @@
+package openfaas
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// transformOperation returns the transformation of the vertex order
+func transformOperation(dag *Dag, expression string, opts ...Option) *TransformOperation {
+
+	dag.Node("order").Transform(expression, opts...)
+	return dag.udag.GetNode("order").Operations()[0].(*TransformOperation)
+}
+
+func TestTransform(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		expression string
+		data       string
+		result     string
+		err        string
+	}{
+		{"object", `{id: .order.id, total: (.items | map(.price) | add)}`,
+			`{"order":{"id":"a"},"items":[{"price":2},{"price":3}]}`, `{"id":"a","total":5}`, ""},
+		{"identity", `.`, `[1,"x"]`, `[1,"x"]`, ""},
+		{"large integer", `.`, `{"id":12345678901234567891}`, `{"id":12345678901234567891}`, ""},
+		{"large integer in a computation", `{id: .id, next: (.id + 1)}`, `{"id":9007199254740993}`,
+			`{"id":9007199254740993,"next":9007199254740994}`, ""},
+		{"decimal number", `.n * 2`, `{"n":1.25}`, `2.5`, ""},
+		{"empty payload", `. == null`, ``, `true`, ""},
+		{"collected outputs", `[.[] | . * 2]`, `[1,2]`, `[2,4]`, ""},
+		{"single output of an iteration", `.[]`, `[1]`, `1`, ""},
+		{"several outputs", `.[]`, `[1,2]`, "", "`.[]` produced several outputs, expected one, collect them with `[...]`"},
+		{"no output", `.[]`, `[]`, "", "`.[]` produced no output, expected one"},
+		{"error of the expression", `error("bad order")`, `{}`, "", "bad order"},
+		{"error after an output", `1, error("bad order")`, `{}`, "", "bad order"},
+		{"invalid payload", `.`, `{"id":`, "", "payload is not valid JSON"},
+		{"trailing payload", `.`, `{} {}`, "", "payload is not valid JSON"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			operation := transformOperation(NewDag(), test.expression)
+			result, err := operation.Execute([]byte(test.data), map[string]interface{}{"request-id": "r"})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), "Transform(order), error: ") ||
+					!strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil || string(result) != test.result {
+				t.Fatalf("expected %s, got %s, %v", test.result, result, err)
+			}
+		})
+	}
+}
+
+func TestTransformTimeout(t *testing.T) {
+
+	operation := transformOperation(NewDag(), `last(range(1e12))`, TransformTimeout(20*time.Millisecond))
+	start := time.Now()
+	_, err := operation.Execute([]byte(`{}`), map[string]interface{}{"request-id": "r"})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 20ms") {
+		t.Fatalf("expected the transformation to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the transformation stopped, ran for %v", elapsed)
+	}
+	if timeout := transformOperation(NewDag(), `.`).Timeout; timeout != defaultTransformTimeout {
+		t.Fatalf("expected the default timeout, got %v", timeout)
+	}
+}
+
+func TestTransformFailures(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		route   bool
+		result  string
+		err     string
+		failure bool
+	}{
+		{"handled", []Option{OnFailure(func(err error) error { return fmt.Errorf("rejected, %v", err) })},
+			false, "", "rejected, Transform(order)", false},
+		{"recovered", []Option{OnFailure(func(err error) error { return nil })}, false, `[]`, "", false},
+		{"routed", nil, true, "", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dag := NewDag()
+			operation := transformOperation(dag, `.[]`, test.opts...)
+			if test.route {
+				dag.Node("failed")
+				dag.ErrorEdge("order", "failed")
+			}
+			result, err := operation.Execute([]byte(`[]`), map[string]interface{}{"request-id": "r"})
+			switch {
+			case test.err != "":
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+			case test.failure:
+				envelope := &ErrorEnvelope{}
+				if err != nil || !isFailure(result) || json.Unmarshal(decodeFailure(result), envelope) != nil {
+					t.Fatalf("expected a failure, got %s, %v", result, err)
+				}
+				if envelope.Vertex != "order" || envelope.Operation != "transform-order" {
+					t.Fatalf("unexpected envelope %+v", envelope)
+				}
+			default:
+				if err != nil || string(result) != test.result {
+					t.Fatalf("expected %s, got %s, %v", test.result, result, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTransformDefinition(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		expression string
+		err        string
+	}{
+		{"syntax error", `{id: .id`, "Error at Transform for order, invalid transform `{id: .id` at"},
+		{"unknown function", `nope(.)`, "Error at Transform for order, invalid transform `nope(.)`, function not defined"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), test.err) {
+					t.Fatalf("expected panic %q, got %v", test.err, r)
+				}
+			}()
+			NewDag().Node("order").Transform(test.expression)
+		})
+	}
+}
+
+func TestTransformEncode(t *testing.T) {
+
+	operation := transformOperation(NewDag(), `{id: .id}`, TransformTimeout(time.Second))
+	compiled, err := CompileTransform(string(operation.Encode()))
+	if err != nil || compiled.Expression != `{id: .id}` {
+		t.Fatalf("expected the expression compiled back, got %v, %v", compiled, err)
+	}
+	properties := operation.GetProperties()
+	if properties["transform"][0] != `{id: .id}` || properties["transformTimeout"][0] != "1s" {
+		t.Fatalf("unexpected properties %v", properties)
+	}
+}
@@ -0,0 +1,79 @@
+package openfaas
+
+import (
+	"fmt"
+)
+
+const (
+	// tryBody the vertex of the body dag in a TrySubDag
+	tryBody = "try-body"
+	// tryCatch the vertex of the catch dag in a TrySubDag
+	tryCatch = "try-catch"
+	// tryResult the vertex joining the body and the catch dag in a TrySubDag
+	tryResult = "try-result"
+)
+
+// TrySubDag composites a body dag as a node, a failure of an operation anywhere in
+// the body dag is caught and the catch dag executes with the JSON ErrorEnvelope of
+// the failure as input. The flow then continues with the output of the catch dag,
+// or with the output of the body dag if nothing failed.
+// Within a ForEachBranch dag the failure of an item is caught without failing the
+// other items. Failures of operations added with AddOperation, of foreach and of
+// condition functions are not caught
+func (this *Dag) TrySubDag(vertex string, body *Dag, catch *Dag) {
+
+	fmt.Println("lib/openfaas/try.go::TrySubDag start")
+	if body == nil || catch == nil {
+		panic(fmt.Sprintf("Error at TrySubDag for %s, body or catch dag not specified", vertex))
+	}
+
+	try := NewDag()
+	try.SubDag(tryBody, body)
+	try.SubDag(tryCatch, catch)
+	try.ErrorEdge(tryBody, tryCatch)
+	try.Edge(tryBody, tryResult)
+	try.Edge(tryCatch, tryResult)
+	try.Node(tryResult, Aggregator(tryAggregator))
+
+	body.scope.catchErrors()
+	this.SubDag(vertex, try)
+	fmt.Println("lib/openfaas/try.go::TrySubDag end")
+}
+
+// tryAggregator outputs the result of the dag that wasn't skipped
+func tryAggregator(results map[string][]byte) ([]byte, error) {
+
+	fmt.Println("lib/openfaas/try.go::tryAggregator start")
+	for _, result := range results {
+		fmt.Println("lib/openfaas/try.go::tryAggregator end")
+		return result, nil
+	}
+	fmt.Println("lib/openfaas/try.go::tryAggregator end")
+	return []byte(""), nil
+}
+
+// catching checks if the failures in the dag are caught by a TrySubDag
+func (scope *dagScope) catching() bool {
+
+	for ; scope != nil; scope = scope.parent {
+		if scope.catches {
+			return true
+		}
+	}
+	return false
+}
+
+// catchErrors routes the failures of the lib operations of the
+// scope and its children so that they are caught
+func (scope *dagScope) catchErrors() {
+
+	fmt.Println("lib/openfaas/try.go::dagScope::catchErrors start")
+	scope.catches = true
+	for _, scoped := range scope.operations {
+		scoped.operation.routeErrors(scoped.vertex)
+	}
+	for _, child := range scope.children {
+		child.catchErrors()
+	}
+	fmt.Println("lib/openfaas/try.go::dagScope::catchErrors end")
+}
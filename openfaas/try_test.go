@@ -0,0 +1,135 @@
+package openfaas
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// tryDag returns a TrySubDag whose body runs the vertices a then b, a failing when its
+// input is `fail`, and whose catch dag runs the vertex recover
+func tryDag() (*Dag, *Dag, *Dag) {
+
+	body := NewDag()
+	body.Node("a").Modify(func(data []byte) ([]byte, error) {
+		if string(data) == "fail" {
+			return nil, fmt.Errorf("invalid order")
+		}
+		return data, nil
+	})
+	body.Node("b").Modify(func(data []byte) ([]byte, error) { return append(data, '!'), nil })
+	body.Edge("a", "b")
+
+	catch := NewDag()
+	catch.Node("recover").Modify(func(data []byte) ([]byte, error) {
+		envelope := &ErrorEnvelope{}
+		if err := json.Unmarshal(data, envelope); err != nil {
+			return nil, err
+		}
+		return []byte("recovered from " + envelope.Vertex), nil
+	})
+
+	dag := NewDag()
+	dag.TrySubDag("try", body, catch)
+	return dag, body, catch
+}
+
+// modifier returns the operation of vertex in dag
+func modifier(dag *Dag, vertex string) *FaasOperation {
+
+	return dag.udag.GetNode(vertex).Operations()[0].(*FaasOperation)
+}
+
+func TestTrySubDag(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		input  string
+		caught bool
+		result string
+	}{
+		{"body succeeds", "order", false, "order!"},
+		{"failure caught", "fail", true, "recovered from a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dag, body, catch := tryDag()
+			try := dag.udag.GetNode("try").SubDag()
+			option := map[string]interface{}{"request-id": "r"}
+
+			// the body runs, a failure passes through the rest of the body
+			output, err := modifier(body, "a").Execute([]byte(test.input), option)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			output, err = modifier(body, "b").Execute(output, option)
+			if err != nil || isFailure(output) != test.caught {
+				t.Fatalf("unexpected output of the body %s, %v", output, err)
+			}
+
+			// the catch dag receives the failure, the result edge of the body is skipped
+			bodyNode := try.GetNode(tryBody)
+			caught := bodyNode.GetForwarder(tryCatch)(output)
+			if IsSkipped(caught) == test.caught {
+				t.Fatalf("unexpected input of the catch dag %s", caught)
+			}
+			bodyResult := bodyNode.GetForwarder(tryResult)(output)
+			if IsSkipped(bodyResult) != test.caught {
+				t.Fatalf("unexpected result of the body %s", bodyResult)
+			}
+			if test.caught {
+				envelope := &ErrorEnvelope{}
+				if json.Unmarshal(caught, envelope) != nil || envelope.Vertex != "a" || envelope.Operation != "Modifier" ||
+					!strings.Contains(envelope.Message, "invalid order") || string(envelope.InputBytes) != "fail" {
+					t.Fatalf("unexpected envelope %s", caught)
+				}
+			}
+			catchResult, err := modifier(catch, "recover").Execute(caught, option)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			// the flow continues with the dag that wasn't skipped
+			result, err := try.GetNode(tryResult).GetAggregator()(map[string][]byte{
+				tryBody: bodyResult, tryCatch: catchResult})
+			if err != nil || string(result) != test.result {
+				t.Fatalf("expected %s, got %s, %v", test.result, result, err)
+			}
+		})
+	}
+}
+
+func TestTrySubDagRoutesNestedFailures(t *testing.T) {
+
+	body := NewDag()
+	items := body.ForEachBranch("items", func(data []byte) map[string][]byte { return nil },
+		Aggregator(func(map[string][]byte) ([]byte, error) { return nil, nil }))
+	items.Node("item").Apply("f")
+	inner := NewDag()
+	inner.Node("step").Apply("g")
+	body.SubDag("inner", inner)
+	body.Edge("items", "inner")
+
+	// operations defined after the TrySubDag are caught too
+	NewDag().TrySubDag("try", body, NewDag())
+	body.Node("late").Apply("h")
+	body.Edge("inner", "late")
+
+	for vertex, dag := range map[string]*Dag{"item": items, "step": inner, "late": body} {
+		if operation := dag.udag.GetNode(vertex).Operations()[0].(*FaasOperation); operation.ErrorVertex != vertex {
+			t.Fatalf("expected the failures of %s caught, routed to %q", vertex, operation.ErrorVertex)
+		}
+	}
+}
+
+func TestTrySubDagDefinition(t *testing.T) {
+
+	defer func() {
+		expected := "Error at TrySubDag for try, body or catch dag not specified"
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), expected) {
+			t.Fatalf("expected panic %q, got %v", expected, r)
+		}
+	}()
+	NewDag().TrySubDag("try", NewDag(), nil)
+}
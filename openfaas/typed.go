@@ -0,0 +1,43 @@
+package openfaas
+
+import (
+	"fmt"
+
+	"github.com/Abhishekghosh1998/faasflow-lib/codec"
+)
+
+// ModifyJSON adds a typed modifier to the given vertex, its input is
+// decoded from JSON into an In and its output encoded to JSON
+func ModifyJSON[In, Out any](node *Node, mod func(In) (Out, error)) *Node {
+
+	return ModifyTyped(node, codec.JSON, mod)
+}
+
+// ModifyTyped adds a typed modifier to the given vertex, its input is decoded into an In
+// and its output encoded with the codec. An input or output the codec fails on fails
+// the vertex with a *codec.Error naming the vertex and the operation
+func ModifyTyped[In, Out any](node *Node, c codec.Codec, mod func(In) (Out, error)) *Node {
+
+	fmt.Println("lib/openfaas/typed.go::ModifyTyped start")
+	if c == nil {
+		panic(fmt.Sprintf("Error at ModifyTyped for %s, codec not specified", node.unode.Id))
+	}
+	if mod == nil {
+		panic(fmt.Sprintf("Error at ModifyTyped for %s, modifier not specified", node.unode.Id))
+	}
+	vertex := node.unode.Id
+	operation := fmt.Sprintf("modifier-%d", len(node.unode.Operations()))
+	node.Modify(func(data []byte) ([]byte, error) {
+		input, err := codec.DecodeInput[In](c, vertex, operation, data)
+		if err != nil {
+			return nil, err
+		}
+		output, err := mod(input)
+		if err != nil {
+			return nil, err
+		}
+		return codec.EncodeOutput(c, vertex, operation, output)
+	})
+	fmt.Println("lib/openfaas/typed.go::ModifyTyped end")
+	return node
+}
@@ -2,7 +2,11 @@ package openfaas
 
 import (
 	"fmt"
+	"math"
+	"strings"
+	"time"
 
+	"github.com/Abhishekghosh1998/faasflow-lib/codec"
 	sdk "github.com/Abhishekghosh1998/faasflow-sdk"
 )
 
@@ -18,25 +22,103 @@ type Options struct {
 	failureHandler  FuncErrorHandler
 	requestHandler  ReqHandler
 	responseHandler RespHandler
+	coalesce        bool
+	// Rate limit options
+	rateLimitRps     float64
+	rateLimitBurst   int
+	rateLimitScope   string
+	rateLimitMaxWait *time.Duration
+	// Bulkhead options
+	maxInFlight  int
+	queueTimeout *time.Duration
+	// Hedging options
+	idempotent    bool
+	hedgeAfter    time.Duration
+	hedgeMaxExtra int
+	// Mirror options
+	mirror           string
+	mirrorSampleRate float64
+	mirrorSink       MirrorSink
+	mirrorTimeout    *time.Duration
+	// Route options
+	stickyKey       StickyKey
+	stickyOnRequest bool
+	routeContext    *Context
+	// Fallback options
+	fallback   *FaasOperation
+	fallbackOn ErrorClassifier
+	// Saga options
+	compensation *FaasOperation
+	// Event options
+	eventTimeout time.Duration
+	tokenHandler TokenHandler
+	// Codec options
+	payloadCodec codec.Codec
+	flowCodec    codec.Codec
+	// Template options
+	templateContext *Context
+	// Transform options
+	transformTimeout time.Duration
 }
 
 // BranchOptions options for branching in DAG
 type BranchOptions struct {
-	aggregator  sdk.Aggregator
-	forwarder   sdk.Forwarder
-	noforwarder bool
+	aggregator        sdk.Aggregator
+	forwarder         sdk.Forwarder
+	modifier          Modifier
+	noforwarder       bool
+	continueOnError   bool
+	minSuccess        int
+	minSuccessPercent float64
+	maxParallel       int
+	parallelStore     StateStore
+	parallelTimeout   *time.Duration
+	batchSize         int
+	join              *joinPolicy
+	elseBranch        bool
+	matchMode         string
+	guard             *guard
+	maxIterations     int
+	iterationContext  *Context
+	convert           *codecConversion
 }
 
 type Workflow struct {
 	pipeline *sdk.Pipeline // underline pipeline definition object
+	scope    *dagScope     // scope of the workflow dag
+
+	saga           *saga                    // saga mode state, nil if disabled
+	failureHandler sdk.PipelineErrorHandler // failure handler set by OnFailure
 }
 
 type Dag struct {
-	udag *sdk.Dag
+	udag  *sdk.Dag
+	scope *dagScope
 }
 
 type Node struct {
 	unode *sdk.Node
+	scope *dagScope
+}
+
+// dagScope links a dag to the dag it is composed into, so that operations
+// can reach the workflow they execute in
+type dagScope struct {
+	parent   *dagScope
+	children []*dagScope
+	flow     *Workflow
+
+	steps        []*sagaStep         // compensable steps defined in the dag
+	errorEdges   map[string][]string // error edge targets by failing vertex
+	timeoutEdges map[string][]string // timeout edge targets by waiting vertex
+	operations   []*scopedOperation  // lib operations defined in the dag
+	catches      bool                // failures in the dag are caught by a TrySubDag
+}
+
+// scopedOperation a lib operation and the vertex it belongs to
+type scopedOperation struct {
+	vertex    string
+	operation libOperation
 }
 
 type Option func(*Options)
@@ -57,6 +139,32 @@ func (o *Options) reset() {
 	o.failureHandler = nil
 	o.requestHandler = nil
 	o.responseHandler = nil
+	o.coalesce = false
+	o.rateLimitRps = 0
+	o.rateLimitBurst = 0
+	o.rateLimitScope = ""
+	o.rateLimitMaxWait = nil
+	o.maxInFlight = 0
+	o.queueTimeout = nil
+	o.idempotent = false
+	o.hedgeAfter = 0
+	o.hedgeMaxExtra = 0
+	o.mirror = ""
+	o.mirrorSampleRate = 0
+	o.mirrorSink = nil
+	o.mirrorTimeout = nil
+	o.stickyKey = nil
+	o.stickyOnRequest = false
+	o.routeContext = nil
+	o.fallback = nil
+	o.fallbackOn = nil
+	o.compensation = nil
+	o.eventTimeout = 0
+	o.tokenHandler = nil
+	o.payloadCodec = nil
+	o.flowCodec = nil
+	o.templateContext = nil
+	o.transformTimeout = 0
 	fmt.Println("lib/openfaas/workflow.go::Options::reset end")
 }
 
@@ -67,6 +175,21 @@ func (o *BranchOptions) reset() {
 	o.aggregator = nil
 	o.noforwarder = false
 	o.forwarder = nil
+	o.modifier = nil
+	o.continueOnError = false
+	o.minSuccess = 0
+	o.minSuccessPercent = 0
+	o.maxParallel = 0
+	o.parallelStore = nil
+	o.parallelTimeout = nil
+	o.batchSize = 0
+	o.join = nil
+	o.elseBranch = false
+	o.matchMode = ""
+	o.guard = nil
+	o.maxIterations = 0
+	o.iterationContext = nil
+	o.convert = nil
 	fmt.Println("lib/openfaas/workflow.go::BranchOptions::reset end")
 }
 
@@ -102,7 +225,250 @@ func Forwarder(forwarder sdk.Forwarder) BranchOption {
 	}
 }
 
-// Header Specify a header in a http call
+// ForwardWith forwards the data through modifier, such as a modifier of the jsonutil
+// package. A modifier failing forwards a failure, caught by a TrySubDag or failing
+// the operations it reaches
+func ForwardWith(modifier Modifier) BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::ForwardWith start")
+	if modifier == nil {
+		panic("Error at ForwardWith, modifier not specified")
+	}
+	fmt.Println("lib/openfaas/workflow.go::ForwardWith end")
+	return func(o *BranchOptions) {
+		o.modifier = modifier
+	}
+}
+
+// Convert converts the data forwarded on an edge from the payload format of
+// the parent vertex to the one of the child vertex
+func Convert(from, to codec.Codec) BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::Convert start")
+	if from == nil || to == nil {
+		panic("Error at Convert, codecs not specified")
+	}
+	fmt.Println("lib/openfaas/workflow.go::Convert end")
+	return func(o *BranchOptions) {
+		o.convert = &codecConversion{from: from, to: to}
+	}
+}
+
+// ContinueOnError tolerates the failing items of a foreach branch, the failures
+// are caught and listed to the aggregator at FailedItemsKey
+func ContinueOnError() BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::ContinueOnError start")
+	fmt.Println("lib/openfaas/workflow.go::ContinueOnError end")
+	return func(o *BranchOptions) {
+		o.continueOnError = true
+	}
+}
+
+// MinSuccess tolerates the failing items of a foreach branch as long
+// as at least count items succeed, otherwise the branch fails
+func MinSuccess(count int) BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::MinSuccess start")
+	if count <= 0 {
+		panic(fmt.Sprintf("Error at MinSuccess, invalid count %d", count))
+	}
+	fmt.Println("lib/openfaas/workflow.go::MinSuccess end")
+	return func(o *BranchOptions) {
+		o.continueOnError = true
+		o.minSuccess = count
+	}
+}
+
+// MinSuccessPercent tolerates the failing items of a foreach branch as long as
+// at least percent of the items succeed, otherwise the branch fails
+func MinSuccessPercent(percent float64) BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::MinSuccessPercent start")
+	if percent <= 0 || percent > 100 {
+		panic(fmt.Sprintf("Error at MinSuccessPercent, invalid percent %v", percent))
+	}
+	fmt.Println("lib/openfaas/workflow.go::MinSuccessPercent end")
+	return func(o *BranchOptions) {
+		o.continueOnError = true
+		o.minSuccessPercent = percent
+	}
+}
+
+// WaitAll executes a join vertex once every input arrived, the default
+func WaitAll() BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::WaitAll start")
+	fmt.Println("lib/openfaas/workflow.go::WaitAll end")
+	return func(o *BranchOptions) {
+		o.join = &joinPolicy{}
+	}
+}
+
+// WaitAny executes a join vertex with the first input arrived, the later inputs are
+// skipped. The skipped inputs and the caught failures don't win, the join executes with
+// them once every input arrived otherwise. Without an aggregator the join passes its
+// input on. It requires the executor wrapped with JoiningExecutor
+func WaitAny() BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::WaitAny start")
+	fmt.Println("lib/openfaas/workflow.go::WaitAny end")
+	return func(o *BranchOptions) {
+		o.join = &joinPolicy{count: 1}
+	}
+}
+
+// WaitN executes a join vertex once count inputs arrived, the later inputs are skipped.
+// The skipped inputs and the caught failures aren't counted, the join executes with them
+// once every input arrived otherwise. The inputs are aggregated by the aggregator of the
+// vertex. It requires the executor wrapped with JoiningExecutor
+func WaitN(count int) BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::WaitN start")
+	if count <= 0 {
+		panic(fmt.Sprintf("Error at WaitN, invalid count %d", count))
+	}
+	fmt.Println("lib/openfaas/workflow.go::WaitN end")
+	return func(o *BranchOptions) {
+		o.join = &joinPolicy{count: count}
+	}
+}
+
+// When selects the condition key of a ConditionalBranch when the predicate holds for
+// the branch input, the conditions are checked in the order of the When options.
+// On an Edge it takes no key, the edge is taken when the predicate holds for the
+// output of the vertex, otherwise the path is skipped (see ErrorEdge for how
+// skipped paths propagate). A predicate failing to evaluate on an Edge forwards a
+// failure, caught by a TrySubDag or failing the operation it reaches.
+// The predicate is either an Expression, its source such as `$.amount > 1000`
+// compiled at definition, or a Go func([]byte) bool
+func When(predicate interface{}, key ...string) BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::When start")
+	if len(key) > 1 {
+		panic(fmt.Sprintf("Error at When, multiple keys %v", key))
+	}
+	g := newGuard(predicate, strings.Join(key, ""))
+	fmt.Println("lib/openfaas/workflow.go::When end")
+	return func(o *BranchOptions) {
+		o.guard = g
+	}
+}
+
+// MaxIterations bounds the iterations of a LoopBranch, at most MaxLoopIterations
+func MaxIterations(count int) BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::MaxIterations start")
+	if count <= 0 || count > MaxLoopIterations {
+		panic(fmt.Sprintf("Error at MaxIterations, invalid count %d, expected 1 to %d", count, MaxLoopIterations))
+	}
+	fmt.Println("lib/openfaas/workflow.go::MaxIterations end")
+	return func(o *BranchOptions) {
+		o.maxIterations = count
+	}
+}
+
+// RecordIteration records the current iteration of a LoopBranch in
+// the context at IterationKey, starting at 1
+func RecordIteration(context *Context) BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::RecordIteration start")
+	fmt.Println("lib/openfaas/workflow.go::RecordIteration end")
+	return func(o *BranchOptions) {
+		o.iterationContext = context
+	}
+}
+
+// Else adds a dag to a ConditionalBranch at ElseCondition,
+// it executes when the condition matches none of the conditions
+func Else() BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::Else start")
+	fmt.Println("lib/openfaas/workflow.go::Else end")
+	return func(o *BranchOptions) {
+		o.elseBranch = true
+	}
+}
+
+// FirstMatch executes only the dag of the first condition
+// returned by the condition function of a ConditionalBranch
+func FirstMatch() BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::FirstMatch start")
+	fmt.Println("lib/openfaas/workflow.go::FirstMatch end")
+	return func(o *BranchOptions) {
+		o.matchMode = matchFirst
+	}
+}
+
+// AllMatches executes the dag of every condition returned by
+// the condition function of a ConditionalBranch, the default
+func AllMatches() BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::AllMatches start")
+	fmt.Println("lib/openfaas/workflow.go::AllMatches end")
+	return func(o *BranchOptions) {
+		o.matchMode = matchAll
+	}
+}
+
+// MaxParallel limits the items of a foreach branch executing at once, the
+// other items wait for a slot. With BatchSize it limits the batches. The slots
+// are counted in store, which must be the StateStore of the request, so that
+// the items executing on every replica share them. An item waits for a slot
+// for at most ParallelTimeout, a failing item frees its slot. The waiting items
+// poll for a slot, they aren't queued: the items beyond the limit must get one
+// within ParallelTimeout, raise it for a large fan-out behind a small limit
+func MaxParallel(limit int, store StateStore) BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::MaxParallel start")
+	if limit <= 0 {
+		panic(fmt.Sprintf("Error at MaxParallel, invalid limit %d", limit))
+	}
+	if store == nil {
+		panic("Error at MaxParallel, StateStore not specified")
+	}
+	fmt.Println("lib/openfaas/workflow.go::MaxParallel end")
+	return func(o *BranchOptions) {
+		o.maxParallel = limit
+		o.parallelStore = store
+	}
+}
+
+// ParallelTimeout sets the maximum wait of an item of a foreach branch with
+// MaxParallel for a slot, DefaultParallelTimeout by default. An item that
+// times out fails with ERR_PARALLEL_TIMEOUT. With n items of duration d and a
+// limit of l, the last items wait about (n/l - 1) * d
+func ParallelTimeout(timeout time.Duration) BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::ParallelTimeout start")
+	if timeout < 0 {
+		panic(fmt.Sprintf("Error at ParallelTimeout, invalid timeout %v", timeout))
+	}
+	fmt.Println("lib/openfaas/workflow.go::ParallelTimeout end")
+	return func(o *BranchOptions) {
+		o.parallelTimeout = &timeout
+	}
+}
+
+// BatchSize groups the items of a foreach branch in batches of size items in the
+// order of their keys, each batch executes the sub-dag once with a JSON list of
+// BatchItem as input (see DecodeBatch). The aggregator receives the output of each
+// batch, the batch keys sort in the order of the items
+func BatchSize(size int) BranchOption {
+
+	fmt.Println("lib/openfaas/workflow.go::BatchSize start")
+	if size <= 0 {
+		panic(fmt.Sprintf("Error at BatchSize, invalid size %d", size))
+	}
+	fmt.Println("lib/openfaas/workflow.go::BatchSize end")
+	return func(o *BranchOptions) {
+		o.batchSize = size
+	}
+}
+
+// Header Specify a header in a http call, the value can be a template
+// such as {{.ctx.tenant}}, see Request
 func Header(key, value string) Option {
 
 	fmt.Println("lib/openfaas/workflow.go::Header start")
@@ -112,7 +478,8 @@ func Header(key, value string) Option {
 	}
 }
 
-// Query Specify a query parameter in a http call
+// Query Specify a query parameter in a http call, the values can be
+// templates such as {{.payload.page}}, see Request
 func Query(key string, value ...string) Option {
 
 	fmt.Println("lib/openfaas/workflow.go::Query start")
@@ -156,12 +523,343 @@ func OnReponse(handler RespHandler) Option {
 	}
 }
 
+// Coalesce shares a single upstream call between identical concurrent calls
+// (same vertex, target, method, body, query and headers) made within the process,
+// all the callers receive the result of the shared call. The calls of an operation
+// with a request or response handler are only shared by the operation itself
+func Coalesce() Option {
+
+	fmt.Println("lib/openfaas/workflow.go::Coalesce start")
+	fmt.Println("lib/openfaas/workflow.go::Coalesce end")
+	return func(o *Options) {
+		o.coalesce = true
+	}
+}
+
+// RateLimit limits the upstream calls to rps calls per second with bursts of
+// up to burst calls, the limit is shared by all the operations of the process
+// calling the same function with the same rps and burst, by default the call
+// waits for its turn. A burst of zero allows one call at once
+func RateLimit(rps float64, burst int) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::RateLimit start")
+	if rps <= 0 || math.IsNaN(rps) || math.IsInf(rps, 0) {
+		panic(fmt.Sprintf("Error at RateLimit, invalid rps %v", rps))
+	}
+	if burst < 0 {
+		panic(fmt.Sprintf("Error at RateLimit, invalid burst %d", burst))
+	}
+	fmt.Println("lib/openfaas/workflow.go::RateLimit end")
+	return func(o *Options) {
+		o.rateLimitRps = rps
+		o.rateLimitBurst = burst
+	}
+}
+
+// RateLimitScope specify how the rate limit is shared, either ScopeFunction
+// (default) or ScopeHost to share it with all the calls to the same host
+func RateLimitScope(scope string) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::RateLimitScope start")
+	if scope != ScopeFunction && scope != ScopeHost {
+		panic(fmt.Sprintf("Error at RateLimitScope, invalid scope %s", scope))
+	}
+	fmt.Println("lib/openfaas/workflow.go::RateLimitScope end")
+	return func(o *Options) {
+		o.rateLimitScope = scope
+	}
+}
+
+// RateLimitMaxWait specify the maximum time a call waits for the rate limit,
+// beyond which it fails with ERR_RATE_LIMITED. Zero fails immediately
+func RateLimitMaxWait(maxWait time.Duration) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::RateLimitMaxWait start")
+	fmt.Println("lib/openfaas/workflow.go::RateLimitMaxWait end")
+	return func(o *Options) {
+		o.rateLimitMaxWait = &maxWait
+	}
+}
+
+// MaxInFlight caps the concurrent calls to the same function (or url) within
+// the process to limit, calls beyond the limit are queued for a free slot.
+// The operations calling the same target must give it the same limit
+func MaxInFlight(limit int) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::MaxInFlight start")
+	if limit <= 0 {
+		panic(fmt.Sprintf("Error at MaxInFlight, invalid limit %d", limit))
+	}
+	fmt.Println("lib/openfaas/workflow.go::MaxInFlight end")
+	return func(o *Options) {
+		o.maxInFlight = limit
+	}
+}
+
+// QueueTimeout specify the maximum time a call waits for a MaxInFlight slot,
+// beyond which it fails with ERR_BULKHEAD_FULL. By default it waits forever
+func QueueTimeout(timeout time.Duration) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::QueueTimeout start")
+	fmt.Println("lib/openfaas/workflow.go::QueueTimeout end")
+	return func(o *Options) {
+		o.queueTimeout = &timeout
+	}
+}
+
+// Idempotent marks the call as safe to be repeated with the same input
+func Idempotent() Option {
+
+	fmt.Println("lib/openfaas/workflow.go::Idempotent start")
+	fmt.Println("lib/openfaas/workflow.go::Idempotent end")
+	return func(o *Options) {
+		o.idempotent = true
+	}
+}
+
+// Hedge issues a duplicate call when no response has arrived within after,
+// up to maxExtra duplicates. The first successful response is used and the
+// other calls are cancelled. It requires the call to be marked Idempotent
+func Hedge(after time.Duration, maxExtra int) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::Hedge start")
+	if maxExtra <= 0 {
+		panic(fmt.Sprintf("Error at Hedge, invalid maxExtra %d", maxExtra))
+	}
+	fmt.Println("lib/openfaas/workflow.go::Hedge end")
+	return func(o *Options) {
+		o.hedgeAfter = after
+		o.hedgeMaxExtra = maxExtra
+	}
+}
+
+// Mirror sends a copy of the function call to a shadow function for a
+// sampleRate fraction (0 to 1) of the calls. The copy is fired asynchronously
+// and its result is ignored by the flow, it is bounded by MirrorTimeout.
+// Mirror is only supported by Apply, not by Request
+func Mirror(function string, sampleRate float64) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::Mirror start")
+	fmt.Println("lib/openfaas/workflow.go::Mirror end")
+	return MirrorWithDiff(function, sampleRate, nil)
+}
+
+// MirrorWithDiff mirrors the function call as Mirror does and records
+// the diff between the primary and the shadow responses to the sink
+func MirrorWithDiff(function string, sampleRate float64, sink MirrorSink) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::MirrorWithDiff start")
+	if function == "" {
+		panic("Error at Mirror, shadow function not specified")
+	}
+	if sampleRate < 0 || sampleRate > 1 {
+		panic(fmt.Sprintf("Error at Mirror for %s, invalid sampleRate %v", function, sampleRate))
+	}
+	fmt.Println("lib/openfaas/workflow.go::MirrorWithDiff end")
+	return func(o *Options) {
+		o.mirror = function
+		o.mirrorSampleRate = sampleRate
+		o.mirrorSink = sink
+	}
+}
+
+// MirrorTimeout specify the bound of the shadow calls of the operation and of
+// their wait for the primary result, DefaultMirrorTimeout by default
+func MirrorTimeout(timeout time.Duration) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::MirrorTimeout start")
+	if timeout <= 0 {
+		panic(fmt.Sprintf("Error at MirrorTimeout, invalid timeout %v", timeout))
+	}
+	fmt.Println("lib/openfaas/workflow.go::MirrorTimeout end")
+	return func(o *Options) {
+		o.mirrorTimeout = &timeout
+	}
+}
+
+// StickyOn makes a Route pick the same function for executions
+// sharing the key extracted from the payload
+func StickyOn(key StickyKey) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::StickyOn start")
+	fmt.Println("lib/openfaas/workflow.go::StickyOn end")
+	return func(o *Options) {
+		o.stickyKey = key
+	}
+}
+
+// StickyOnRequest makes a Route pick the same function for a request id
+func StickyOnRequest() Option {
+
+	fmt.Println("lib/openfaas/workflow.go::StickyOnRequest start")
+	fmt.Println("lib/openfaas/workflow.go::StickyOnRequest end")
+	return func(o *Options) {
+		o.stickyOnRequest = true
+	}
+}
+
+// RecordRoute records the function a Route picked in the context
+// at RouteKey(vertex), so the downstream vertices can see it
+func RecordRoute(context *Context) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::RecordRoute start")
+	fmt.Println("lib/openfaas/workflow.go::RecordRoute end")
+	return func(o *Options) {
+		o.routeContext = context
+	}
+}
+
+// Fallback adds an alternate target executed with the same input when the call
+// and the fallbacks before it failed. The target is either a function name or
+// a target created by FunctionFallback or ModifierFallback
+func Fallback(target interface{}) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::Fallback start")
+	fallback := parseTarget("Fallback", target)
+	fmt.Println("lib/openfaas/workflow.go::Fallback end")
+	return func(o *Options) {
+		o.fallback = fallback
+	}
+}
+
+// FallbackOn specify the failures that trigger the fallbacks,
+// by default every failure does
+func FallbackOn(classifier ErrorClassifier) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::FallbackOn start")
+	fmt.Println("lib/openfaas/workflow.go::FallbackOn end")
+	return func(o *Options) {
+		o.fallbackOn = classifier
+	}
+}
+
+// attach composes the scope of a dag into the scope
+func (scope *dagScope) attach(child *dagScope) {
+
+	fmt.Println("lib/openfaas/workflow.go::dagScope::attach start")
+	child.parent = scope
+	scope.children = append(scope.children, child)
+	if scope.catching() {
+		child.catchErrors()
+	}
+	fmt.Println("lib/openfaas/workflow.go::dagScope::attach end")
+}
+
+// workflow returns the workflow the scope belongs to, nil if the
+// dag isn't composed into a workflow dag
+func (scope *dagScope) workflow() *Workflow {
+
+	for scope.parent != nil {
+		scope = scope.parent
+	}
+	return scope.flow
+}
+
+// Compensate specify the undo of the call run when the workflow fails in saga mode,
+// the target is either a function name or a target created by FunctionFallback
+// or ModifierFallback, it receives the output of the call
+func Compensate(target interface{}) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::Compensate start")
+	compensation := parseTarget("Compensate", target)
+	fmt.Println("lib/openfaas/workflow.go::Compensate end")
+	return func(o *Options) {
+		o.compensation = compensation
+	}
+}
+
+// EventTimeout sets how long WaitForEvent waits for the event, 0 waits forever
+func EventTimeout(timeout time.Duration) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::EventTimeout start")
+	if timeout < 0 {
+		panic(fmt.Sprintf("Error at EventTimeout, invalid timeout %v", timeout))
+	}
+	fmt.Println("lib/openfaas/workflow.go::EventTimeout end")
+	return func(o *Options) {
+		o.eventTimeout = timeout
+	}
+}
+
+// OnEventToken sets a handler called with the resume token of WaitForEvent,
+// such as one sending the approval request to a reviewer
+func OnEventToken(handler TokenHandler) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::OnEventToken start")
+	if handler == nil {
+		panic("Error at OnEventToken, token handler not specified")
+	}
+	fmt.Println("lib/openfaas/workflow.go::OnEventToken end")
+	return func(o *Options) {
+		o.tokenHandler = handler
+	}
+}
+
+// Codec sets the payload format of the function or the url, the call sends the
+// Content-Type of the codec and an Accept header preferring it, unless set by Header
+func Codec(c codec.Codec) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::Codec start")
+	if c == nil {
+		panic("Error at Codec, codec not specified")
+	}
+	fmt.Println("lib/openfaas/workflow.go::Codec end")
+	return func(o *Options) {
+		o.payloadCodec = c
+	}
+}
+
+// ConvertFrom sets the payload format of the flow when it differs from the Codec of
+// the function or the url, the input is converted to the Codec before the call and
+// the response converted back from the codec of its Content-Type. The Accept header
+// also accepts the payload format of the flow, a response in it isn't converted
+func ConvertFrom(flow codec.Codec) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::ConvertFrom start")
+	if flow == nil {
+		panic("Error at ConvertFrom, codec not specified")
+	}
+	fmt.Println("lib/openfaas/workflow.go::ConvertFrom end")
+	return func(o *Options) {
+		o.flowCodec = flow
+	}
+}
+
+// TemplateContext specifies the context the templates of the call read as .ctx,
+// such as {{.ctx.tenant}}. It is required by the templates reading the context
+func TemplateContext(context *Context) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::TemplateContext start")
+	if context == nil {
+		panic("Error at TemplateContext, context not specified")
+	}
+	fmt.Println("lib/openfaas/workflow.go::TemplateContext end")
+	return func(o *Options) {
+		o.templateContext = context
+	}
+}
+
+// TransformTimeout specifies the maximum time a Transform runs its expression,
+// beyond which the transformation fails. By default it is 5 seconds
+func TransformTimeout(timeout time.Duration) Option {
+
+	fmt.Println("lib/openfaas/workflow.go::TransformTimeout start")
+	if timeout <= 0 {
+		panic("Error at TransformTimeout, timeout must be positive")
+	}
+	fmt.Println("lib/openfaas/workflow.go::TransformTimeout end")
+	return func(o *Options) {
+		o.transformTimeout = timeout
+	}
+}
+
 // GetWorkflow initiates a flow with a pipeline
 func GetWorkflow(pipeline *sdk.Pipeline) *Workflow {
 
 	fmt.Println("lib/openfaas/workflow.go::GetWorkflow start")
 	workflow := &Workflow{}
 	workflow.pipeline = pipeline
+	workflow.scope = &dagScope{flow: workflow}
 	fmt.Println("lib/openfaas/workflow.go::GetWorkflow end")
 	return workflow
 }
@@ -170,7 +868,10 @@ func GetWorkflow(pipeline *sdk.Pipeline) *Workflow {
 func (flow *Workflow) OnFailure(handler sdk.PipelineErrorHandler) {
 
 	fmt.Println("lib/openfaas/workflow.go::OnFailure start")
-	flow.pipeline.FailureHandler = handler
+	flow.failureHandler = handler
+	if flow.saga == nil {
+		flow.pipeline.FailureHandler = handler
+	}
 	fmt.Println("lib/openfaas/workflow.go::OnFailure end")
 }
 
@@ -198,6 +899,7 @@ func (flow *Workflow) Dag() *Dag {
 	fmt.Println("lib/openfaas/workflow.go::Dag start")
 	dag := &Dag{}
 	dag.udag = flow.pipeline.Dag
+	dag.scope = flow.scope
 	fmt.Println("lib/openfaas/workflow.go::Dag end")
 	return dag
 }
@@ -208,6 +910,10 @@ func (flow *Workflow) SetDag(dag *Dag) {
 	fmt.Println("lib/openfaas/workflow.go::SetDag start")
 	pipeline := flow.pipeline
 	pipeline.SetDag(dag.udag)
+	flow.scope.flow = nil
+	dag.scope.parent = nil
+	dag.scope.flow = flow
+	flow.scope = dag.scope
 	fmt.Println("lib/openfaas/workflow.go::SetDag end")
 }
 
@@ -217,6 +923,7 @@ func NewDag() *Dag {
 	fmt.Println("lib/openfaas/workflow.go::NewDag start")
 	dag := &Dag{}
 	dag.udag = sdk.NewDag()
+	dag.scope = &dagScope{}
 	fmt.Println("lib/openfaas/workflow.go::NewDag end")
 	return dag
 }
@@ -230,6 +937,7 @@ func (this *Dag) Append(dag *Dag) {
 	if err != nil {
 		panic(fmt.Sprintf("Error at AppendDag, %v", err))
 	}
+	this.scope.attach(dag.scope)
 	fmt.Println("lib/openfaas/workflow.go::Append end")
 }
 
@@ -241,16 +949,27 @@ func (this *Dag) Node(vertex string, options ...BranchOption) *Node {
 	if node == nil {
 		node = this.udag.AddVertex(vertex, []sdk.Operation{})
 	}
+	var aggregator sdk.Aggregator
+	var join *joinPolicy
 	o := &BranchOptions{}
 	for _, opt := range options {
 		o.reset()
 		opt(o)
 		if o.aggregator != nil {
-			node.AddAggregator(o.aggregator)
+			aggregator = o.aggregator
+		}
+		if o.join != nil {
+			join = o.join
 		}
 	}
+	if join != nil {
+		join.vertex = vertex
+		joinNode(node, join, aggregator)
+	} else if aggregator != nil {
+		node.AddAggregator(skipAwareAggregator(aggregator))
+	}
 	fmt.Println("lib/openfaas/workflow.go::Node end")
-	return &Node{unode: node}
+	return &Node{unode: node, scope: this.scope}
 }
 
 // Edge adds a directed edge between two vertex as <from>-><to>
@@ -261,6 +980,9 @@ func (this *Dag) Edge(from, to string, opts ...BranchOption) {
 	if err != nil {
 		panic(fmt.Sprintf("Error at AddEdge for %s-%s, %v", from, to, err))
 	}
+	resumeEdge(this.udag.GetNode(from), this.udag.GetNode(to))
+	var guard *guard
+	var convert *codecConversion
 	o := &BranchOptions{}
 	for _, opt := range opts {
 		o.reset()
@@ -274,12 +996,143 @@ func (this *Dag) Edge(from, to string, opts ...BranchOption) {
 		// in case there is a override
 		if o.forwarder != nil {
 			fromNode := this.udag.GetNode(from)
-			fromNode.AddForwarder(to, o.forwarder)
+			fromNode.AddForwarder(to, markerForwarder(o.forwarder))
+		}
+		if o.modifier != nil {
+			fromNode := this.udag.GetNode(from)
+			fromNode.AddForwarder(to, markerForwarder(modifierForwarder(from, to, o.modifier)))
+		}
+
+		if o.guard != nil {
+			guard = o.guard
+		}
+		if o.convert != nil {
+			convert = o.convert
+		}
+	}
+	// a guarded edge is skipped unless its predicate holds
+	if guard != nil {
+		if guard.key != "" {
+			panic(fmt.Sprintf("Error at AddEdge for %s-%s, When `%s` takes no condition key on an edge",
+				from, to, guard.source))
+		}
+		fromNode := this.udag.GetNode(from)
+		forwarder := fromNode.GetForwarder(to)
+		if forwarder == nil {
+			panic(fmt.Sprintf("Error at AddEdge for %s-%s, When requires an edge forwarding data", from, to))
+		}
+		fromNode.AddForwarder(to, guard.forwarder(from, to, forwarder))
+	}
+	// the failures of the vertex only follow its error edges
+	if _, ok := this.scope.errorEdges[from]; ok {
+		fromNode := this.udag.GetNode(from)
+		if forwarder := fromNode.GetForwarder(to); forwarder != nil {
+			fromNode.AddForwarder(to, successForwarder(forwarder))
+		}
+	}
+	// the timeouts of the vertex only follow its timeout edges
+	if _, ok := this.scope.timeoutEdges[from]; ok {
+		fromNode := this.udag.GetNode(from)
+		if forwarder := fromNode.GetForwarder(to); forwarder != nil {
+			fromNode.AddForwarder(to, eventForwarder(forwarder))
 		}
 	}
+	// the data is converted to the payload format of the child
+	if convert != nil {
+		fromNode := this.udag.GetNode(from)
+		forwarder := fromNode.GetForwarder(to)
+		if forwarder == nil {
+			panic(fmt.Sprintf("Error at AddEdge for %s-%s, Convert requires an edge forwarding data", from, to))
+		}
+		fromNode.AddForwarder(to, convert.forwarder(from, to, forwarder))
+	}
 	fmt.Println("lib/openfaas/workflow.go::Edge end")
 }
 
+// ErrorEdge adds an edge between two vertex as <from>-><to> taken when an operation
+// of <from> fails. The failure is forwarded to <to> as a JSON ErrorEnvelope and the
+// flow continues down that path, the other edges of <from> are skipped.
+// When <from> succeeds the error edge is skipped. A skipped vertex passes the skip
+// through its operations, and aggregators only receive the inputs that weren't
+// skipped. Failures of operations added with AddOperation are not routed
+func (this *Dag) ErrorEdge(from, to string) {
+
+	fmt.Println("lib/openfaas/workflow.go::ErrorEdge start")
+	fromNode := this.udag.GetNode(from)
+	if fromNode == nil {
+		panic(fmt.Sprintf("Error at ErrorEdge for %s-%s, vertex %s not found", from, to, from))
+	}
+	err := this.udag.AddEdge(from, to)
+	if err != nil {
+		panic(fmt.Sprintf("Error at ErrorEdge for %s-%s, %v", from, to, err))
+	}
+	resumeEdge(this.udag.GetNode(from), this.udag.GetNode(to))
+
+	if this.scope.errorEdges == nil {
+		this.scope.errorEdges = make(map[string][]string)
+	}
+	_, routed := this.scope.errorEdges[from]
+	this.scope.errorEdges[from] = append(this.scope.errorEdges[from], to)
+	fromNode.AddForwarder(to, errorForwarder)
+	if routed {
+		fmt.Println("lib/openfaas/workflow.go::ErrorEdge end")
+		return
+	}
+
+	for _, operation := range fromNode.Operations() {
+		if libop, ok := operation.(libOperation); ok {
+			libop.routeErrors(from)
+		}
+	}
+	for _, child := range fromNode.Children() {
+		if child.Id == to {
+			continue
+		}
+		if forwarder := fromNode.GetForwarder(child.Id); forwarder != nil {
+			fromNode.AddForwarder(child.Id, successForwarder(forwarder))
+		}
+	}
+	fmt.Println("lib/openfaas/workflow.go::ErrorEdge end")
+}
+
+// TimeoutEdge adds an edge between two vertex as <from>-><to> taken when a WaitForEvent
+// of <from> times out. The timeout is forwarded to <to> as a JSON EventTimeoutEnvelope
+// and the other edges of <from> are skipped. Without a timeout edge a timeout fails the vertex
+func (this *Dag) TimeoutEdge(from, to string) {
+
+	fmt.Println("lib/openfaas/workflow.go::TimeoutEdge start")
+	fromNode := this.udag.GetNode(from)
+	if fromNode == nil {
+		panic(fmt.Sprintf("Error at TimeoutEdge for %s-%s, vertex %s not found", from, to, from))
+	}
+	err := this.udag.AddEdge(from, to)
+	if err != nil {
+		panic(fmt.Sprintf("Error at TimeoutEdge for %s-%s, %v", from, to, err))
+	}
+	resumeEdge(this.udag.GetNode(from), this.udag.GetNode(to))
+
+	if this.scope.timeoutEdges == nil {
+		this.scope.timeoutEdges = make(map[string][]string)
+	}
+	_, routed := this.scope.timeoutEdges[from]
+	this.scope.timeoutEdges[from] = append(this.scope.timeoutEdges[from], to)
+	fromNode.AddForwarder(to, timeoutForwarder)
+	if routed {
+		fmt.Println("lib/openfaas/workflow.go::TimeoutEdge end")
+		return
+	}
+
+	for _, child := range fromNode.Children() {
+		if child.Id == to {
+			continue
+		}
+		if forwarder := fromNode.GetForwarder(child.Id); forwarder != nil {
+			fromNode.AddForwarder(child.Id, eventForwarder(forwarder))
+		}
+	}
+	fmt.Println("lib/openfaas/workflow.go::TimeoutEdge end")
+}
+
 // SubDag composites a seperate dag as a node.
 func (this *Dag) SubDag(vertex string, dag *Dag) {
 
@@ -289,6 +1142,7 @@ func (this *Dag) SubDag(vertex string, dag *Dag) {
 	if err != nil {
 		panic(fmt.Sprintf("Error at AddSubDag for %s, %v", vertex, err))
 	}
+	this.scope.attach(dag.scope)
 	fmt.Println("lib/openfaas/workflow.go::SubDag end")
 	return
 }
@@ -302,56 +1156,154 @@ func (this *Dag) ForEachBranch(vertex string, foreach sdk.ForEach, options ...Br
 	if foreach == nil {
 		panic(fmt.Sprintf("Error at AddForEachBranch for %s, foreach function not specified", vertex))
 	}
-	node.AddForEach(foreach)
 
+	var aggregator sdk.Aggregator
+	quorum := &quorumPolicy{}
+	maxParallel := 0
+	var parallelStore StateStore
+	parallelTimeout := DefaultParallelTimeout
+	batchSize := 0
+	noforwarder := false
 	for _, option := range options {
 		o := &BranchOptions{}
 		o.reset()
 		option(o)
 		if o.aggregator != nil {
-			node.AddSubAggregator(o.aggregator)
+			aggregator = o.aggregator
 		}
 		if o.noforwarder == true {
-			node.AddForwarder("dynamic", nil)
+			noforwarder = true
+		}
+		if o.continueOnError {
+			quorum.enabled = true
+		}
+		if o.minSuccess != 0 {
+			quorum.minSuccess = o.minSuccess
+		}
+		if o.minSuccessPercent != 0 {
+			quorum.minSuccessPercent = o.minSuccessPercent
+		}
+		if o.maxParallel != 0 {
+			maxParallel = o.maxParallel
+			parallelStore = o.parallelStore
+		}
+		if o.parallelTimeout != nil {
+			parallelTimeout = *o.parallelTimeout
+		}
+		if o.batchSize != 0 {
+			batchSize = o.batchSize
+		}
+	}
+	if batchSize > 0 {
+		foreach = batchForEach(foreach, batchSize)
+	}
+	if maxParallel > 0 {
+		foreach = parallelForEach(node, parallelStore, foreach)
+	}
+	node.AddForEach(foreach)
+	if noforwarder {
+		node.AddForwarder("dynamic", nil)
+	}
+	if aggregator != nil {
+		aggregator = skipAwareAggregator(aggregator)
+		if quorum.enabled {
+			aggregator = quorum.aggregator(vertex, aggregator)
 		}
+		node.AddSubAggregator(aggregator)
+	} else if quorum.enabled && !noforwarder {
+		panic(fmt.Sprintf("Error at AddForEachBranch for %s, aggregator not specified for ContinueOnError", vertex))
 	}
 
 	dag = NewDag()
-	err := node.AddForEachDag(dag.udag)
+	branch := dag
+	if maxParallel > 0 {
+		branch = parallelDag(node, this.scope, quorum.enabled, maxParallel, parallelStore, parallelTimeout, dag)
+	}
+	err := node.AddForEachDag(branch.udag)
 	if err != nil {
 		panic(fmt.Sprintf("Error at AddForEachBranch for %s, %v", vertex, err))
 	}
+	this.scope.attach(branch.scope)
+	if quorum.enabled || maxParallel > 0 {
+		// the release vertex frees the slot of a failing item
+		branch.scope.catchErrors()
+	}
 	fmt.Println("lib/openfaas/workflow.go::ForEachBranch end")
 	return
 }
 
 // ConditionalBranch composites multiple dags as a sub-dag which executes for a conditions matched
-// and returns the set of dags based on the condition passed
+// and returns the set of dags based on the condition passed. A condition returning an unknown
+// condition, or a When failing to evaluate, fails the vertex, the failure is routed by an
+// ErrorEdge of the vertex or caught by a TrySubDag
 func (this *Dag) ConditionalBranch(vertex string, conditions []string, condition sdk.Condition,
 	options ...BranchOption) (conditiondags map[string]*Dag) {
 
 	fmt.Println("lib/openfaas/workflow.go::ConditionalBranch start")
 	node := this.udag.AddVertex(vertex, []sdk.Operation{})
-	if condition == nil {
-		panic(fmt.Sprintf("Error at AddConditionalBranch for %s, condition function not specified", vertex))
-	}
-	node.AddCondition(condition)
 
+	policy := &conditionPolicy{vertex: vertex, mode: matchAll}
+	guards := []*guard{}
+	noforwarder := false
 	for _, option := range options {
 		o := &BranchOptions{}
 		o.reset()
 		option(o)
 		if o.aggregator != nil {
-			node.AddSubAggregator(o.aggregator)
+			node.AddSubAggregator(skipAwareAggregator(o.aggregator))
 		}
 		if o.noforwarder == true {
-			node.AddForwarder("dynamic", nil)
+			noforwarder = true
+		}
+		if o.elseBranch {
+			policy.elseBranch = true
+		}
+		if o.matchMode != "" {
+			policy.mode = o.matchMode
+		}
+		if o.guard != nil {
+			if o.guard.key == "" {
+				panic(fmt.Sprintf("Error at AddConditionalBranch for %s, When `%s` has no condition key",
+					vertex, o.guard.source))
+			}
+			guards = append(guards, o.guard)
+		}
+	}
+	var checked checkedCondition
+	if condition != nil {
+		checked = func(data []byte) ([]string, error) { return condition(data), nil }
+	}
+	if len(guards) != 0 {
+		if condition != nil {
+			panic(fmt.Sprintf("Error at AddConditionalBranch for %s, both condition function and When specified", vertex))
 		}
+		checked = guardCondition(vertex, guards)
+	}
+	if checked == nil {
+		panic(fmt.Sprintf("Error at AddConditionalBranch for %s, condition function not specified", vertex))
+	}
+	policy.validate(conditions)
+	for _, g := range guards {
+		if !policy.conditions[g.key] {
+			panic(fmt.Sprintf("Error at AddConditionalBranch for %s, When `%s` selects unknown condition %s",
+				vertex, g.source, g.key))
+		}
+	}
+	node.AddCondition(policy.condition(checked))
+	// a failing condition executes the dag failing the branch
+	node.AddConditionalDag(failedCondition, policy.failureDag(checked, this.scope).udag)
+	if noforwarder {
+		node.AddForwarder("dynamic", nil)
+	}
+
+	if policy.elseBranch {
+		conditions = append(append([]string{}, conditions...), ElseCondition)
 	}
 	conditiondags = make(map[string]*Dag)
 	for _, conditionKey := range conditions {
 		dag := NewDag()
 		node.AddConditionalDag(conditionKey, dag.udag)
+		this.scope.attach(dag.scope)
 		conditiondags[conditionKey] = dag
 	}
 	fmt.Println("lib/openfaas/workflow.go::ConditionalBranch end")
@@ -362,6 +1314,7 @@ func (this *Dag) ConditionalBranch(vertex string, conditions []string, condition
 func (node *Node) AddOperation(operation sdk.Operation) *Node {
 
 	fmt.Println("lib/openfaas/workflow.go::AddOperation start")
+	node.checkOutputSchema()
 	node.unode.AddOperation(operation)
 	fmt.Println("lib/openfaas/workflow.go::AddOperation end")
 	return node
@@ -377,14 +1330,25 @@ func (flow *Workflow) SyncNode(options ...BranchOption) *Node {
 	if node == nil {
 		node = dag.AddVertex("sync", []sdk.Operation{})
 	}
+	var aggregator sdk.Aggregator
+	var join *joinPolicy
 	o := &BranchOptions{}
 	for _, opt := range options {
 		o.reset()
 		opt(o)
 		if o.aggregator != nil {
-			node.AddAggregator(o.aggregator)
+			aggregator = o.aggregator
 		}
+		if o.join != nil {
+			join = o.join
+		}
+	}
+	if join != nil {
+		join.vertex = "sync"
+		joinNode(node, join, aggregator)
+	} else if aggregator != nil {
+		node.AddAggregator(skipAwareAggregator(aggregator))
 	}
 	fmt.Println("lib/openfaas/workflow.go::SyncNode end")
-	return &Node{unode: node}
+	return &Node{unode: node, scope: flow.scope}
 }